@@ -0,0 +1,25 @@
+package streamingconfig
+
+import (
+	"context"
+)
+
+// WithActorFromContext derives the author of the updates, the `By` of their
+// command, from their context when it is empty, e.g. from the user set by an
+// authentication middleware. An explicit `By` takes precedence over the
+// extractor. It applies to all the writes, e.g. PatchConfig, Rollback and
+// ScheduleUpdate, the latter recording the author upon scheduling.
+func WithActorFromContext[T Config](actor func(ctx context.Context) string) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.actorFromContext = actor
+	}
+}
+
+// actorOf returns the author of the update: by unless empty, the one of the
+// context otherwise.
+func (s *WatchedRepo[T]) actorOf(ctx context.Context, by string) string {
+	if by != "" || s.actorFromContext == nil {
+		return by
+	}
+	return s.actorFromContext(ctx)
+}
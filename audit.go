@@ -0,0 +1,165 @@
+package streamingconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRecord is the append-only record of the creation of a version (see
+// WithAuditCollection).
+type AuditRecord struct {
+	Version   uint64 `json:"version" bson:"version"`
+	UpdatedBy string `json:"updated_by" bson:"updated_by"`
+	// CreatedAt is the time the version was stored: its creation time, or the
+	// time of its import for the versions restored by Import.
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	// BeforeHash is the AfterHash of the previous record, empty for the first
+	// one.
+	BeforeHash string `json:"before_hash,omitempty" bson:"before_hash,omitempty"`
+	// AfterHash is the hex-encoded SHA-256 of the JSON encoding of the
+	// configuration of the version, without defaults.
+	AfterHash string `json:"after_hash" bson:"after_hash"`
+}
+
+// auditDocument is the stored form of an AuditRecord.
+type auditDocument struct {
+	AuditRecord   `bson:",inline"`
+	Discriminator bson.M `bson:",inline"`
+}
+
+// WithAuditCollection makes the repository write an audit record in the
+// collection for every version it creates, in the same transaction as the
+// version on the deployments supporting transactions, e.g. for compliance
+// regimes requiring an audit trail distinct from the versions. The records are
+// never updated nor deleted by the repository: pruning or expiring versions
+// leaves them untouched. The versions seeded with WithBootstrapFile and the
+// ones inserted or replaced by Import are recorded too, the latter at the time
+// of the import. The records are chained in creation order (see AuditRecord).
+//
+// It only applies to the repositories relying on MongoDB.
+func WithAuditCollection[T Config](name string) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.auditCollectionName = name
+	}
+}
+
+// ListAudit returns the audit records created within the dates of the query,
+// in chain order, by creation time (see Descending). ErrNotSupported is returned unless the
+// audit collection is set with WithAuditCollection. The Metadata of the query
+// is ignored.
+func (s *WatchedRepo[T]) ListAudit(ctx context.Context, query ListConfigDatesQuery) ([]*AuditRecord, error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	if s.audit == nil {
+		return nil, ErrNotSupported
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	opts := options.Find().
+		SetSort(auditOrder(query.Descending)).
+		SetSkip(query.Skip).
+		SetLimit(query.Limit)
+	cursor, err := s.audit.Find(ctxTimeout, s.filter(bson.M{
+		"created_at": bson.M{"$gte": query.From, "$lt": query.To},
+	}), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctxTimeout)
+	records := make([]*AuditRecord, 0)
+	for cursor.Next(ctxTimeout) {
+		record := &AuditRecord{}
+		if err := cursor.Decode(record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, cursor.Err()
+}
+
+// auditedWrite runs the write of the version along with the insertion of its
+// audit record, stored at the time, in a transaction unless the deployment is
+// a standalone server. The write runs alone unless the audit collection is
+// set.
+func (s *WatchedRepo[T]) auditedWrite(ctx context.Context, cfg *Versioned[T], at time.Time, write func(ctx context.Context) error) error {
+	if s.audit == nil {
+		return write(ctx)
+	}
+	b, err := json.Marshal(cfg.Config)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(b)
+	record := auditDocument{
+		AuditRecord: AuditRecord{
+			Version:   cfg.Version,
+			UpdatedBy: cfg.UpdatedBy,
+			CreatedAt: at,
+			Reason:    cfg.Reason,
+			AfterHash: hex.EncodeToString(hash[:]),
+		},
+		Discriminator: s.documentFilter,
+	}
+	insert := func(ctx context.Context) error {
+		if err := write(ctx); err != nil {
+			return err
+		}
+		before, err := s.lastAuditHash(ctx)
+		if err != nil {
+			return err
+		}
+		record.BeforeHash = before
+		_, err = s.audit.InsertOne(ctx, record)
+		return err
+	}
+	if s.topology == topologyStandalone {
+		return insert(ctx)
+	}
+	session, err := s.configs.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return nil, insert(sc)
+	})
+	return err
+}
+
+// lastAuditHash returns the AfterHash of the latest audit record, empty if
+// there is none.
+func (s *WatchedRepo[T]) lastAuditHash(ctx context.Context) (string, error) {
+	last := &AuditRecord{}
+	err := s.audit.FindOne(
+		ctx,
+		s.filter(bson.M{}),
+		options.FindOne().SetSort(auditOrder(true)),
+	).Decode(last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read last audit record: %w", err)
+	}
+	return last.AfterHash, nil
+}
+
+// auditOrder returns the sort of the audit records in chain order: by
+// creation time, then by _id, an ObjectID increasing with the insertions, for
+// the records created at the same time. The versions do not order them, as
+// their numbering starts over once they all expired (see WithVersionTTL).
+func auditOrder(descending bool) bson.D {
+	order := sortOrder(descending)
+	return bson.D{{Key: "created_at", Value: order}, {Key: "_id", Value: order}}
+}
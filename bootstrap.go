@@ -0,0 +1,87 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultBootstrapAuthor is the author of the versions seeded from the
+// bootstrap files.
+const defaultBootstrapAuthor = "bootstrap"
+
+// WithBootstrapFile makes Start seed the first version from the JSON or YAML
+// file at the path when no version exists yet, instead of starting from the
+// zero configuration with its defaults, e.g. for the deployments to ship a
+// sensible starting configuration in source control. The file is decoded as
+// YAML when its extension is `.yaml` or `.yml`, as JSON otherwise.
+//
+// The seeded configuration is validated, and goes through the update hooks, as
+// by UpdateConfig, and Start fails if the file cannot be read or the
+// configuration is invalid. The file is not read when a version already
+// exists.
+func WithBootstrapFile[T Config](path string) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.bootstrapFile = path
+	}
+}
+
+// WithBootstrapAuthor sets the author of the version seeded with
+// WithBootstrapFile, "bootstrap" by default.
+func WithBootstrapAuthor[T Config](by string) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.bootstrapBy = by
+	}
+}
+
+// bootstrap creates the first version from the bootstrap file.
+func (s *WatchedRepo[T]) bootstrap(ctx context.Context) (*Versioned[T], error) {
+	b, err := os.ReadFile(s.bootstrapFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading bootstrap file: %w", err)
+	}
+	var codec Codec = JSONCodec{}
+	switch filepath.Ext(s.bootstrapFile) {
+	case ".yaml", ".yml":
+		codec = YAMLCodec{}
+	}
+	cfg, err := decodeNew[T](codec, b)
+	if err != nil {
+		return nil, fmt.Errorf("decoding bootstrap file: %w", err)
+	}
+	by := s.bootstrapBy
+	if by == "" {
+		by = defaultBootstrapAuthor
+	}
+	v, err := s.nextVersion(nil, UpdateConfigCmd[T]{
+		By:     by,
+		Config: cfg,
+		Reason: "bootstrapped from " + filepath.Base(s.bootstrapFile),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	if err := s.preUpdate(ctxTimeout, nil, v.Config); err != nil {
+		return nil, err
+	}
+	err = s.store.Insert(ctxTimeout, v)
+	if errors.Is(err, ErrConcurrentUpdate) {
+		// another instance seeded the configuration first.
+		return s.store.Latest(ctxTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(s.postUpdateHooks) > 0 {
+		withDefaults, err := s.withDefaults(v)
+		if err != nil {
+			return nil, err
+		}
+		s.postUpdate(ctx, withDefaults)
+	}
+	return v, nil
+}
@@ -0,0 +1,119 @@
+package streamingconfig
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Codec encodes and decodes the configurations at the boundaries of the
+// applications, e.g. in the bodies of their APIs.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	// ContentType is the media type of the encoded data.
+	ContentType() string
+}
+
+// JSONCodec encodes the configurations as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// YAMLCodec encodes the configurations as YAML, friendlier for human-edited
+// configurations. The YAML documents are translated from and to JSON, so that
+// the `json` field tags and the JSON (un)marshalers of the configurations
+// apply.
+type YAMLCodec struct{}
+
+func (YAMLCodec) Marshal(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// JSON being YAML, decoding it as a node keeps the order of the fields.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+	return yaml.Marshal(&doc)
+}
+
+func (YAMLCodec) Unmarshal(data []byte, v any) error {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (YAMLCodec) ContentType() string {
+	return "application/yaml"
+}
+
+// blockStyle resets the JSON flow style and quoting of the node and its
+// children, for the YAML encoder to pick the idiomatic ones.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
+
+// WithCodec sets the codec of the repository, JSON by default, returned by
+// Codec and used by DecodeConfig, e.g. for the APIs of the application to
+// accept and return YAML. The versions are stored, and the defaults applied,
+// the same way whatever the codec.
+func WithCodec[T Config](c Codec) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.codec = c
+	}
+}
+
+// Codec returns the codec of the repository.
+func (s *WatchedRepo[T]) Codec() Codec {
+	if s.codec == nil {
+		return JSONCodec{}
+	}
+	return s.codec
+}
+
+// DecodeConfig decodes a configuration with the codec of the repository,
+// e.g. the body of a request to be passed to UpdateConfig.
+func (s *WatchedRepo[T]) DecodeConfig(data []byte) (T, error) {
+	return decodeNew[T](s.Codec(), data)
+}
+
+// decodeNew decodes the data into a newly allocated value.
+func decodeNew[T any](c Codec, data []byte) (T, error) {
+	var v T
+	if isPointer[T]() {
+		v = reflect.New(reflect.TypeOf(v).Elem()).Interface().(T)
+		if err := c.Unmarshal(data, v); err != nil {
+			var zero T
+			return zero, err
+		}
+		return v, nil
+	}
+	if err := c.Unmarshal(data, &v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
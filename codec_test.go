@@ -0,0 +1,44 @@
+package streamingconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_YAMLCodec(t *testing.T) {
+	cfg := &schemaConfig{Name: "bobby", Age: 40, Nested: schemaNested{Mode: "fast"}}
+
+	b, err := YAMLCodec{}.Marshal(cfg)
+	require.NoError(t, err)
+	// the json tags apply and the fields keep their order
+	require.Equal(t, "name: bobby\nage: 40\nnested:\n    mode: fast\n", string(b))
+
+	got := new(schemaConfig)
+	require.NoError(t, YAMLCodec{}.Unmarshal(b, got))
+	require.Equal(t, cfg, got)
+
+	require.Error(t, YAMLCodec{}.Unmarshal([]byte("age: old"), new(schemaConfig)))
+	require.Error(t, YAMLCodec{}.Unmarshal([]byte("name: [bobby"), new(schemaConfig)))
+}
+
+func Test_DecodeConfig(t *testing.T) {
+	s := &WatchedRepo[*schemaConfig]{}
+	require.Equal(t, JSONCodec{}, s.Codec())
+	got, err := s.DecodeConfig([]byte(`{"name":"bobby"}`))
+	require.NoError(t, err)
+	require.Equal(t, &schemaConfig{Name: "bobby"}, got)
+
+	WithCodec[*schemaConfig](YAMLCodec{})(s)
+	got, err = s.DecodeConfig([]byte("name: bobby\nnested:\n  mode: safe\n"))
+	require.NoError(t, err)
+	require.Equal(t, &schemaConfig{Name: "bobby", Nested: schemaNested{Mode: "safe"}}, got)
+
+	_, err = s.DecodeConfig([]byte("age: old"))
+	require.Error(t, err)
+
+	v := &WatchedRepo[valueConfig]{codec: YAMLCodec{}}
+	value, err := v.DecodeConfig([]byte("hosts: [a, b]"))
+	require.NoError(t, err)
+	require.Equal(t, valueConfig{Hosts: []string{"a", "b"}}, value)
+}
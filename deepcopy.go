@@ -0,0 +1,311 @@
+package streamingconfig
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxCopyDepth is the nesting of pointers, slices and maps beyond which the
+// copy is left to encoding/json, which reports the cycles.
+const maxCopyDepth = 1000
+
+// errCopyTooDeep aborts the reflection-based copy of too deeply nested values.
+var errCopyTooDeep = errors.New("value too deeply nested")
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// copyPlans caches the copyPlan of the types.
+var copyPlans sync.Map
+
+// copyPlan tells how to copy the values of a type.
+type copyPlan struct {
+	// roundTrip is set for the values copied through encoding/json, whose
+	// encoding is not the identity: the types with custom (un)marshaling,
+	// interfaces, structs with embedded fields and unsupported kinds.
+	roundTrip bool
+	// fields are the fields of the structs encoded by encoding/json.
+	fields []fieldPlan
+}
+
+// fieldPlan tells how to copy a struct field.
+type fieldPlan struct {
+	index     int
+	omitEmpty bool
+}
+
+// deepCopy returns a copy of the value sharing no memory with it. The copy is
+// the one of an encoding/json round trip, as the stored versions are decoded:
+// unexported fields, fields tagged "-" and empty "omitempty" fields are reset,
+// as a JSON-decoded configuration would have them. Plain data is copied with
+// reflection, and the rest through encoding/json. Nil and empty slices and
+// maps are otherwise kept apart, for an empty value to still override a
+// default one (see copyAndSetDefaults).
+func deepCopy[T any](orig T) (T, error) {
+	src := reflect.ValueOf(&orig).Elem()
+	if src.Kind() == reflect.Interface || src.Kind() == reflect.Pointer && src.IsNil() {
+		// decoding into a newly allocated value has its own semantics.
+		return jsonCopy(orig)
+	}
+	// the value passed to json.Marshal is not addressable.
+	src = reflect.ValueOf(orig)
+	var cp T
+	err := copyValue(reflect.ValueOf(&cp).Elem(), src, 0)
+	if errors.Is(err, errCopyTooDeep) {
+		return jsonCopy(orig)
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return cp, nil
+}
+
+// jsonCopy copies the value through an encoding/json round trip.
+func jsonCopy[T any](orig T) (T, error) {
+	b, err := json.Marshal(orig)
+	if err != nil {
+		var zeroV T
+		return zeroV, err
+	}
+	return unmarshalNew[T](b)
+}
+
+// copyValue copies src into dst, a zero value of the same type.
+func copyValue(dst, src reflect.Value, depth int) error {
+	plan := copyPlanOf(src.Type())
+	if plan.roundTrip {
+		return roundTrip(dst, src)
+	}
+	switch src.Kind() {
+	case reflect.Struct:
+		for _, f := range plan.fields {
+			field := src.Field(f.index)
+			if f.omitEmpty && isEmptyValue(field) {
+				continue
+			}
+			if err := copyValue(dst.Field(f.index), field, depth); err != nil {
+				return err
+			}
+		}
+	case reflect.Pointer:
+		if src.IsNil() {
+			return nil
+		}
+		if depth++; depth > maxCopyDepth {
+			return errCopyTooDeep
+		}
+		elem := reflect.New(src.Type().Elem())
+		if err := copyValue(elem.Elem(), src.Elem(), depth); err != nil {
+			return err
+		}
+		dst.Set(elem)
+	case reflect.Slice:
+		if src.IsNil() {
+			return nil
+		}
+		if depth++; depth > maxCopyDepth {
+			return errCopyTooDeep
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		return copyElems(dst, src, depth)
+	case reflect.Array:
+		return copyElems(dst, src, depth)
+	case reflect.Map:
+		if src.IsNil() {
+			return nil
+		}
+		if depth++; depth > maxCopyDepth {
+			return errCopyTooDeep
+		}
+		if src.Type().Key().Kind() == reflect.String {
+			for _, k := range src.MapKeys() {
+				if !utf8.ValidString(k.String()) {
+					// the keys are sanitized, and may then collide.
+					return roundTrip(dst, src)
+				}
+			}
+		}
+		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		iter := src.MapRange()
+		for iter.Next() {
+			v := reflect.New(src.Type().Elem()).Elem()
+			if err := copyValue(v, iter.Value(), depth); err != nil {
+				return err
+			}
+			dst.SetMapIndex(iter.Key(), v)
+		}
+	case reflect.Float32, reflect.Float64:
+		if f := src.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			// for encoding/json to report the unsupported value.
+			return roundTrip(dst, src)
+		}
+		dst.Set(src)
+	case reflect.String:
+		if !utf8.ValidString(src.String()) {
+			// the invalid bytes are replaced.
+			return roundTrip(dst, src)
+		}
+		dst.Set(src)
+	default:
+		dst.Set(src)
+	}
+	return nil
+}
+
+// copyElems copies the elements of the src slice or array into dst.
+func copyElems(dst, src reflect.Value, depth int) error {
+	if src.Kind() == reflect.Slice && src.Type().Elem().Kind() == reflect.Uint8 &&
+		!copyPlanOf(src.Type().Elem()).roundTrip {
+		reflect.Copy(dst, src)
+		return nil
+	}
+	for i := range src.Len() {
+		if err := copyValue(dst.Index(i), src.Index(i), depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roundTrip copies src into dst through encoding/json, calling the
+// pointer-receiver marshalers of the addressable values as it does.
+func roundTrip(dst, src reflect.Value) error {
+	v := src
+	if src.CanAddr() {
+		v = src.Addr()
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+	cp := reflect.New(src.Type())
+	if err := json.Unmarshal(b, cp.Interface()); err != nil {
+		return err
+	}
+	dst.Set(cp.Elem())
+	return nil
+}
+
+// copyPlanOf returns the copyPlan of the type.
+func copyPlanOf(t reflect.Type) *copyPlan {
+	if plan, ok := copyPlans.Load(t); ok {
+		return plan.(*copyPlan)
+	}
+	plan, _ := copyPlans.LoadOrStore(t, newCopyPlan(t))
+	return plan.(*copyPlan)
+}
+
+// newCopyPlan computes the copyPlan of the type.
+func newCopyPlan(t reflect.Type) *copyPlan {
+	for _, marshaler := range []reflect.Type{
+		jsonMarshalerType, jsonUnmarshalerType, textMarshalerType, textUnmarshalerType,
+	} {
+		if t.Implements(marshaler) || reflect.PointerTo(t).Implements(marshaler) {
+			return &copyPlan{roundTrip: true}
+		}
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128,
+		reflect.UnsafePointer:
+		return &copyPlan{roundTrip: true}
+	case reflect.Map:
+		if copyPlanOf(t.Key()).roundTrip {
+			return &copyPlan{roundTrip: true}
+		}
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return &copyPlan{}
+		}
+		return &copyPlan{roundTrip: true}
+	case reflect.Struct:
+		return newStructPlan(t)
+	}
+	return &copyPlan{}
+}
+
+// newStructPlan computes the copyPlan of the struct type, copied through
+// encoding/json when its fields are not encoded one to one.
+func newStructPlan(t reflect.Type) *copyPlan {
+	plan := &copyPlan{}
+	names := make(map[string]bool, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Anonymous {
+			// the fields of embedded structs are promoted.
+			return &copyPlan{roundTrip: true}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		if names[name] || !isValidFieldName(name) || hasTagOption(opts, "omitzero") {
+			// fields with duplicate names are dropped.
+			return &copyPlan{roundTrip: true}
+		}
+		names[name] = true
+		plan.fields = append(plan.fields, fieldPlan{index: i, omitEmpty: hasTagOption(opts, "omitempty")})
+	}
+	return plan
+}
+
+// isValidFieldName reports whether encoding/json uses the name of the tag,
+// rather than the one of the field.
+func isValidFieldName(name string) bool {
+	for _, c := range name {
+		if !strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c) &&
+			!unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasTagOption reports whether the comma-separated options hold the option.
+func hasTagOption(opts, option string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyValue reports whether encoding/json omits the value of an
+// "omitempty" field.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package streamingconfig
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type copyNested struct {
+	Mode    string             `json:"mode"`
+	Weights map[string]float64 `json:"weights,omitempty"`
+	Ratio   *float64           `json:"ratio"`
+}
+
+type copyEmbedded struct {
+	copyNested
+	Extra string `json:"extra"`
+}
+
+type copyAll struct {
+	Name       string `json:"name"`
+	Skipped    string `json:"-"`
+	unexported string
+	Dash       string                 `json:"-,"`
+	Count      int                    `json:"count,omitempty"`
+	Negative   float64                `json:"negative,omitempty"`
+	Enabled    bool                   `json:"enabled"`
+	Timeout    time.Duration          `json:"timeout"`
+	At         time.Time              `json:"at"`
+	AtPtr      *time.Time             `json:"at_ptr"`
+	List       []string               `json:"list"`
+	EmptyList  []string               `json:"empty_list,omitempty"`
+	Bytes      []byte                 `json:"bytes"`
+	Array      [2]int                 `json:"array"`
+	ByID       map[int]*copyNested    `json:"by_id"`
+	EmptyMap   map[string]string      `json:"empty_map"`
+	Nested     copyNested             `json:"nested"`
+	NestedPtr  *copyNested            `json:"nested_ptr"`
+	Nesteds    []copyNested           `json:"nesteds"`
+	Any        any                    `json:"any"`
+	Generic    map[string]any         `json:"generic"`
+	Embedded   copyEmbedded           `json:"embedded"`
+	Raw        []map[string][]float32 `json:"raw"`
+}
+
+func Test_deepCopy(t *testing.T) {
+	ratio := -0.0
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6, time.FixedZone("x", 3600))
+	for name, orig := range map[string]*copyAll{
+		"zero": {},
+		"full": {
+			Name:       "bobby",
+			Skipped:    "skipped",
+			unexported: "unexported",
+			Dash:       "dash",
+			Count:      3,
+			Negative:   ratio,
+			Enabled:    true,
+			Timeout:    time.Second,
+			At:         time.Now(),
+			AtPtr:      &at,
+			List:       []string{"a", "b"},
+			EmptyList:  []string{},
+			Bytes:      []byte("bytes"),
+			Array:      [2]int{1, 2},
+			ByID:       map[int]*copyNested{1: {Mode: "fast"}, 2: nil},
+			EmptyMap:   map[string]string{},
+			Nested:     copyNested{Mode: "fast", Weights: map[string]float64{"a": 1.5}, Ratio: &ratio},
+			NestedPtr:  &copyNested{Weights: map[string]float64{}},
+			Nesteds:    []copyNested{{Mode: "a"}, {}},
+			Any:        3,
+			Generic:    map[string]any{"list": []int{1}, "nil": nil},
+			Embedded:   copyEmbedded{copyNested: copyNested{Mode: "promoted"}, Extra: "extra"},
+			Raw:        []map[string][]float32{{"a": {0.1, 0.2}}, nil},
+		},
+		"invalid utf8": {
+			Name: "bob\xffby",
+			Nested: copyNested{
+				Weights: map[string]float64{"a\xff": 1, "a\xfe": 2},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			want, err := jsonCopy(orig)
+			require.NoError(t, err)
+			got, err := deepCopy(orig)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+			require.NotSame(t, orig, got)
+		})
+	}
+
+	t.Run("no shared memory", func(t *testing.T) {
+		orig := &copyAll{
+			List:   []string{"a"},
+			Bytes:  []byte("b"),
+			ByID:   map[int]*copyNested{1: {Mode: "fast"}},
+			Nested: copyNested{Weights: map[string]float64{"a": 1}},
+		}
+		got, err := deepCopy(orig)
+		require.NoError(t, err)
+		got.List[0] = "changed"
+		got.Bytes[0] = 'c'
+		got.ByID[1].Mode = "changed"
+		got.Nested.Weights["a"] = 2
+		require.Equal(t, "a", orig.List[0])
+		require.Equal(t, byte('b'), orig.Bytes[0])
+		require.Equal(t, "fast", orig.ByID[1].Mode)
+		require.Equal(t, 1.0, orig.Nested.Weights["a"])
+	})
+
+	t.Run("values and nil pointers", func(t *testing.T) {
+		value, err := deepCopy(valueConfig{Name: "bobby"})
+		require.NoError(t, err)
+		require.Equal(t, valueConfig{Name: "bobby"}, value)
+		want, err := jsonCopy((*copyAll)(nil))
+		require.NoError(t, err)
+		got, err := deepCopy((*copyAll)(nil))
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("unsupported values", func(t *testing.T) {
+		_, err := deepCopy(&copyNested{Ratio: ptr(math.NaN())})
+		require.Error(t, err)
+		_, err = deepCopy(&copyAll{Any: func() {}})
+		require.Error(t, err)
+	})
+
+	t.Run("cycles", func(t *testing.T) {
+		type node struct {
+			Next *node `json:"next"`
+		}
+		cycle := &node{}
+		cycle.Next = cycle
+		_, err := deepCopy(cycle)
+		require.Error(t, err)
+	})
+}
+
+type copyDefaults struct {
+	List      []string          `json:"list"`
+	Omit      []string          `json:"omit,omitempty"`
+	Default   []string          `json:"default" default:"[\"a\"]"`
+	OmitDef   []string          `json:"omit_def,omitempty" default:"[\"a\"]"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	LabelsDef map[string]string `json:"labels_def" default:"{\"a\":\"b\"}"`
+}
+
+func (c *copyDefaults) Update(Config) error { return nil }
+
+func Test_copyAndSetDefaults_nilAndEmpty(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		got, err := copyAndSetDefaults(&copyDefaults{})
+		require.NoError(t, err)
+		require.Equal(t, &copyDefaults{
+			Default:   []string{"a"},
+			OmitDef:   []string{"a"},
+			LabelsDef: map[string]string{"a": "b"},
+		}, got)
+		require.Nil(t, got.List)
+		require.Nil(t, got.Omit)
+		require.Nil(t, got.Labels)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		empty := &copyDefaults{
+			List:      []string{},
+			Omit:      []string{},
+			Default:   []string{},
+			OmitDef:   []string{},
+			Labels:    map[string]string{},
+			LabelsDef: map[string]string{},
+		}
+		got, err := copyAndSetDefaults(empty)
+		require.NoError(t, err)
+		// the empty "omitempty" ones are not stored, and thus reset.
+		require.Equal(t, &copyDefaults{
+			List:      []string{},
+			Default:   []string{},
+			OmitDef:   []string{"a"},
+			LabelsDef: map[string]string{},
+		}, got)
+		require.NotNil(t, got.List)
+		require.Nil(t, got.Omit)
+		require.Nil(t, got.Labels)
+	})
+
+	t.Run("populated", func(t *testing.T) {
+		populated := &copyDefaults{
+			List:      []string{"x"},
+			Omit:      []string{"x"},
+			Default:   []string{"x"},
+			OmitDef:   []string{"x"},
+			Labels:    map[string]string{"x": "y"},
+			LabelsDef: map[string]string{"x": "y"},
+		}
+		got, err := copyAndSetDefaults(populated)
+		require.NoError(t, err)
+		// the default entries are merged into the maps.
+		populated.LabelsDef["a"] = "b"
+		require.Equal(t, populated, got)
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func Benchmark_deepCopy(b *testing.B) {
+	orig := &copyAll{
+		Name:    "bobby",
+		List:    strings.Split(strings.Repeat("item,", 100), ","),
+		ByID:    make(map[int]*copyNested),
+		Nesteds: make([]copyNested, 100),
+	}
+	for i := range 100 {
+		orig.ByID[i] = &copyNested{Mode: fmt.Sprint(i), Weights: map[string]float64{"w": float64(i)}}
+	}
+	b.Run("json", func(b *testing.B) {
+		for range b.N {
+			if _, err := jsonCopy(orig); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reflect", func(b *testing.B) {
+		for range b.N {
+			if _, err := deepCopy(orig); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package streamingconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// defaultTagged caches whether the struct types carry `default` tags.
+var defaultTagged sync.Map
+
+// prepareDefaults prepares the struct value for defaults.Set, which only sets
+// the zero fields, at any depth:
+//   - the nil struct pointers whose type carries `default` tags are allocated,
+//     for defaults.Set to apply them: it only sets the defaults of the
+//     allocated structs. The pointers tagged with a `default` are left to
+//     defaults.Set, and the nil elements of the slices and maps stay nil. A
+//     type is not allocated within itself, for recursive types to end;
+//   - the entries of the `default` tag of the non-empty map fields are merged
+//     into them, the stored entries overriding the default ones with the same
+//     key. defaults.Set sets all of them in the nil maps, and none in the
+//     empty ones.
+func prepareDefaults(v reflect.Value, allocating map[reflect.Type]bool) error {
+	if !allocating[v.Type()] {
+		allocating[v.Type()] = true
+		defer delete(allocating, v.Type())
+	}
+	for i := range v.NumField() {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		field := v.Field(i)
+		defaultValue, tagged := f.Tag.Lookup("default")
+		switch {
+		case field.Kind() == reflect.Map && tagged && field.Len() > 0:
+			if err := mergeMapDefaults(field, defaultValue); err != nil {
+				return fmt.Errorf("default of field %s: %w", f.Name, err)
+			}
+		case field.Kind() == reflect.Pointer && field.IsNil() && f.Type.Elem().Kind() == reflect.Struct:
+			elem := f.Type.Elem()
+			if tagged || allocating[elem] || !hasDefaultTags(elem) {
+				continue
+			}
+			field.Set(reflect.New(elem))
+		}
+		if err := prepareNestedDefaults(field, allocating); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareNestedDefaults applies prepareDefaults to the structs held by the
+// value: itself, the one it points to, or its elements.
+func prepareNestedDefaults(v reflect.Value, allocating map[reflect.Type]bool) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		return prepareDefaults(v, allocating)
+	case reflect.Pointer:
+		if !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+			return prepareDefaults(v.Elem(), allocating)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			if err := prepareNestedDefaults(v.Index(i), allocating); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// the values are not addressable, unlike the structs they point to.
+		if v.Type().Elem().Kind() == reflect.Pointer {
+			iter := v.MapRange()
+			for iter.Next() {
+				if err := prepareNestedDefaults(iter.Value(), allocating); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mergeMapDefaults adds to the map the entries of the JSON object of the
+// default whose keys it lacks.
+func mergeMapDefaults(m reflect.Value, defaultValue string) error {
+	defaults := reflect.New(m.Type())
+	if err := json.Unmarshal([]byte(defaultValue), defaults.Interface()); err != nil {
+		return err
+	}
+	iter := defaults.Elem().MapRange()
+	for iter.Next() {
+		if !m.MapIndex(iter.Key()).IsValid() {
+			m.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	return nil
+}
+
+// hasDefaultTags reports whether the struct type, or any of its nested
+// structs, carries `default` tags.
+func hasDefaultTags(t reflect.Type) bool {
+	if tagged, ok := defaultTagged.Load(t); ok {
+		return tagged.(bool)
+	}
+	tagged := structHasDefaultTags(t, map[reflect.Type]bool{})
+	defaultTagged.Store(t, tagged)
+	return tagged
+}
+
+// structHasDefaultTags implements hasDefaultTags, visiting every type once.
+func structHasDefaultTags(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if _, ok := f.Tag.Lookup("default"); ok {
+			return true
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && structHasDefaultTags(ft, visited) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package streamingconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type defaultsLeaf struct {
+	Level int `json:"level" default:"3"`
+}
+
+type defaultsNested struct {
+	Mode string          `json:"mode" default:"fast"`
+	Leaf *defaultsLeaf   `json:"leaf"`
+	Next *defaultsNested `json:"next"`
+}
+
+type defaultsPlain struct {
+	Name string `json:"name"`
+}
+
+type defaultsConfig struct {
+	Nested *defaultsNested            `json:"nested"`
+	Value  defaultsNested             `json:"value"`
+	Plain  *defaultsPlain             `json:"plain"`
+	List   []*defaultsNested          `json:"list"`
+	ByKey  map[string]*defaultsNested `json:"by_key"`
+}
+
+func (c *defaultsConfig) Update(Config) error { return nil }
+
+func Test_copyAndSetDefaults_nestedPointers(t *testing.T) {
+	got, err := copyAndSetDefaults(&defaultsConfig{
+		List:  []*defaultsNested{nil, {Mode: "safe"}},
+		ByKey: map[string]*defaultsNested{"a": {}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &defaultsConfig{
+		Nested: &defaultsNested{Mode: "fast", Leaf: &defaultsLeaf{Level: 3}},
+		Value:  defaultsNested{Mode: "fast", Leaf: &defaultsLeaf{Level: 3}},
+		List:   []*defaultsNested{nil, {Mode: "safe", Leaf: &defaultsLeaf{Level: 3}}},
+		ByKey:  map[string]*defaultsNested{"a": {Mode: "fast", Leaf: &defaultsLeaf{Level: 3}}},
+	}, got)
+
+	t.Run("stored values are kept", func(t *testing.T) {
+		got, err := copyAndSetDefaults(&defaultsConfig{
+			Nested: &defaultsNested{Mode: "safe", Leaf: &defaultsLeaf{Level: 1}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &defaultsNested{Mode: "safe", Leaf: &defaultsLeaf{Level: 1}}, got.Nested)
+	})
+}
+
+type defaultsMaps struct {
+	Labels  map[string]string `json:"labels" default:"{\"env\":\"prod\",\"team\":\"core\"}"`
+	Limits  map[string]int    `json:"limits" default:"{\"cpu\":2}"`
+	Invalid map[string]int    `json:"invalid" default:"{\"cpu\":\"two\"}"`
+}
+
+func (c *defaultsMaps) Update(Config) error { return nil }
+
+func Test_copyAndSetDefaults_maps(t *testing.T) {
+	t.Run("nil maps take the defaults", func(t *testing.T) {
+		got, err := copyAndSetDefaults(&defaultsMaps{Invalid: map[string]int{}})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"env": "prod", "team": "core"}, got.Labels)
+		require.Equal(t, map[string]int{"cpu": 2}, got.Limits)
+	})
+
+	t.Run("stored entries override the defaults", func(t *testing.T) {
+		stored := &defaultsMaps{
+			Labels:  map[string]string{"env": "staging", "owner": "bobby"},
+			Limits:  map[string]int{"memory": 512},
+			Invalid: map[string]int{},
+		}
+		got, err := copyAndSetDefaults(stored)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"env": "staging", "owner": "bobby", "team": "core"}, got.Labels)
+		require.Equal(t, map[string]int{"cpu": 2, "memory": 512}, got.Limits)
+		// the stored maps are left untouched.
+		require.Equal(t, map[string]string{"env": "staging", "owner": "bobby"}, stored.Labels)
+	})
+
+	t.Run("empty maps override the defaults", func(t *testing.T) {
+		got, err := copyAndSetDefaults(&defaultsMaps{Labels: map[string]string{}, Invalid: map[string]int{}})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{}, got.Labels)
+	})
+
+	t.Run("invalid default", func(t *testing.T) {
+		_, err := copyAndSetDefaults(&defaultsMaps{Invalid: map[string]int{"memory": 512}})
+		require.ErrorContains(t, err, "default of field Invalid")
+	})
+}
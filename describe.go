@@ -0,0 +1,44 @@
+package streamingconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Description gathers what generic frontends need to render an edit form for
+// the configuration.
+type Description[T Config] struct {
+	// Schema is the JSON Schema of the configuration, see GenerateJSONSchema.
+	Schema json.RawMessage `json:"schema"`
+	// Defaults is a configuration only holding the default values.
+	Defaults T `json:"defaults"`
+	// Version is the current version, 0 if no configuration was ever created.
+	Version uint64 `json:"version"`
+}
+
+// Describe returns the schema of the configuration, its default values and
+// the current version.
+func (s *WatchedRepo[T]) Describe() (*Description[T], error) {
+	latest, err := s.GetLatestVersion()
+	if err != nil && !errors.Is(err, ErrNotInitialized) {
+		return nil, err
+	}
+	schema, err := GenerateJSONSchema[T]()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate schema: %w", err)
+	}
+	defaultsCfg, err := defaultConfig[T]()
+	if err != nil {
+		return nil, fmt.Errorf("could not set defaults: %w", err)
+	}
+	var version uint64
+	if latest != nil {
+		version = latest.Version
+	}
+	return &Description[T]{
+		Schema:   schema,
+		Defaults: defaultsCfg,
+		Version:  version,
+	}, nil
+}
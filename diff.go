@@ -0,0 +1,131 @@
+package streamingconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind tells how a field changed between two versions.
+type ChangeKind string
+
+const (
+	FieldAdded    ChangeKind = "added"
+	FieldRemoved  ChangeKind = "removed"
+	FieldModified ChangeKind = "modified"
+)
+
+// FieldChange is a change of a field of the JSON representation of the
+// configuration between two versions.
+type FieldChange struct {
+	// Path is the JSON pointer of the field, e.g. "/nested/counter".
+	Path string     `json:"path"`
+	Kind ChangeKind `json:"kind"`
+	// Old is the value in the first version, nil when the field was added.
+	Old any `json:"old,omitempty"`
+	// New is the value in the second version, nil when the field was removed.
+	New any `json:"new,omitempty"`
+}
+
+// Diff returns the changes of the fields between two versions, as stored, in
+// path order. Objects and arrays are compared member by member. It returns
+// ErrConfigurationNotFound if any of the versions does not exist.
+func (s *WatchedRepo[T]) Diff(ctx context.Context, fromVersion, toVersion uint64) ([]FieldChange, error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	from, err := s.findVersion(ctx, fromVersion)
+	if err != nil {
+		return nil, fmt.Errorf("could not load version %d: %w", fromVersion, err)
+	}
+	to, err := s.findVersion(ctx, toVersion)
+	if err != nil {
+		return nil, fmt.Errorf("could not load version %d: %w", toVersion, err)
+	}
+	return diffVersions(from, to)
+}
+
+// diffVersions walks the JSON representations of the configurations of the
+// versions.
+func diffVersions[T Config](from, to *Versioned[T]) ([]FieldChange, error) {
+	var docs [2]any
+	for i, v := range []*Versioned[T]{from, to} {
+		b, err := json.Marshal(v.Config)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &docs[i]); err != nil {
+			return nil, err
+		}
+	}
+	changes := make([]FieldChange, 0)
+	diffValues("", docs[0], docs[1], &changes)
+	return changes, nil
+}
+
+func diffValues(path string, old, new any, changes *[]FieldChange) {
+	switch oldV := old.(type) {
+	case map[string]any:
+		if newV, ok := new.(map[string]any); ok {
+			diffObjects(path, oldV, newV, changes)
+			return
+		}
+	case []any:
+		if newV, ok := new.([]any); ok {
+			diffArrays(path, oldV, newV, changes)
+			return
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, FieldChange{Path: path, Kind: FieldModified, Old: old, New: new})
+	}
+}
+
+func diffObjects(path string, old, new map[string]any, changes *[]FieldChange) {
+	keys := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		childPath := path + "/" + escapeJSONPointer(k)
+		oldV, inOld := old[k]
+		newV, inNew := new[k]
+		switch {
+		case !inOld:
+			*changes = append(*changes, FieldChange{Path: childPath, Kind: FieldAdded, New: newV})
+		case !inNew:
+			*changes = append(*changes, FieldChange{Path: childPath, Kind: FieldRemoved, Old: oldV})
+		default:
+			diffValues(childPath, oldV, newV, changes)
+		}
+	}
+}
+
+func diffArrays(path string, old, new []any, changes *[]FieldChange) {
+	for i := 0; i < max(len(old), len(new)); i++ {
+		childPath := path + "/" + strconv.Itoa(i)
+		switch {
+		case i >= len(old):
+			*changes = append(*changes, FieldChange{Path: childPath, Kind: FieldAdded, New: new[i]})
+		case i >= len(new):
+			*changes = append(*changes, FieldChange{Path: childPath, Kind: FieldRemoved, Old: old[i]})
+		default:
+			diffValues(childPath, old[i], new[i], changes)
+		}
+	}
+}
+
+// escapeJSONPointer escapes a reference token as defined by RFC 6901.
+func escapeJSONPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
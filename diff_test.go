@@ -0,0 +1,70 @@
+package streamingconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type diffConfig struct {
+	Name    string            `json:"name"`
+	Age     int               `json:"age"`
+	Friends []string          `json:"friends"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Nested  diffNested        `json:"nested"`
+}
+
+type diffNested struct {
+	Mode string `json:"mode"`
+}
+
+func (c *diffConfig) Update(new Config) error {
+	*c = *new.(*diffConfig)
+	return nil
+}
+
+func Test_diffVersions(t *testing.T) {
+	from := &Versioned[*diffConfig]{Config: &diffConfig{
+		Name:    "n1",
+		Age:     30,
+		Friends: []string{"a", "b"},
+		Labels:  map[string]string{"a/b": "1", "team": "x"},
+		Nested:  diffNested{Mode: "fast"},
+	}}
+	to := &Versioned[*diffConfig]{Config: &diffConfig{
+		Name:    "n1",
+		Age:     31,
+		Friends: []string{"a", "c", "d"},
+		Labels:  map[string]string{"team": "y", "zone": "eu"},
+		Nested:  diffNested{Mode: "safe"},
+	}}
+	changes, err := diffVersions(from, to)
+	require.NoError(t, err)
+	require.Equal(t, []FieldChange{
+		{Path: "/age", Kind: FieldModified, Old: float64(30), New: float64(31)},
+		{Path: "/friends/1", Kind: FieldModified, Old: "b", New: "c"},
+		{Path: "/friends/2", Kind: FieldAdded, New: "d"},
+		{Path: "/labels/a~1b", Kind: FieldRemoved, Old: "1"},
+		{Path: "/labels/team", Kind: FieldModified, Old: "x", New: "y"},
+		{Path: "/labels/zone", Kind: FieldAdded, New: "eu"},
+		{Path: "/nested/mode", Kind: FieldModified, Old: "fast", New: "safe"},
+	}, changes)
+
+	t.Run("removed object", func(t *testing.T) {
+		to := &Versioned[*diffConfig]{Config: &diffConfig{Name: "n1"}}
+		changes, err := diffVersions(&Versioned[*diffConfig]{Config: &diffConfig{
+			Name:   "n1",
+			Labels: map[string]string{"team": "x"},
+		}}, to)
+		require.NoError(t, err)
+		require.Equal(t, []FieldChange{
+			{Path: "/labels", Kind: FieldRemoved, Old: map[string]any{"team": "x"}},
+		}, changes)
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+		changes, err := diffVersions(from, from)
+		require.NoError(t, err)
+		require.Empty(t, changes)
+	})
+}
@@ -0,0 +1,215 @@
+package streamingconfig
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Cipher encrypts and decrypts the stored configurations.
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// WithEncryption encrypts the JSON representation of the configurations
+// before storing them in MongoDB, and decrypts them on read. The version,
+// creation time, author and metadata of the versions stay in plaintext, and
+// thus queryable. The versions stored before enabling the encryption remain
+// readable.
+func WithEncryption[T Config](c Cipher) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.cipher = c
+	}
+}
+
+// AESGCMCipher is a Cipher relying on AES in Galois/Counter Mode, with a
+// random nonce prepended to each ciphertext.
+type AESGCMCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCMCipher returns an AESGCMCipher for the input key, which must be
+// 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256.
+func NewAESGCMCipher(key []byte) (*AESGCMCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCMCipher{aead: aead}, nil
+}
+
+func (c *AESGCMCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c *AESGCMCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < c.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:c.aead.NonceSize()], ciphertext[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, sealed, nil)
+}
+
+// encryptedDocument is the persisted form of a version whose configuration is
+// encrypted.
+type encryptedDocument struct {
+	Version       uint64            `bson:"_id"`
+	UpdatedBy     string            `bson:"updated_by"`
+	CreatedAt     time.Time         `bson:"created_at"`
+	Reason        string            `bson:"reason,omitempty"`
+	Tags          []string          `bson:"tags,omitempty"`
+	Metadata      map[string]string `bson:"metadata,omitempty"`
+	AppConfig     bson.RawValue     `bson:"app_config"`
+	Discriminator bson.M            `bson:",inline"`
+}
+
+// document returns the persisted form of the version.
+func (s *WatchedRepo[T]) document(v *Versioned[T]) (any, error) {
+	doc, err := s.encryptedDocument(v)
+	if err != nil {
+		return nil, err
+	}
+	return s.withEnvironmentID(doc, v.Version)
+}
+
+func (s *WatchedRepo[T]) encryptedDocument(v *Versioned[T]) (any, error) {
+	if s.fieldCipher != nil {
+		var err error
+		if v, err = s.encryptFields(v); err != nil {
+			return nil, err
+		}
+	}
+	if s.cipher == nil {
+		return versionedDocument[T]{
+			Versioned:     *v,
+			Discriminator: s.documentFilter,
+		}, nil
+	}
+	b, err := json.Marshal(v.Config)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := s.cipher.Encrypt(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt config: %w", err)
+	}
+	_, data, err := bson.MarshalValue(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return encryptedDocument{
+		Version:       v.Version,
+		UpdatedBy:     v.UpdatedBy,
+		CreatedAt:     v.CreatedAt,
+		Reason:        v.Reason,
+		Tags:          v.Tags,
+		Metadata:      v.Metadata,
+		AppConfig:     bson.RawValue{Type: bsontype.Binary, Value: data},
+		Discriminator: s.documentFilter,
+	}, nil
+}
+
+// decodeVersion decodes a persisted version, decrypting its configuration if
+// needed.
+func (s *WatchedRepo[T]) decodeVersion(raw bson.Raw) (*Versioned[T], error) {
+	raw, err := s.withVersionID(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	v, err := s.decodeStoredVersion(raw)
+	if err != nil || s.fieldCipher == nil {
+		return v, err
+	}
+	if err := s.decryptFields(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *WatchedRepo[T]) decodeStoredVersion(raw bson.Raw) (*Versioned[T], error) {
+	if s.cipher != nil {
+		var doc encryptedDocument
+		if err := decodeDocument(raw, &doc); err != nil {
+			return nil, fmt.Errorf("failed to decode config: %w", err)
+		}
+		// versions stored before enabling the encryption are in plaintext.
+		if doc.AppConfig.Type == bsontype.Binary {
+			return s.decryptVersion(&doc)
+		}
+	}
+	var v Versioned[T]
+	if err := decodeDocument(raw, &v); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return &v, nil
+}
+
+func (s *WatchedRepo[T]) decryptVersion(doc *encryptedDocument) (*Versioned[T], error) {
+	_, ciphertext, ok := doc.AppConfig.BinaryOK()
+	if !ok {
+		return nil, errors.New("failed to decode config: invalid encrypted config")
+	}
+	plaintext, err := s.cipher.Decrypt(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt config: %w", err)
+	}
+	cfg, err := unmarshalNew[T](plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return &Versioned[T]{
+		Version:   doc.Version,
+		UpdatedBy: doc.UpdatedBy,
+		CreatedAt: doc.CreatedAt,
+		Reason:    doc.Reason,
+		Tags:      doc.Tags,
+		Metadata:  doc.Metadata,
+		Config:    cfg,
+	}, nil
+}
+
+// decodeDocument decodes the document with the options of the collection.
+func decodeDocument(raw bson.Raw, v any) error {
+	dec, err := bson.NewDecoder(bsonrw.NewBSONDocumentReader(raw))
+	if err != nil {
+		return err
+	}
+	dec.UseJSONStructTags()
+	return dec.Decode(v)
+}
+
+// encodeDocument encodes the document with the options of the collection.
+func encodeDocument(v any) (bson.Raw, error) {
+	buf := new(bytes.Buffer)
+	vw, err := bsonrw.NewBSONValueWriter(buf)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := bson.NewEncoder(vw)
+	if err != nil {
+		return nil, err
+	}
+	enc.UseJSONStructTags()
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
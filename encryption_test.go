@@ -0,0 +1,83 @@
+package streamingconfig
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func Test_AESGCMCipher(t *testing.T) {
+	c, err := NewAESGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	plaintext := []byte(`{"name":"secret"}`)
+	first, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+	second, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(first, []byte("secret")))
+	require.NotEqual(t, first, second, "nonces must be random")
+
+	decrypted, err := c.Decrypt(first)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	first[len(first)-1] ^= 1
+	_, err = c.Decrypt(first)
+	require.Error(t, err, "tampered ciphertexts must be rejected")
+	_, err = c.Decrypt([]byte("short"))
+	require.Error(t, err)
+
+	_, err = NewAESGCMCipher([]byte("bad key"))
+	require.Error(t, err)
+}
+
+func Test_decodeVersion(t *testing.T) {
+	c, err := NewAESGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	repo := &WatchedRepo[*schemaConfig]{cipher: c, documentFilter: bson.M{"type": "app"}}
+	v := &Versioned[*schemaConfig]{
+		Version:   2,
+		UpdatedBy: "u1",
+		Reason:    "r1",
+		Metadata:  map[string]string{"env": "prod"},
+		Config:    &schemaConfig{Name: "n1", Age: 30, Nested: schemaNested{Mode: "fast"}},
+	}
+
+	t.Run("encrypted", func(t *testing.T) {
+		doc, err := repo.document(v)
+		require.NoError(t, err)
+		raw, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		require.Equal(t, "app", bson.Raw(raw).Lookup("type").StringValue())
+		require.Equal(t, "u1", bson.Raw(raw).Lookup("updated_by").StringValue())
+		_, _, ok := bson.Raw(raw).Lookup("app_config").BinaryOK()
+		require.True(t, ok)
+
+		decoded, err := repo.decodeVersion(raw)
+		require.NoError(t, err)
+		require.Equal(t, v.Config, decoded.Config)
+		require.Equal(t, v.Metadata, decoded.Metadata)
+		require.Equal(t, v.Reason, decoded.Reason)
+		require.Equal(t, v.Version, decoded.Version)
+	})
+	t.Run("plaintext stored before enabling the encryption", func(t *testing.T) {
+		raw, err := bson.Marshal(versionedDocument[*schemaConfig]{Versioned: *v})
+		require.NoError(t, err)
+		decoded, err := repo.decodeVersion(raw)
+		require.NoError(t, err)
+		require.Equal(t, v.Config, decoded.Config)
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		doc, err := repo.document(v)
+		require.NoError(t, err)
+		raw, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		other, err := NewAESGCMCipher([]byte("fedcba9876543210"))
+		require.NoError(t, err)
+		_, err = (&WatchedRepo[*schemaConfig]{cipher: other}).decodeVersion(raw)
+		require.ErrorContains(t, err, "failed to decrypt config")
+	})
+}
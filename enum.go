@@ -0,0 +1,105 @@
+package streamingconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// enumTag is the struct tag restricting a field to a comma-separated list of
+// allowed values, e.g. `enum:"DEBUG,INFO,WARN,ERROR"`. Values are compared
+// against the JSON representation of the field, unquoted for strings, so that
+// types with a custom JSON encoding (such as slog.Level) are supported.
+const enumTag = "enum"
+
+// ErrInvalidEnumValue is returned when a field holds a value not listed in its
+// `enum` tag.
+var ErrInvalidEnumValue = errors.New("value not allowed")
+
+// validateEnums checks every field carrying an `enum` tag, nested structs
+// included, and returns an error per invalid field.
+func validateEnums(v any) error {
+	return errors.Join(validateEnumsValue(reflect.ValueOf(v), "")...)
+}
+
+func validateEnumsValue(v reflect.Value, path string) []error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		fieldPath := name
+		if field.Anonymous && name == "" {
+			fieldPath = path
+		} else if path != "" {
+			fieldPath = path + "." + name
+		}
+		if allowed, ok := field.Tag.Lookup(enumTag); ok {
+			if err := validateEnumValue(v.Field(i), fieldPath, strings.Split(allowed, ",")); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		errs = append(errs, validateEnumsValue(v.Field(i), fieldPath)...)
+	}
+	return errs
+}
+
+func validateEnumValue(v reflect.Value, path string, allowed []string) error {
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Errorf("field %s: %w", path, err)
+	}
+	value := string(b)
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		value = str
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("field %s: %w: %q (allowed values: %s)", path, ErrInvalidEnumValue, value, strings.Join(allowed, ", "))
+}
+
+// jsonFieldName returns the JSON name of the field following the
+// encoding/json conventions and false if the field is not serialized. Embedded
+// structs without a name in their tag return an empty name as their fields are
+// promoted.
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name != "" {
+		return name, true
+	}
+	if field.Anonymous {
+		t := field.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			return "", true
+		}
+	}
+	return field.Name, true
+}
@@ -0,0 +1,35 @@
+package streamingconfig
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type enumConfig struct {
+	LogLevel slog.Level `json:"logLevel" enum:"DEBUG,INFO,WARN,ERROR"`
+	Nested   enumNested `json:"nested"`
+}
+
+type enumNested struct {
+	Mode string `json:"mode" enum:"fast,safe"`
+}
+
+func Test_ValidateEnums(t *testing.T) {
+	t.Run("valid values", func(t *testing.T) {
+		require.NoError(t, validateEnums(&enumConfig{
+			LogLevel: slog.LevelWarn,
+			Nested:   enumNested{Mode: "safe"},
+		}))
+	})
+	t.Run("invalid values are all reported", func(t *testing.T) {
+		err := validateEnums(&enumConfig{
+			LogLevel: slog.LevelWarn + 1,
+			Nested:   enumNested{Mode: "slow"},
+		})
+		require.ErrorIs(t, err, ErrInvalidEnumValue)
+		require.ErrorContains(t, err, `field logLevel: value not allowed: "WARN+1"`)
+		require.ErrorContains(t, err, `field nested.mode: value not allowed: "slow"`)
+	})
+}
@@ -0,0 +1,121 @@
+package streamingconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const environmentField = "environment"
+
+// environmentID is the _id of the versions of a repository scoped to an
+// environment: the versions of each environment are numbered independently.
+type environmentID struct {
+	Environment string `bson:"environment"`
+	Version     uint64 `bson:"version"`
+}
+
+// WithEnvironment scopes the repository to an environment, e.g. "staging" or
+// "prod", so that the environments can share a collection while keeping
+// isolated configuration histories. Every version is stamped with an
+// `environment` field, the versions are numbered independently per
+// environment, and all reads and the watcher ignore the versions of the other
+// environments.
+//
+// The `_id` of the versions becomes `{environment: <env>, version: <n>}`: the
+// versions stored without environment are thus not visible. They can be
+// migrated by copying them into the new form, e.g. with mongosh:
+//
+//	db.config.aggregate([
+//	  {$match: {environment: {$exists: false}}},
+//	  {$set: {_id: {environment: "prod", version: "$_id"}, environment: "prod"}},
+//	  {$merge: {into: "config", whenMatched: "fail"}},
+//	])
+//	db.config.deleteMany({environment: {$exists: false}})
+func WithEnvironment[T Config](env string) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.environment = env
+	}
+}
+
+// scopeToEnvironment adds the environment, if any, to the document filter, so
+// that it is stamped on every version and restricts the reads and the
+// watcher.
+func (s *WatchedRepo[T]) scopeToEnvironment() {
+	if s.environment == "" {
+		return
+	}
+	filter := bson.M{environmentField: s.environment}
+	for k, v := range s.documentFilter {
+		filter[k] = v
+	}
+	s.documentFilter = filter
+}
+
+// versionField returns the field holding the version number.
+func (s *WatchedRepo[T]) versionField() string {
+	if s.environment == "" {
+		return "_id"
+	}
+	return "_id.version"
+}
+
+// versionOf returns the version number of the persisted version.
+func (s *WatchedRepo[T]) versionOf(raw bson.Raw) (uint64, error) {
+	id, err := raw.LookupErr(strings.Split(s.versionField(), ".")...)
+	if err != nil {
+		return 0, err
+	}
+	version, ok := id.AsInt64OK()
+	if !ok {
+		return 0, fmt.Errorf("invalid version type %s", id.Type)
+	}
+	return uint64(version), nil
+}
+
+// withEnvironmentID returns the persisted version with its _id in the form
+// of the environment.
+func (s *WatchedRepo[T]) withEnvironmentID(doc any, version uint64) (any, error) {
+	if s.environment == "" {
+		return doc, nil
+	}
+	raw, err := encodeDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	return replaceID(raw, environmentID{Environment: s.environment, Version: version})
+}
+
+// withVersionID returns the persisted version with its _id in the form of the
+// repositories without environment.
+func (s *WatchedRepo[T]) withVersionID(raw bson.Raw) (bson.Raw, error) {
+	if s.environment == "" {
+		return raw, nil
+	}
+	version, err := s.versionOf(raw)
+	if err != nil {
+		return nil, err
+	}
+	d, err := replaceID(raw, version)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(d)
+}
+
+// replaceID returns the document with its _id replaced.
+func replaceID(raw bson.Raw, id any) (bson.D, error) {
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	for i := range d {
+		if d[i].Key == "_id" {
+			d[i].Value = id
+			return d, nil
+		}
+	}
+	return nil, errors.New("document without _id")
+}
@@ -0,0 +1,37 @@
+package streamingconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func Test_WithEnvironment(t *testing.T) {
+	repo := &WatchedRepo[*schemaConfig]{documentFilter: bson.M{"type": "app"}}
+	WithEnvironment[*schemaConfig]("prod")(repo)
+	repo.scopeToEnvironment()
+	require.Equal(t, bson.M{"type": "app", "environment": "prod"}, repo.documentFilter)
+	require.Equal(t, "_id.version", repo.versionField())
+
+	v := &Versioned[*schemaConfig]{
+		Version:   4,
+		UpdatedBy: "u1",
+		Config:    &schemaConfig{Name: "n1"},
+	}
+	doc, err := repo.document(v)
+	require.NoError(t, err)
+	b, err := bson.Marshal(doc)
+	require.NoError(t, err)
+	raw := bson.Raw(b)
+	require.Equal(t, "prod", raw.Lookup("_id", "environment").StringValue())
+	require.Equal(t, "prod", raw.Lookup("environment").StringValue())
+	version, err := repo.versionOf(raw)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), version)
+
+	decoded, err := repo.decodeVersion(raw)
+	require.NoError(t, err)
+	require.Equal(t, v.Version, decoded.Version)
+	require.Equal(t, v.Config, decoded.Config)
+}
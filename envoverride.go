@@ -0,0 +1,124 @@
+package streamingconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrInvalidEnvOverride is returned when an environment variable set with
+	// WithEnvOverride cannot be assigned to its field, or makes the
+	// configuration invalid.
+	ErrInvalidEnvOverride = errors.New("invalid environment override")
+	// ErrEnvOverridePrefixRequired is returned by the constructors of the
+	// repositories when WithEnvOverride is set with an empty prefix.
+	ErrEnvOverridePrefixRequired = errors.New("environment override prefix must not be empty")
+)
+
+// WithEnvOverride overlays the environment variables named after the prefix
+// and the fields of the configuration on the configuration served locally, by
+// GetConfig, GetLatestVersion, the subscriptions and the update callbacks,
+// e.g. `PREFIX_AGE=40` for the `age` field, for local development or
+// emergency overrides without creating a version. The variables are named
+// after the upper-cased JSON names of the fields, the names of the nested
+// fields joined with underscores, e.g. `PREFIX_NESTED_COUNTER`. String fields
+// take the values as is, the other fields their JSON encoding, e.g.
+// `PREFIX_TAGS=["a","b"]`. The prefix must not be empty, for unrelated
+// variables, e.g. `PATH`, not to override the configuration.
+//
+// The overrides take precedence over both the stored values and the defaults,
+// and apply before the interpolation. The overridden configuration is
+// validated as by UpdateConfig: an invalid override makes Start fail, and the
+// watcher report the versions it cannot apply. The overrides are never
+// stored, nor sent: the versions returned by UpdateConfig and GetVersion, the
+// listings, the webhooks and the publishers keep the values as updated.
+// Fields omitted from the JSON encoding of the configuration, e.g. empty ones
+// tagged with `omitempty`, cannot be overridden.
+func WithEnvOverride[T Config](prefix string) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.envPrefix = prefix
+		repo.envOverride = true
+	}
+}
+
+// overrideFromEnv returns a copy of the configuration with the environment
+// overrides applied.
+func overrideFromEnv[T any](cfg T, prefix string) (T, error) {
+	var zero T
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return zero, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// numbers are kept as is, e.g. large integers are not turned into floats.
+	dec.UseNumber()
+	var root any
+	if err := dec.Decode(&root); err != nil {
+		return zero, err
+	}
+	obj, ok := root.(map[string]any)
+	if !ok {
+		return cfg, nil
+	}
+	if err := overrideObject(obj, prefix); err != nil {
+		return zero, err
+	}
+	if b, err = json.Marshal(obj); err != nil {
+		return zero, err
+	}
+	overridden, err := unmarshalNew[T](b)
+	if err != nil {
+		return zero, fmt.Errorf("%w: %w", ErrInvalidEnvOverride, err)
+	}
+	return overridden, nil
+}
+
+// overrideObject overrides the fields of the object, named after the prefix,
+// and recursively of its nested objects.
+func overrideObject(obj map[string]any, prefix string) error {
+	for key, value := range obj {
+		name := prefix + "_" + envName(key)
+		if nested, ok := value.(map[string]any); ok {
+			if err := overrideObject(nested, name); err != nil {
+				return err
+			}
+			continue
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if _, ok := value.(string); ok {
+			obj[key] = raw
+			continue
+		}
+		var override any
+		if err := json.Unmarshal([]byte(raw), &override); err != nil {
+			if value != nil {
+				return fmt.Errorf("%w: %s: %w", ErrInvalidEnvOverride, name, err)
+			}
+			// the type of the null fields is unknown: the value is taken as
+			// a string.
+			override = raw
+		}
+		obj[key] = override
+	}
+	return nil
+}
+
+// envName returns the name of the environment variable of the JSON field:
+// upper-cased, with its characters other than letters and digits replaced
+// with underscores.
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, key)
+}
@@ -0,0 +1,81 @@
+package streamingconfig
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WithEnvOverride(t *testing.T) {
+	s := &WatchedRepo[*schemaConfig]{}
+	WithEnvOverride[*schemaConfig]("APP")(s)
+	stored := &Versioned[*schemaConfig]{
+		Version: 2,
+		Config:  &schemaConfig{Name: "bobby", Age: 30, Nested: schemaNested{Mode: "fast"}},
+	}
+
+	t.Setenv("APP_AGE", "40")
+	t.Setenv("APP_NESTED_MODE", "safe")
+	t.Setenv("AGE", "50")
+	got, err := s.localVersion(stored)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), got.Version)
+	require.Equal(t, &schemaConfig{Name: "bobby", Age: 40, Nested: schemaNested{Mode: "safe"}}, got.Config)
+	// the stored version is left untouched.
+	require.Equal(t, &schemaConfig{Name: "bobby", Age: 30, Nested: schemaNested{Mode: "fast"}}, stored.Config)
+	// the versions exposed beyond the local getters are not overridden.
+	got, err = s.withDefaults(stored)
+	require.NoError(t, err)
+	require.Equal(t, stored.Config, got.Config)
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, value := range []string{"forty", `"40"`} {
+			t.Setenv("APP_AGE", value)
+			_, err := s.localVersion(stored)
+			require.ErrorIs(t, err, ErrInvalidEnvOverride)
+		}
+	})
+
+	t.Run("validated", func(t *testing.T) {
+		s := &WatchedRepo[*validatedConfig]{}
+		WithEnvOverride[*validatedConfig]("APP")(s)
+		t.Setenv("APP_AGE", "-1")
+		_, err := s.localVersion(&Versioned[*validatedConfig]{Version: 1, Config: &validatedConfig{Age: 1}})
+		require.ErrorIs(t, err, ErrInvalidEnvOverride)
+		require.ErrorContains(t, err, "age must not be negative")
+	})
+
+	t.Run("empty prefix", func(t *testing.T) {
+		_, err := NewInMemoryRepo[*schemaConfig](WithEnvOverride[*schemaConfig](""))
+		require.ErrorIs(t, err, ErrEnvOverridePrefixRequired)
+		_, err = NewWatchedRepo[*schemaConfig](Args{Logger: slog.Default()}, WithEnvOverride[*schemaConfig](""))
+		require.ErrorIs(t, err, ErrEnvOverridePrefixRequired)
+	})
+}
+
+func Test_WithEnvOverride_localOnly(t *testing.T) {
+	t.Setenv("APP_AGE", "40")
+	repo, err := NewInMemoryRepo[*schemaConfig](WithEnvOverride[*schemaConfig]("APP"))
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = repo.Start(ctx)
+	require.NoError(t, err)
+
+	updated, err := repo.UpdateConfig(ctx, UpdateConfigCmd[*schemaConfig]{Config: &schemaConfig{Name: "n1", Age: 30}})
+	require.NoError(t, err)
+	require.Equal(t, 30, updated.Config.Age)
+	cfg, err := repo.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, 40, cfg.Age)
+	v1, err := repo.GetVersion(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, 30, v1.Config.Age)
+}
+
+func Test_envName(t *testing.T) {
+	require.Equal(t, "LOGLEVEL", envName("logLevel"))
+	require.Equal(t, "BASE_URL", envName("base-url"))
+	require.Equal(t, "RETRIES2", envName("retries2"))
+}
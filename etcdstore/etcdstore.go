@@ -0,0 +1,241 @@
+// Package etcdstore provides an etcd-backed streamingconfig.Store, for
+// deployments already running etcd, e.g. on Kubernetes.
+//
+// It is a module of its own so that the applications not relying on etcd do
+// not depend on its client.
+package etcdstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	config "github.com/rbroggi/streamingconfig"
+)
+
+const (
+	defaultPrefix = "/streamingconfig/"
+	// retryInterval is the wait before resuming a watch after a failure.
+	retryInterval = time.Second
+	// rangeBatchSize is the number of versions Range reads at once.
+	rangeBatchSize = 100
+)
+
+// Args holds the dependencies of the Store.
+type Args struct {
+	Logger *slog.Logger
+	Client *clientv3.Client
+	// Prefix prefixes the keys used by the store, which defaults to
+	// "/streamingconfig/".
+	Prefix string
+}
+
+// Store persists each version as JSON under a key of its own, and watches the
+// keys to observe the new versions.
+type Store[T config.Config] struct {
+	lgr    *slog.Logger
+	client *clientv3.Client
+	prefix string
+}
+
+// New returns a Store to be set with streamingconfig.WithStore.
+func New[T config.Config](args Args) (*Store[T], error) {
+	if args.Client == nil {
+		return nil, errors.New("etcd client is required")
+	}
+	prefix := args.Prefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	return &Store[T]{
+		lgr:    args.Logger.With("struct", "etcdstore.Store"),
+		client: args.Client,
+		prefix: prefix + "versions/",
+	}, nil
+}
+
+// key returns the key of a version, zero-padded for the keys to sort as the
+// versions do.
+func (s *Store[T]) key(version uint64) string {
+	return fmt.Sprintf("%s%020d", s.prefix, version)
+}
+
+// Latest returns the version with the highest number, or
+// streamingconfig.ErrConfigurationNotFound if there is none.
+func (s *Store[T]) Latest(ctx context.Context) (*config.Versioned[T], error) {
+	latest, _, err := s.latest(ctx)
+	return latest, err
+}
+
+// latest also returns the revision of the store at the time of the read.
+func (s *Store[T]) latest(ctx context.Context) (*config.Versioned[T], int64, error) {
+	resp, err := s.client.Get(ctx, s.prefix,
+		clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend),
+		clientv3.WithLimit(1),
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get latest version: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, resp.Header.Revision, config.ErrConfigurationNotFound
+	}
+	v, err := decode[T](resp.Kvs[0].Value)
+	return v, resp.Header.Revision, err
+}
+
+// Insert stores a new version, or returns
+// streamingconfig.ErrConcurrentUpdate if its number is already taken.
+func (s *Store[T]) Insert(ctx context.Context, v *config.Versioned[T]) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode version %d: %w", v.Version, err)
+	}
+	key := s.key(v.Version)
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(raw))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("failed to insert version %d: %w", v.Version, err)
+	}
+	if !resp.Succeeded {
+		return config.ErrConcurrentUpdate
+	}
+	return nil
+}
+
+// Range hands the versions matching the query to fn one at a time, in
+// version order, reading them by batches of rangeBatchSize.
+func (s *Store[T]) Range(ctx context.Context, query config.ListVersionedConfigsQuery, fn func(v *config.Versioned[T]) error) error {
+	order := clientv3.SortAscend
+	if query.Descending {
+		order = clientv3.SortDescend
+	}
+	from, to := query.FromVersion, query.ToVersion
+	skip, handed := query.Skip, int64(0)
+	for from < to {
+		resp, err := s.client.Get(ctx, s.key(from),
+			clientv3.WithRange(s.key(to)),
+			clientv3.WithSort(clientv3.SortByKey, order),
+			clientv3.WithLimit(rangeBatchSize),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get versions: %w", err)
+		}
+		for _, kv := range resp.Kvs {
+			v, err := decode[T](kv.Value)
+			if err != nil {
+				return err
+			}
+			// the next batch starts past the version.
+			if query.Descending {
+				to = v.Version
+			} else {
+				from = v.Version + 1
+			}
+			if !v.Matches(query) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if query.Limit > 0 && handed == query.Limit {
+				return nil
+			}
+			handed++
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		if !resp.More {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Watch delivers the versions created after the call until the context is
+// done. When the watched revisions were compacted away, it resumes from the
+// latest version.
+func (s *Store[T]) Watch(ctx context.Context, onVersion func(v *config.Versioned[T]) error) (<-chan struct{}, error) {
+	_, rev, err := s.latest(ctx)
+	if err != nil && !errors.Is(err, config.ErrConfigurationNotFound) {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		next := rev + 1
+		for ctx.Err() == nil {
+			next = s.watch(ctx, next, onVersion)
+			if ctx.Err() != nil {
+				return
+			}
+			s.lgr.WarnContext(ctx, "watch interrupted, resuming from the latest version")
+			latest, latestRev, err := s.latest(ctx)
+			if err != nil && !errors.Is(err, config.ErrConfigurationNotFound) {
+				s.lgr.With("error", err).ErrorContext(ctx, "could not get latest version")
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryInterval):
+				}
+				continue
+			}
+			if latest != nil {
+				s.deliver(ctx, latest, onVersion)
+			}
+			next = latestRev + 1
+		}
+	}()
+	return done, nil
+}
+
+// watch delivers the versions from the input revision until the watch channel
+// is closed, and returns the revision to resume from.
+func (s *Store[T]) watch(ctx context.Context, rev int64, onVersion func(v *config.Versioned[T]) error) int64 {
+	wch := s.client.Watch(clientv3.WithRequireLeader(ctx), s.prefix,
+		clientv3.WithPrefix(),
+		clientv3.WithRev(rev),
+		clientv3.WithFilterDelete(),
+	)
+	for resp := range wch {
+		if err := resp.Err(); err != nil {
+			s.lgr.With("error", err).ErrorContext(ctx, "watch failed")
+			continue
+		}
+		for _, ev := range resp.Events {
+			rev = ev.Kv.ModRevision + 1
+			if !ev.IsCreate() {
+				continue
+			}
+			v, err := decode[T](ev.Kv.Value)
+			if err != nil {
+				s.lgr.With("error", err).ErrorContext(ctx, "error decoding watched version")
+				continue
+			}
+			s.deliver(ctx, v, onVersion)
+		}
+	}
+	return rev
+}
+
+func (s *Store[T]) deliver(ctx context.Context, v *config.Versioned[T], onVersion func(v *config.Versioned[T]) error) {
+	if err := onVersion(v); err != nil {
+		s.lgr.With("error", err, "version", v.Version).ErrorContext(ctx, "could not apply new version")
+	}
+}
+
+func decode[T config.Config](raw []byte) (*config.Versioned[T], error) {
+	var v config.Versioned[T]
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return &v, nil
+}
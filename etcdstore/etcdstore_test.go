@@ -0,0 +1,164 @@
+package etcdstore_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	config "github.com/rbroggi/streamingconfig"
+	"github.com/rbroggi/streamingconfig/etcdstore"
+)
+
+const etcdLocalAddr = "localhost:2379"
+
+type appConfig struct {
+	Name string `json:"name" default:"bobby"`
+	Age  int    `json:"age"`
+}
+
+func (a *appConfig) Update(new config.Config) error {
+	newCfg, ok := new.(*appConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	a.Name = newCfg.Name
+	a.Age = newCfg.Age
+	return nil
+}
+
+func newStore(t *testing.T) *etcdstore.Store[*appConfig] {
+	t.Helper()
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{etcdLocalAddr},
+		DialTimeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	// use test name as prefix to parallel tests.
+	prefix := "/" + t.Name() + "/"
+	ctx, cnl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cnl()
+	_, err = client.Delete(ctx, prefix, clientv3.WithPrefix())
+	require.NoError(t, err)
+	store, err := etcdstore.New[*appConfig](etcdstore.Args{
+		Logger: slog.Default(),
+		Client: client,
+		Prefix: prefix,
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func newRepo(t *testing.T, ctx context.Context, store *etcdstore.Store[*appConfig]) (*config.WatchedRepo[*appConfig], <-chan struct{}) {
+	t.Helper()
+	repo, err := config.NewWatchedRepo[*appConfig](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfig](store),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	return repo, done
+}
+
+func Test_Store(t *testing.T) {
+	store := newStore(t)
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	writer, writerDone := newRepo(t, ctx, store)
+	reader, readerDone := newRepo(t, ctx, store)
+
+	got, err := reader.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, &appConfig{Name: "bobby"}, got)
+
+	cV1, err := writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfig]{
+		By:     "u1",
+		Config: &appConfig{Name: "n1", Age: 1},
+	})
+	require.NoError(t, err)
+	cV2, err := writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfig]{
+		By:     "u2",
+		Config: &appConfig{Age: 2},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), cV2.Version)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		got, err := reader.GetConfig()
+		require.NoError(c, err)
+		assert.Equal(c, &appConfig{Name: "bobby", Age: 2}, got)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	v1, err := reader.GetVersion(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, cV1.Config, v1.Config)
+	_, err = reader.GetVersion(ctx, 3)
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+
+	page, err := reader.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+		FromVersion: 0,
+		ToVersion:   10,
+		Skip:        1,
+	})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, uint64(2), page[0].Version)
+
+	cnl()
+	for _, done := range []<-chan struct{}{writerDone, readerDone} {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("repository did not stop")
+		}
+	}
+}
+
+func Test_StoreConcurrentInsert(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	_, err := store.Latest(ctx)
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+	v := &config.Versioned[*appConfig]{Version: 1, Config: &appConfig{Name: "n1"}}
+	require.NoError(t, store.Insert(ctx, v))
+	require.ErrorIs(t, store.Insert(ctx, v), config.ErrConcurrentUpdate)
+	latest, err := store.Latest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, v.Config, latest.Config)
+}
+
+func Test_StoreRange(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	// more versions than a batch.
+	for version := uint64(1); version <= 250; version++ {
+		require.NoError(t, store.Insert(ctx, &config.Versioned[*appConfig]{Version: version, Config: &appConfig{Age: int(version)}}))
+	}
+
+	collect := func(query config.ListVersionedConfigsQuery) []uint64 {
+		var versions []uint64
+		require.NoError(t, store.Range(ctx, query, func(v *config.Versioned[*appConfig]) error {
+			versions = append(versions, v.Version)
+			return nil
+		}))
+		return versions
+	}
+	require.Len(t, collect(config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 1000}), 250)
+	require.Equal(t, []uint64{150, 151}, collect(config.ListVersionedConfigsQuery{FromVersion: 50, ToVersion: 1000, Skip: 100, Limit: 2}))
+	require.Equal(t, []uint64{148, 147}, collect(config.ListVersionedConfigsQuery{FromVersion: 50, ToVersion: 200, Skip: 51, Limit: 2, Descending: true}))
+
+	errStop := errors.New("stop")
+	var handed int
+	err := store.Range(ctx, config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 1000}, func(*config.Versioned[*appConfig]) error {
+		handed++
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 1, handed)
+}
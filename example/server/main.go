@@ -28,14 +28,10 @@ func main() {
 	defer cancelRunnables()
 	repo, done := initRepo(runnableCtx)
 	s := &server{repo: repo, lgr: slog.Default()}
-	mux := http.NewServeMux()
-	mux.HandleFunc("GET /configs/latest", s.latestConfigHandler)
-	mux.HandleFunc("PUT /configs/latest", s.putConfigHandler)
-	mux.HandleFunc("GET /configs", s.listConfigsHandler)
 	// Create a new server
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%s", port),
-		Handler: mux,
+		Handler: s.routes(),
 	}
 	// Start the server in a goroutine
 	go func() {
@@ -44,6 +40,7 @@ func main() {
 		}
 	}()
 	fmt.Printf("Server listening on port %s\n", port)
+	go reloadOnSIGHUP(runnableCtx, repo)
 	// until shutdown signal is sent
 	<-runnableCtx.Done()
 	// Graceful shutdown
@@ -66,7 +63,9 @@ func initRepo(ctx context.Context) (*config.WatchedRepo[*appcfg.Conf], <-chan st
 		config.Args{
 			Logger: lgr,
 			DB:     db,
-		})
+		},
+		config.WithActorFromContext[*appcfg.Conf](userFromContext),
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -77,6 +76,24 @@ func initRepo(ctx context.Context) (*config.WatchedRepo[*appcfg.Conf], <-chan st
 	return repo, done
 }
 
+// reloadOnSIGHUP re-reads the latest configuration on SIGHUP, e.g. when the
+// watcher drifted.
+func reloadOnSIGHUP(ctx context.Context, repo *config.WatchedRepo[*appcfg.Conf]) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := repo.ReloadLatest(ctx); err != nil {
+				slog.Default().With("error", err).ErrorContext(ctx, "reloading latest configuration")
+			}
+		}
+	}
+}
+
 func getDb() *mongo.Database {
 	ctx, cnl := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cnl()
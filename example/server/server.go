@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
 	config "github.com/rbroggi/streamingconfig"
 	appcfg "github.com/rbroggi/streamingconfig/example/config"
@@ -17,6 +20,44 @@ type server struct {
 	repo *config.WatchedRepo[*appcfg.Conf]
 }
 
+// userKey is the context key of the user updating the configuration.
+type userKey struct{}
+
+// requireUser rejects the requests without the user-id header, and otherwise
+// sets the user in their context, where the repository reads the author of
+// the updates from (see userFromContext).
+func requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get("user-id")
+		if userID == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userKey{}, userID)))
+	}
+}
+
+// userFromContext returns the user set by requireUser.
+func userFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userKey{}).(string)
+	return userID
+}
+
+// routes registers the handlers of the server.
+func (s *server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /configs/latest", s.latestConfigHandler)
+	mux.HandleFunc("PUT /configs/latest", requireUser(s.putConfigHandler))
+	mux.HandleFunc("PATCH /configs/latest", requireUser(s.patchConfigHandler))
+	mux.HandleFunc("GET /configs", s.listConfigsHandler)
+	mux.HandleFunc("GET /configs/export", s.exportConfigsHandler)
+	mux.HandleFunc("GET /configs/{version}/download", s.downloadConfigHandler)
+	mux.HandleFunc("GET /configs/describe", s.describeConfigHandler)
+	mux.HandleFunc("GET /configs/diff", s.diffConfigsHandler)
+	mux.HandleFunc("GET /healthz", s.healthHandler)
+	return mux
+}
+
 // latestConfigHandler returns the latest configuration
 func (s *server) latestConfigHandler(w http.ResponseWriter, r *http.Request) {
 	latestVersion, err := s.repo.GetLatestVersion()
@@ -25,22 +66,11 @@ func (s *server) latestConfigHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-
-	if err := json.NewEncoder(w).Encode(latestVersion); err != nil {
-		s.lgr.With("error", err).ErrorContext(r.Context(), "encoding response")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	s.writeConfig(w, r, latestVersion)
 }
 
 // putConfigHandler returns a specific config version
 func (s *server) putConfigHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.Header.Get("user-id")
-	if userID == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
 	// decode input config
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -52,7 +82,7 @@ func (s *server) putConfigHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	cfg := new(appcfg.Conf)
-	err = json.Unmarshal(body, cfg)
+	err = s.codecOf(r.Header.Get("Content-Type")).Unmarshal(body, cfg)
 	if err != nil {
 		s.lgr.With("error", err).ErrorContext(r.Context(), "unmarshalling request into configuration")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -61,8 +91,8 @@ func (s *server) putConfigHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	updated, err := s.repo.UpdateConfig(r.Context(), config.UpdateConfigCmd[*appcfg.Conf]{
-		By:     userID,
 		Config: cfg,
+		Reason: r.Header.Get("reason"),
 	})
 	if err != nil {
 		s.lgr.With("error", err).ErrorContext(r.Context(), "updating configuration")
@@ -70,6 +100,69 @@ func (s *server) putConfigHandler(w http.ResponseWriter, r *http.Request) {
 		// Handle JSON parsing error
 		return
 	}
+	s.writeConfig(w, r, updated)
+}
+
+// codecOf returns the codec of the media type: YAML for application/yaml,
+// the codec of the repository otherwise.
+func (s *server) codecOf(mediaType string) config.Codec {
+	if strings.Contains(mediaType, "yaml") {
+		return config.YAMLCodec{}
+	}
+	return s.repo.Codec()
+}
+
+// writeConfig writes the version, in YAML if accepted by the client.
+func (s *server) writeConfig(w http.ResponseWriter, r *http.Request, v *config.Versioned[*appcfg.Conf]) {
+	c := s.codecOf(r.Header.Get("Accept"))
+	b, err := c.Marshal(v)
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "encoding response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", c.ContentType())
+	if _, err := w.Write(b); err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "writing response")
+	}
+}
+
+// patchConfigHandler applies a JSON Merge Patch, or a JSON Patch with the
+// application/json-patch+json content type, onto the latest config
+func (s *server) patchConfigHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "reading body payload")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var updated *config.Versioned[*appcfg.Conf]
+	if r.Header.Get("Content-Type") == "application/json-patch+json" {
+		updated, err = s.repo.JSONPatchConfig(r.Context(), "", body)
+	} else {
+		updated, err = s.repo.PatchConfig(r.Context(), config.PatchCmd{
+			MergePatch: body,
+		})
+	}
+	if errors.Is(err, config.ErrInvalidPatch) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, config.ErrPatchOperationFailed) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, config.ErrVersionMismatch) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "patching configuration")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(updated); err != nil {
 		s.lgr.With("error", err).ErrorContext(r.Context(), "encoding response")
@@ -80,40 +173,167 @@ func (s *server) putConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 // listConfigsHandler returns configs between versions (fromVersion and toVersion)
 func (s *server) listConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	query, ok := s.parseVersionRange(w, r)
+	if !ok {
+		return
+	}
+	versions, err := s.repo.ListVersionedConfigs(r.Context(), query)
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "listing versions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "encoding response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// exportConfigsHandler streams configs between versions (fromVersion and
+// toVersion) as newline-delimited JSON, one version per line.
+func (s *server) exportConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	query, ok := s.parseVersionRange(w, r)
+	if !ok {
+		return
+	}
+	it, err := s.repo.IterVersions(r.Context(), query)
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "iterating versions")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer it.Close(r.Context())
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for it.Next(r.Context()) {
+		// headers are already sent at this point: errors can only be logged.
+		if err := enc.Encode(it.Version()); err != nil {
+			s.lgr.With("error", err).ErrorContext(r.Context(), "encoding version")
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if err := it.Err(); err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "iterating versions")
+	}
+}
+
+// downloadConfigHandler returns a specific config version as a JSON file
+// attachment.
+func (s *server) downloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.ParseUint(r.PathValue("version"), 0, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "version must be a non-negative integer")
+		return
+	}
+	versioned, err := s.repo.GetVersion(r.Context(), version)
+	if errors.Is(err, config.ErrConfigurationNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "getting version")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=config-v%d.json", version))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(versioned); err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "encoding response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseVersionRange parses the fromVersion and toVersion query parameters, and
+// the optional updatedBy one. It writes a bad request response and returns
+// false if they are invalid.
+func (s *server) parseVersionRange(w http.ResponseWriter, r *http.Request) (config.ListVersionedConfigsQuery, bool) {
 	fromVersionStr := r.URL.Query().Get("fromVersion")
 	toVersionStr := r.URL.Query().Get("toVersion")
 	if fromVersionStr == "" || toVersionStr == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "Missing fromVersion or toVersion parameter")
-		return
+		return config.ListVersionedConfigsQuery{}, false
 	}
-	fromVersion, err := strconv.ParseUint(fromVersionStr, 0, 32)
+	fromVersion, err := strconv.ParseUint(fromVersionStr, 0, 64)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "fromVersion must be a non-negative integer")
 		s.lgr.With("error", err).ErrorContext(r.Context(), fmt.Sprintf("parsing from-version string %s", fromVersionStr))
-		return
+		return config.ListVersionedConfigsQuery{}, false
 	}
-	toVersion, err := strconv.ParseUint(toVersionStr, 0, 32)
+	toVersion, err := strconv.ParseUint(toVersionStr, 0, 64)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "toVersion must be a non-negative integer")
 		s.lgr.With("error", err).ErrorContext(r.Context(), fmt.Sprintf("parsing to-version string %s", toVersionStr))
+		return config.ListVersionedConfigsQuery{}, false
+	}
+	return config.ListVersionedConfigsQuery{
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		UpdatedBy:   r.URL.Query().Get("updatedBy"),
+	}, true
+}
+
+// diffConfigsHandler returns the changed fields between two versions
+// (fromVersion and toVersion)
+func (s *server) diffConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	query, ok := s.parseVersionRange(w, r)
+	if !ok {
+		return
+	}
+	changes, err := s.repo.Diff(r.Context(), query.FromVersion, query.ToVersion)
+	if errors.Is(err, config.ErrConfigurationNotFound) {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	versions, err := s.repo.ListVersionedConfigs(r.Context(), config.ListVersionedConfigsQuery{
-		FromVersion: uint32(fromVersion),
-		ToVersion:   uint32(toVersion),
-	})
 	if err != nil {
-		s.lgr.With("error", err).ErrorContext(r.Context(), "listing versions")
+		s.lgr.With("error", err).ErrorContext(r.Context(), "diffing versions")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(versions); err != nil {
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
 		s.lgr.With("error", err).ErrorContext(r.Context(), "encoding response")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
+
+// describeConfigHandler returns the schema, the defaults and the current
+// version of the configuration.
+func (s *server) describeConfigHandler(w http.ResponseWriter, r *http.Request) {
+	description, err := s.repo.Describe()
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "describing configuration")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(description); err != nil {
+		s.lgr.With("error", err).ErrorContext(r.Context(), "encoding response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
+
+// healthHandler reports whether the database is reachable and the watcher
+// live, for readiness and liveness probes.
+func (s *server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.repo.HealthCheck(r.Context()); err != nil {
+		s.lgr.With("error", err).WarnContext(r.Context(), "health check failed")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
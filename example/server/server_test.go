@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/rbroggi/streamingconfig"
+	appcfg "github.com/rbroggi/streamingconfig/example/config"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	ctx, cnl := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cnl)
+	opts := options.Client()
+	opts.ApplyURI("mongodb://localhost:27017/?connect=direct")
+	client, err := mongo.Connect(ctx, opts)
+	require.NoError(t, err)
+	require.NoError(t, client.Ping(ctx, nil))
+	db := client.Database(strings.Replace(t.Name(), "/", "-", -1))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, db.Drop(ctx))
+	})
+
+	repo, err := config.NewWatchedRepo[*appcfg.Conf](
+		config.Args{
+			Logger: slog.Default(),
+			DB:     db,
+		},
+		config.WithActorFromContext[*appcfg.Conf](userFromContext),
+	)
+	require.NoError(t, err)
+	runCtx, stop := context.WithCancel(context.Background())
+	done, err := repo.Start(runCtx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		stop()
+		<-done
+	})
+	return &server{repo: repo, lgr: slog.Default()}
+}
+
+func Test_ExportConfigsHandler(t *testing.T) {
+	s := newTestServer(t)
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := s.repo.UpdateConfig(context.Background(), config.UpdateConfigCmd[*appcfg.Conf]{
+			By:     "u1",
+			Config: &appcfg.Conf{Name: name},
+		})
+		require.NoError(t, err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/configs/export?fromVersion=1&toVersion=4", nil)
+	s.exportConfigsHandler(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	scanner := bufio.NewScanner(rec.Body)
+	var versions []*config.Versioned[*appcfg.Conf]
+	for scanner.Scan() {
+		var v config.Versioned[*appcfg.Conf]
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &v))
+		versions = append(versions, &v)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, versions, 3)
+	for i, name := range []string{"a", "b", "c"} {
+		require.Equal(t, uint64(i+1), versions[i].Version)
+		require.Equal(t, name, versions[i].Config.Name)
+	}
+}
+
+func Test_DownloadConfigHandler(t *testing.T) {
+	s := newTestServer(t)
+	created, err := s.repo.UpdateConfig(context.Background(), config.UpdateConfigCmd[*appcfg.Conf]{
+		By:     "u1",
+		Config: &appcfg.Conf{Name: "a", Age: 30},
+	})
+	require.NoError(t, err)
+
+	t.Run("existing version", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/configs/1/download", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "attachment; filename=config-v1.json", rec.Header().Get("Content-Disposition"))
+		var got config.Versioned[*appcfg.Conf]
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		require.Equal(t, created.Version, got.Version)
+		require.Equal(t, created.UpdatedBy, got.UpdatedBy)
+		require.Equal(t, created.Config, got.Config)
+		// the stored timestamp has millisecond precision.
+		require.WithinDuration(t, created.CreatedAt, got.CreatedAt, time.Millisecond)
+	})
+
+	t.Run("missing version", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/configs/2/download", nil))
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func Test_PatchConfigHandler(t *testing.T) {
+	s := newTestServer(t)
+	_, err := s.repo.UpdateConfig(context.Background(), config.UpdateConfigCmd[*appcfg.Conf]{
+		By:     "u1",
+		Config: &appcfg.Conf{Name: "a", Age: 30},
+	})
+	require.NoError(t, err)
+
+	t.Run("single field", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPatch, "/configs/latest", strings.NewReader(`{"age":31}`))
+		req.Header.Set("user-id", "u2")
+		s.routes().ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		var got config.Versioned[*appcfg.Conf]
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		require.Equal(t, uint64(2), got.Version)
+		require.Equal(t, "u2", got.UpdatedBy)
+		require.Equal(t, "a", got.Config.Name)
+		require.Equal(t, 31, got.Config.Age)
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPatch, "/configs/latest", strings.NewReader(
+			`[{"op":"test","path":"/name","value":"b"},{"op":"replace","path":"/age","value":32}]`))
+		req.Header.Set("user-id", "u2")
+		req.Header.Set("Content-Type", "application/json-patch+json")
+		s.routes().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("invalid patch", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPatch, "/configs/latest", strings.NewReader(`{"age":"old"}`))
+		req.Header.Set("user-id", "u2")
+		s.routes().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func Test_PutConfigHandler_yaml(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/configs/latest", strings.NewReader("name: a\nage: 30\n"))
+	req.Header.Set("user-id", "u1")
+	req.Header.Set("Content-Type", "application/yaml")
+	req.Header.Set("Accept", "application/yaml")
+	s.routes().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/yaml", rec.Header().Get("Content-Type"))
+	var got config.Versioned[*appcfg.Conf]
+	require.NoError(t, config.YAMLCodec{}.Unmarshal(rec.Body.Bytes(), &got))
+	require.Equal(t, uint64(1), got.Version)
+	require.Equal(t, "a", got.Config.Name)
+	require.Equal(t, 30, got.Config.Age)
+	// the defaults apply to the fields missing from the YAML body
+	require.Equal(t, []string{"mark", "tom", "jack"}, got.Config.Friends)
+}
+
+func Test_DiffConfigsHandler(t *testing.T) {
+	s := newTestServer(t)
+	for _, age := range []int{30, 31} {
+		_, err := s.repo.UpdateConfig(context.Background(), config.UpdateConfigCmd[*appcfg.Conf]{
+			By:     "u1",
+			Config: &appcfg.Conf{Name: "a", Age: age},
+		})
+		require.NoError(t, err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/configs/diff?fromVersion=1&toVersion=2", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `[{"path":"/age","kind":"modified","old":30,"new":31}]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/configs/diff?fromVersion=1&toVersion=3", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func Test_DescribeConfigHandler(t *testing.T) {
+	s := newTestServer(t)
+	_, err := s.repo.UpdateConfig(context.Background(), config.UpdateConfigCmd[*appcfg.Conf]{
+		By:     "u1",
+		Config: &appcfg.Conf{Name: "a"},
+	})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/configs/describe", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got struct {
+		Schema struct {
+			Properties map[string]map[string]any `json:"properties"`
+		} `json:"schema"`
+		Defaults appcfg.Conf `json:"defaults"`
+		Version  uint64      `json:"version"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.Equal(t, uint64(1), got.Version)
+	require.Equal(t, appcfg.Conf{
+		LogLevel: slog.LevelDebug,
+		Name:     "john",
+		Friends:  []string{"mark", "tom", "jack"},
+	}, got.Defaults)
+	require.ElementsMatch(t, []string{"logLevel", "name", "age", "friends"}, keys(got.Schema.Properties))
+	require.Equal(t, []any{"DEBUG", "INFO", "WARN", "ERROR"}, got.Schema.Properties["logLevel"]["enum"])
+	require.Equal(t, "integer", got.Schema.Properties["age"]["type"])
+}
+
+func keys[V any](m map[string]V) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
+
+func Test_HealthHandler(t *testing.T) {
+	s := newTestServer(t)
+	require.NoError(t, s.repo.WaitReady(context.Background()))
+
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,86 @@
+package streamingconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownField is returned by GetField and SetField when the path does not
+// lead to a field of the JSON representation of the configuration.
+var ErrUnknownField = errors.New("unknown field")
+
+// GetField returns the value at the dotted path, e.g. "nested.counter", of the
+// JSON representation of the latest configuration with defaults applied, as
+// encoding/json decodes it into an any, e.g. for generic admin tooling not
+// knowing the configuration type. The elements of the arrays are addressed by
+// their index, e.g. "list.0". The fields omitted from the JSON representation,
+// e.g. the empty "omitempty" ones, are unknown.
+func (s *WatchedRepo[T]) GetField(path string) (any, error) {
+	latest, err := s.GetLatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	return configField(latest.Config, path, true)
+}
+
+// SetField creates a new version where the field at the dotted path holds the
+// value, through the JSON Merge Patch of PatchConfig: a nil value removes the
+// field, which then holds its zero value and thus its default, if any. The
+// path must lead to a field of the latest configuration as GetField does, and
+// only through objects: the elements of the arrays cannot be set.
+func (s *WatchedRepo[T]) SetField(ctx context.Context, by, path string, value any) (*Versioned[T], error) {
+	latest, err := s.GetLatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := configField(latest.Config, path, false); err != nil {
+		return nil, err
+	}
+	patch := value
+	keys := strings.Split(path, ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		patch = map[string]any{keys[i]: patch}
+	}
+	b, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	return s.PatchConfig(ctx, PatchCmd{By: by, MergePatch: b})
+}
+
+// configField returns the value at the dotted path of the JSON representation
+// of the configuration, through the elements of the arrays if indexArrays is
+// set.
+func configField[T Config](cfg T, path string, indexArrays bool) (any, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			child, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownField, path)
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(key)
+			if !indexArrays || err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownField, path)
+			}
+			v = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, path)
+		}
+	}
+	return v, nil
+}
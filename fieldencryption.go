@@ -0,0 +1,154 @@
+package streamingconfig
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	encryptTag = "encrypt"
+	// encryptedFieldPrefix tells the encrypted values apart from the ones stored
+	// before enabling the encryption.
+	encryptedFieldPrefix = "enc:"
+)
+
+// ErrInvalidEncryptTag is returned when the `encrypt` tag is set on a field
+// that is not a string.
+var ErrInvalidEncryptTag = errors.New("encrypt tag on a non-string field")
+
+// WithFieldEncryption encrypts the string fields of the configuration tagged
+// with `encrypt:"true"`, including the ones of nested structs, before storing
+// them in MongoDB, and decrypts them on read. The other fields stay readable
+// and queryable. Encrypted fields are stored as base64 strings prefixed with
+// "enc:"; the values stored before enabling the encryption remain readable.
+// Tagging a field that is not a string makes the repository constructor fail
+// with ErrInvalidEncryptTag.
+func WithFieldEncryption[T Config](c Cipher) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.fieldCipher = c
+	}
+}
+
+// checkEncryptTags returns an error if a field of the type, or of its nested
+// types, has the `encrypt` tag without being a string.
+func checkEncryptTags(t reflect.Type, visited map[reflect.Type]bool) error {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return checkEncryptTags(t.Elem(), visited)
+	case reflect.Struct:
+		if visited[t] {
+			return nil
+		}
+		visited[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Tag.Get(encryptTag) == "true" && field.Type.Kind() != reflect.String {
+				return fmt.Errorf("%w: %s.%s", ErrInvalidEncryptTag, t.Name(), field.Name)
+			}
+			if err := checkEncryptTags(field.Type, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// transformFields replaces in place the values of the string fields tagged
+// with `encrypt:"true"` with the result of fn.
+func transformFields(v reflect.Value, fn func(string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return transformFields(v.Elem(), fn)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := transformFields(v.Index(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// map values are not addressable: they are transformed on a copy.
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			if err := transformFields(value, fn); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), value)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			if v.Type().Field(i).Tag.Get(encryptTag) == "true" && field.Kind() == reflect.String {
+				transformed, err := fn(field.String())
+				if err != nil {
+					return fmt.Errorf("field %s: %w", v.Type().Field(i).Name, err)
+				}
+				field.SetString(transformed)
+				continue
+			}
+			if err := transformFields(field, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *WatchedRepo[T]) encryptField(plaintext string) (string, error) {
+	ciphertext, err := s.fieldCipher.Encrypt([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return encryptedFieldPrefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func (s *WatchedRepo[T]) decryptField(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, encryptedFieldPrefix)
+	if !ok {
+		return value, nil
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := s.fieldCipher.Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// encryptFields returns a copy of the version with its tagged fields
+// encrypted.
+func (s *WatchedRepo[T]) encryptFields(v *Versioned[T]) (*Versioned[T], error) {
+	cfg, err := deepCopy(v.Config)
+	if err != nil {
+		return nil, err
+	}
+	// the fields of configurations of value types are only settable through a
+	// pointer.
+	if err := transformFields(reflect.ValueOf(&cfg).Elem(), s.encryptField); err != nil {
+		return nil, fmt.Errorf("failed to encrypt config: %w", err)
+	}
+	encrypted := *v
+	encrypted.Config = cfg
+	return &encrypted, nil
+}
+
+// decryptFields decrypts in place the tagged fields of the version.
+func (s *WatchedRepo[T]) decryptFields(v *Versioned[T]) error {
+	if err := transformFields(reflect.ValueOf(&v.Config).Elem(), s.decryptField); err != nil {
+		return fmt.Errorf("failed to decrypt config: %w", err)
+	}
+	return nil
+}
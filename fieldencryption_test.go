@@ -0,0 +1,123 @@
+package streamingconfig
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type secretConfig struct {
+	Name     string                  `json:"name"`
+	Password string                  `json:"password" encrypt:"true"`
+	Db       secretDB                `json:"db"`
+	Replicas []secretDB              `json:"replicas"`
+	Tenants  map[string]secretTenant `json:"tenants"`
+	Backup   *secretDB               `json:"backup"`
+}
+
+type secretDB struct {
+	Host  string `json:"host"`
+	Token string `json:"token" encrypt:"true"`
+}
+
+type secretTenant struct {
+	Key string `json:"key" encrypt:"true"`
+}
+
+func (c *secretConfig) Update(new Config) error {
+	newCfg, ok := new.(*secretConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	*c = *newCfg
+	return nil
+}
+
+func Test_WithFieldEncryption(t *testing.T) {
+	c, err := NewAESGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	repo := &WatchedRepo[*secretConfig]{fieldCipher: c}
+	v := &Versioned[*secretConfig]{
+		Version:   1,
+		UpdatedBy: "u1",
+		Config: &secretConfig{
+			Name:     "app",
+			Password: "p4ss",
+			Db:       secretDB{Host: "db", Token: "t1"},
+			Replicas: []secretDB{{Host: "r1", Token: "t2"}},
+			Tenants:  map[string]secretTenant{"acme": {Key: "k1"}},
+			Backup:   &secretDB{Host: "b1", Token: "t3"},
+		},
+	}
+
+	doc, err := repo.document(v)
+	require.NoError(t, err)
+	b, err := bson.Marshal(doc)
+	require.NoError(t, err)
+	raw := bson.Raw(b)
+
+	t.Run("tagged fields are encrypted", func(t *testing.T) {
+		for _, path := range [][]string{
+			{"app_config", "password"},
+			{"app_config", "db", "token"},
+			{"app_config", "replicas", "0", "token"},
+			{"app_config", "tenants", "acme", "key"},
+			{"app_config", "backup", "token"},
+		} {
+			stored := raw.Lookup(path...).StringValue()
+			require.True(t, strings.HasPrefix(stored, encryptedFieldPrefix), strings.Join(path, "."))
+		}
+	})
+	t.Run("other fields are in plaintext", func(t *testing.T) {
+		require.Equal(t, "app", raw.Lookup("app_config", "name").StringValue())
+		require.Equal(t, "db", raw.Lookup("app_config", "db", "host").StringValue())
+		require.Equal(t, "r1", raw.Lookup("app_config", "replicas", "0", "host").StringValue())
+		require.Equal(t, "b1", raw.Lookup("app_config", "backup", "host").StringValue())
+	})
+	t.Run("the input version is left untouched", func(t *testing.T) {
+		require.Equal(t, "p4ss", v.Config.Password)
+		require.Equal(t, "k1", v.Config.Tenants["acme"].Key)
+	})
+	t.Run("decoding decrypts", func(t *testing.T) {
+		decoded, err := repo.decodeVersion(raw)
+		require.NoError(t, err)
+		require.Equal(t, v.Config, decoded.Config)
+	})
+	t.Run("plaintext stored before enabling the encryption", func(t *testing.T) {
+		b, err := bson.Marshal(versionedDocument[*secretConfig]{Versioned: *v})
+		require.NoError(t, err)
+		decoded, err := repo.decodeVersion(b)
+		require.NoError(t, err)
+		require.Equal(t, v.Config, decoded.Config)
+	})
+	t.Run("combined with the whole config encryption", func(t *testing.T) {
+		both := &WatchedRepo[*secretConfig]{fieldCipher: c, cipher: c}
+		doc, err := both.document(v)
+		require.NoError(t, err)
+		b, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		decoded, err := both.decodeVersion(b)
+		require.NoError(t, err)
+		require.Equal(t, v.Config, decoded.Config)
+	})
+}
+
+func Test_checkEncryptTags(t *testing.T) {
+	type invalid struct {
+		Nested struct {
+			Port int `encrypt:"true"`
+		}
+	}
+	require.NoError(t, checkEncryptTags(reflectTypeOf[*secretConfig](), map[reflect.Type]bool{}))
+	err := checkEncryptTags(reflectTypeOf[*invalid](), map[reflect.Type]bool{})
+	require.ErrorIs(t, err, ErrInvalidEncryptTag)
+	require.ErrorContains(t, err, "Port")
+}
+
+func reflectTypeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
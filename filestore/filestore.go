@@ -0,0 +1,291 @@
+// Package filestore provides a streamingconfig.Store persisting the versions
+// in a local file, for CLIs and single-node deployments with no database.
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	config "github.com/rbroggi/streamingconfig"
+)
+
+// Args holds the dependencies of the Store.
+type Args struct {
+	Logger *slog.Logger
+	// Path is the file holding the versions, which is created upon the first
+	// update. Its directory must exist.
+	Path string
+}
+
+// Store appends each version as a JSON line to an append-only file, and
+// watches the file to observe the new versions, including the ones appended
+// by other processes.
+//
+// Concurrent updates are detected within a process only: the file must not
+// be updated by several processes at the same time.
+type Store[T config.Config] struct {
+	lgr  *slog.Logger
+	path string
+	// mu serializes the writers of the process.
+	mu sync.Mutex
+}
+
+// New returns a Store to be set with streamingconfig.WithStore.
+func New[T config.Config](args Args) (*Store[T], error) {
+	if args.Path == "" {
+		return nil, errors.New("file path is required")
+	}
+	return &Store[T]{
+		lgr:  args.Logger.With("struct", "filestore.Store"),
+		path: args.Path,
+	}, nil
+}
+
+// Latest returns the version of the last line, or
+// streamingconfig.ErrConfigurationNotFound if there is none.
+func (s *Store[T]) Latest(context.Context) (*config.Versioned[T], error) {
+	var latest *config.Versioned[T]
+	err := s.scan(func(v *config.Versioned[T]) bool {
+		latest = v
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, config.ErrConfigurationNotFound
+	}
+	return latest, nil
+}
+
+// Insert appends a new version, or returns
+// streamingconfig.ErrConcurrentUpdate if its number is already taken.
+func (s *Store[T]) Insert(ctx context.Context, v *config.Versioned[T]) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode version %d: %w", v.Version, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest, err := s.Latest(ctx)
+	if err != nil && !errors.Is(err, config.ErrConfigurationNotFound) {
+		return err
+	}
+	if latest != nil && latest.Version >= v.Version {
+		return config.ErrConcurrentUpdate
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		return fmt.Errorf("failed to insert version %d: %w", v.Version, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to insert version %d: %w", v.Version, err)
+	}
+	return nil
+}
+
+// Range hands the versions matching the query to fn one at a time, in
+// version order. The descending ranges locate the lines of the matching
+// versions first, and then read them backwards, one at a time.
+func (s *Store[T]) Range(_ context.Context, query config.ListVersionedConfigsQuery, fn func(v *config.Versioned[T]) error) error {
+	if query.Descending {
+		return s.rangeDescending(query, fn)
+	}
+	skip, handed := query.Skip, int64(0)
+	var fnErr error
+	err := s.scan(func(v *config.Versioned[T]) bool {
+		if !v.Matches(query) {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		if query.Limit > 0 && handed == query.Limit {
+			return false
+		}
+		handed++
+		fnErr = fn(v)
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// rangeDescending is Range for the descending ranges.
+func (s *Store[T]) rangeDescending(query config.ListVersionedConfigsQuery, fn func(v *config.Versioned[T]) error) error {
+	var lines []line
+	err := s.scanLines(func(v *config.Versioned[T], l line) bool {
+		if !v.Matches(query) {
+			return true
+		}
+		lines = append(lines, l)
+		if query.Limit > 0 && int64(len(lines)) > query.Skip+query.Limit {
+			// only the last ones can be handed.
+			lines = lines[1:]
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	lines = lines[:max(0, int64(len(lines))-query.Skip)]
+	if len(lines) == 0 {
+		return nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	defer f.Close()
+	for i := len(lines) - 1; i >= 0; i-- {
+		raw := make([]byte, lines[i].n)
+		if _, err := f.ReadAt(raw, lines[i].off); err != nil {
+			return fmt.Errorf("failed to read %s: %w", s.path, err)
+		}
+		var v config.Versioned[T]
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("failed to decode config: %w", err)
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch delivers the versions appended after the call until the context is
+// done.
+func (s *Store[T]) Watch(ctx context.Context, onVersion func(v *config.Versioned[T]) error) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error watching %s: %w", s.path, err)
+	}
+	// the directory is watched as the file may not exist yet, or be
+	// replaced by editors.
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("error watching %s: %w", s.path, err)
+	}
+	var delivered uint64
+	latest, err := s.Latest(ctx)
+	if err != nil && !errors.Is(err, config.ErrConfigurationNotFound) {
+		_ = watcher.Close()
+		return nil, err
+	}
+	if latest != nil {
+		delivered = latest.Version
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				s.lgr.With("error", err).ErrorContext(ctx, "watch failed")
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != filepath.Clean(s.path) ||
+					!ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Create) {
+					continue
+				}
+				delivered = s.deliverAfter(ctx, delivered, onVersion)
+			}
+		}
+	}()
+	return done, nil
+}
+
+// deliverAfter delivers the versions more recent than the input one, and
+// returns the last delivered version.
+func (s *Store[T]) deliverAfter(ctx context.Context, after uint64, onVersion func(v *config.Versioned[T]) error) uint64 {
+	err := s.scan(func(v *config.Versioned[T]) bool {
+		if v.Version <= after {
+			return true
+		}
+		after = v.Version
+		if err := onVersion(v); err != nil {
+			s.lgr.With("error", err, "version", v.Version).ErrorContext(ctx, "could not apply new version")
+		}
+		return true
+	})
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(ctx, "could not read new versions")
+	}
+	return after
+}
+
+// scan calls fn with the versions of the file in order, until fn returns
+// false. A missing file holds no version.
+func (s *Store[T]) scan(fn func(v *config.Versioned[T]) bool) error {
+	return s.scanLines(func(v *config.Versioned[T], _ line) bool {
+		return fn(v)
+	})
+}
+
+// line locates the line of a version in the file.
+type line struct {
+	off, n int64
+}
+
+// scanLines is scan also handing the line of every version.
+func (s *Store[T]) scanLines(fn func(v *config.Versioned[T], l line) bool) error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var off int64
+	for {
+		raw, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a last line without newline is still being written.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", s.path, err)
+		}
+		l := line{off: off, n: int64(len(raw))}
+		off += l.n
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		var v config.Versioned[T]
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fmt.Errorf("failed to decode config: %w", err)
+		}
+		if !fn(&v, l) {
+			return nil
+		}
+	}
+}
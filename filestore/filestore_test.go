@@ -0,0 +1,146 @@
+package filestore_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/rbroggi/streamingconfig"
+	"github.com/rbroggi/streamingconfig/filestore"
+)
+
+type appConfig struct {
+	Name string `json:"name" default:"bobby"`
+	Age  int    `json:"age"`
+}
+
+func (a *appConfig) Update(new config.Config) error {
+	newCfg, ok := new.(*appConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	a.Name = newCfg.Name
+	a.Age = newCfg.Age
+	return nil
+}
+
+func newStore(t *testing.T, path string) *filestore.Store[*appConfig] {
+	t.Helper()
+	store, err := filestore.New[*appConfig](filestore.Args{
+		Logger: slog.Default(),
+		Path:   path,
+	})
+	require.NoError(t, err)
+	return store
+}
+
+func Test_Store(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.jsonl")
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[*appConfig](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfig](newStore(t, path)),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	got, err := repo.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, &appConfig{Name: "bobby"}, got)
+
+	cV1, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfig]{
+		By:     "u1",
+		Config: &appConfig{Name: "n1", Age: 1},
+	})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		got, err := repo.GetConfig()
+		require.NoError(c, err)
+		assert.Equal(c, &appConfig{Name: "n1", Age: 1}, got)
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("external edit", func(t *testing.T) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"version":2,"updated_by":"ops","config":{"age":2}}` + "\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.EventuallyWithT(t, func(c *assert.CollectT) {
+			got, err := repo.GetConfig()
+			require.NoError(c, err)
+			assert.Equal(c, &appConfig{Name: "bobby", Age: 2}, got)
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("listings", func(t *testing.T) {
+		v1, err := repo.GetVersion(ctx, 1)
+		require.NoError(t, err)
+		require.Equal(t, cV1.Config, v1.Config)
+		all, err := repo.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+			FromVersion: 0,
+			ToVersion:   10,
+		})
+		require.NoError(t, err)
+		require.Len(t, all, 2)
+		require.Equal(t, "ops", all[1].UpdatedBy)
+	})
+
+	cnl()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("repository did not stop")
+	}
+}
+
+func Test_StoreConcurrentInsert(t *testing.T) {
+	store := newStore(t, filepath.Join(t.TempDir(), "configs.jsonl"))
+	ctx := context.Background()
+	_, err := store.Latest(ctx)
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+	v := &config.Versioned[*appConfig]{Version: 1, Config: &appConfig{Name: "n1"}}
+	require.NoError(t, store.Insert(ctx, v))
+	require.ErrorIs(t, store.Insert(ctx, v), config.ErrConcurrentUpdate)
+	latest, err := store.Latest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, v.Config, latest.Config)
+}
+
+func Test_StoreRange(t *testing.T) {
+	store := newStore(t, filepath.Join(t.TempDir(), "configs.jsonl"))
+	ctx := context.Background()
+	for version := uint64(1); version <= 10; version++ {
+		require.NoError(t, store.Insert(ctx, &config.Versioned[*appConfig]{Version: version, Config: &appConfig{Age: int(version)}}))
+	}
+
+	collect := func(query config.ListVersionedConfigsQuery) []uint64 {
+		var versions []uint64
+		require.NoError(t, store.Range(ctx, query, func(v *config.Versioned[*appConfig]) error {
+			versions = append(versions, v.Version)
+			return nil
+		}))
+		return versions
+	}
+	require.Len(t, collect(config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 100}), 10)
+	require.Equal(t, []uint64{5, 6}, collect(config.ListVersionedConfigsQuery{FromVersion: 2, ToVersion: 100, Skip: 3, Limit: 2}))
+	require.Equal(t, []uint64{6, 5}, collect(config.ListVersionedConfigsQuery{FromVersion: 2, ToVersion: 9, Skip: 2, Limit: 2, Descending: true}))
+	require.Equal(t, []uint64{2}, collect(config.ListVersionedConfigsQuery{FromVersion: 2, ToVersion: 9, Skip: 6, Descending: true}))
+
+	errStop := errors.New("stop")
+	var handed int
+	err := store.Range(ctx, config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 100, Descending: true}, func(v *config.Versioned[*appConfig]) error {
+		handed++
+		require.Equal(t, uint64(10), v.Version)
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 1, handed)
+}
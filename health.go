@@ -0,0 +1,53 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrDatabaseUnreachable is returned by HealthCheck when MongoDB does not
+	// answer pings.
+	ErrDatabaseUnreachable = errors.New("database unreachable")
+	// ErrWatcherStale is returned by HealthCheck when the watcher does not
+	// observe the updates: the change stream is not live or the watcher
+	// stopped.
+	ErrWatcherStale = errors.New("watcher stale")
+)
+
+// HealthCheck verifies that the repository is started, that MongoDB answers
+// pings and that the watcher is live, e.g. for readiness and liveness probes
+// to recycle the instances with a dead watcher. It returns ErrNotStarted,
+// ErrDatabaseUnreachable or ErrWatcherStale respectively otherwise.
+//
+// The watcher is stale while its change stream is down, until it reconnects
+// (see Reconnects), and once the repository stopped.
+func (s *WatchedRepo[T]) HealthCheck(ctx context.Context) error {
+	if err := s.checkStarted(); err != nil && !errors.Is(err, ErrStopped) {
+		return err
+	}
+	if s.configs != nil {
+		ctxTimeout, cnl := s.operationContext(ctx)
+		defer cnl()
+		if err := s.source.Client().Ping(ctxTimeout, s.readPref); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabaseUnreachable, err)
+		}
+	}
+	select {
+	case <-s.done:
+		return fmt.Errorf("%w: watcher stopped", ErrWatcherStale)
+	default:
+	}
+	select {
+	case <-s.watchLive:
+	default:
+		return fmt.Errorf("%w: change stream not live yet", ErrWatcherStale)
+	}
+	if downSince := s.watchDownSince.Load(); downSince != 0 {
+		return fmt.Errorf("%w: change stream down since %s", ErrWatcherStale,
+			time.Unix(0, downSince).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package streamingconfig
+
+import (
+	"context"
+)
+
+// WithPreUpdateHook registers a hook invoked before persisting every update,
+// with the current configuration, with defaults applied, and the candidate
+// one, as it is to be stored, e.g. for authorization or enrichment. Upon the
+// first version, the current configuration is the default one. A hook
+// returning an error aborts the update, which returns it. The hooks run in
+// registration order, after the validations, and may modify the candidate
+// when T is a pointer type: the modifications of a value are lost. The
+// validations but the `Update` method run again once they all ran. They run
+// again when the update is retried (see WithUpdateRetry), for ValidateConfig,
+// and for the version seeded with WithBootstrapFile, but not for the versions
+// restored by Import.
+func WithPreUpdateHook[T Config](hook func(ctx context.Context, old, candidate T) error) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.preUpdateHooks = append(repo.preUpdateHooks, hook)
+	}
+}
+
+// WithPostUpdateHook registers a hook invoked with every version created by
+// the updates of the repository, with defaults applied, once persisted, e.g.
+// for notifications. Unlike the callbacks of WithOnUpdate, the hooks only run
+// for the versions created by this repository, synchronously before the
+// update returns, the version seeded with WithBootstrapFile included but not
+// the versions restored by Import. They run in registration order.
+func WithPostUpdateHook[T Config](hook func(ctx context.Context, new *Versioned[T])) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.postUpdateHooks = append(repo.postUpdateHooks, hook)
+	}
+}
+
+// preUpdate runs the pre-update hooks on the candidate configuration,
+// following the current version with defaults applied, nil if none, and the
+// validations again.
+func (s *WatchedRepo[T]) preUpdate(ctx context.Context, current *Versioned[T], candidate T) error {
+	if len(s.preUpdateHooks) == 0 {
+		return nil
+	}
+	if current == nil {
+		var err error
+		if current, err = s.withDefaults(emptyVersion[T]()); err != nil {
+			return err
+		}
+	}
+	for _, hook := range s.preUpdateHooks {
+		if err := hook(ctx, current.Config, candidate); err != nil {
+			return err
+		}
+	}
+	return s.validate(candidate)
+}
+
+// postUpdate runs the post-update hooks on the created version.
+func (s *WatchedRepo[T]) postUpdate(ctx context.Context, v *Versioned[T]) {
+	for _, hook := range s.postUpdateHooks {
+		hook(ctx, v)
+	}
+}
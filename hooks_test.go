@@ -0,0 +1,31 @@
+package streamingconfig
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_preUpdateRevalidates(t *testing.T) {
+	repo, err := NewInMemoryRepo[*validatedConfig](
+		WithPreUpdateHook[*validatedConfig](func(_ context.Context, _, candidate *validatedConfig) error {
+			candidate.Age--
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = repo.Start(ctx)
+	require.NoError(t, err)
+
+	_, err = repo.UpdateConfig(ctx, UpdateConfigCmd[*validatedConfig]{
+		Config: &validatedConfig{Age: 0},
+	})
+	require.EqualError(t, err, "age must not be negative")
+	v, err := repo.UpdateConfig(ctx, UpdateConfigCmd[*validatedConfig]{
+		Config: &validatedConfig{Age: 1},
+	})
+	require.NoError(t, err)
+	require.Zero(t, v.Config.Age)
+}
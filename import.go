@@ -0,0 +1,112 @@
+package streamingconfig
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OnConflict controls how Import handles the versions that are already stored.
+type OnConflict int
+
+const (
+	// OnConflictFail aborts the import upon the first version already stored.
+	OnConflictFail OnConflict = iota
+	// OnConflictSkip keeps the stored version and continues the import.
+	OnConflictSkip
+	// OnConflictReplace overwrites the stored version with the imported one.
+	OnConflictReplace
+)
+
+// ImportCmd holds the versions to import and the conflict handling mode.
+type ImportCmd[T Config] struct {
+	// Versions are stored as-is, in the provided order: neither the `Update`
+	// method nor the defaults are applied to them.
+	Versions   []*Versioned[T]
+	OnConflict OnConflict
+}
+
+// ImportSummary reports the outcome of an import.
+type ImportSummary struct {
+	Inserted int
+	Skipped  int
+	Replaced int
+}
+
+// Import stores previously exported versions, e.g. to seed a new collection
+// or to resume an interrupted import. The summary reports what was done up to
+// the point of failure, if any.
+//
+// Importing versions older than the current one does not change the current
+// configuration.
+func (s *WatchedRepo[T]) Import(ctx context.Context, cmd ImportCmd[T]) (ImportSummary, error) {
+	var summary ImportSummary
+	if err := s.checkStarted(); err != nil {
+		return summary, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return summary, err
+	}
+	if err := s.beginWrite(); err != nil {
+		return summary, err
+	}
+	defer s.writes.Done()
+	for _, v := range cmd.Versions {
+		inserted, err := s.importVersion(ctx, v, cmd.OnConflict)
+		if err != nil {
+			return summary, fmt.Errorf("import of version %d failed: %w", v.Version, err)
+		}
+		switch {
+		case inserted:
+			summary.Inserted++
+		case cmd.OnConflict == OnConflictSkip:
+			summary.Skipped++
+		default:
+			summary.Replaced++
+		}
+	}
+	return summary, nil
+}
+
+// importVersion reports whether the version was inserted (as opposed to
+// skipped or replaced).
+func (s *WatchedRepo[T]) importVersion(ctx context.Context, v *Versioned[T], onConflict OnConflict) (bool, error) {
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	doc, err := s.document(v)
+	if err != nil {
+		return false, err
+	}
+	// the imported versions are audited at the time of the import, so that
+	// they extend the chain of the audit records.
+	at := s.now()
+	err = s.auditedWrite(ctxTimeout, v, at, func(ctx context.Context) error {
+		_, err := s.configs.InsertOne(ctx, doc)
+		return err
+	})
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+	switch onConflict {
+	case OnConflictSkip:
+		return false, nil
+	case OnConflictReplace:
+		return false, s.auditedWrite(ctxTimeout, v, at, func(ctx context.Context) error {
+			_, err := s.configs.ReplaceOne(
+				ctx,
+				s.filter(bson.M{s.versionField(): v.Version}),
+				doc,
+				options.Replace(),
+			)
+			return err
+		})
+	default:
+		return false, ErrVersionExists
+	}
+}
@@ -0,0 +1,247 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// namespaceNotFoundCode is returned when listing the indexes of a collection
+// that does not exist.
+const namespaceNotFoundCode = 26
+
+// defaultCreatedAtIndexName is the name of the index on the creation time
+// unless set with WithIndexOptions.
+const defaultCreatedAtIndexName = "idx_created_at_inc"
+
+// WithIndexOptions sets the options of the index on the creation time of the
+// versions, the one the listings by date rely on, e.g. to follow the naming
+// policies of shared clusters or to set a partial filter expression or a
+// collation. The index is named "idx_created_at_inc" unless the options name
+// it. MongoDB rejects an index on the same keys, or with the same name, as an
+// existing one but with other options, a name included: once the options
+// change, the index on the creation time conflicting with them is dropped and
+// created again with them.
+//
+// It has no effect with WithSkipIndexOperations, but for VerifyIndexes to
+// look for the index by its name.
+func WithIndexOptions[T Config](opts *options.IndexOptions) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.createdAtIndexOptions = opts
+	}
+}
+
+// index is an index the repository relies on.
+type index struct {
+	coll  *mongo.Collection
+	model mongo.IndexModel
+	// createdAt is set for the index on the creation time, replaced once the
+	// options of WithIndexOptions change.
+	createdAt bool
+	// ttl is set for the TTL index of WithVersionTTL.
+	ttl bool
+}
+
+// indexes returns the indexes the repository relies on, which it creates
+// unless WithSkipIndexOperations is set.
+func (s *WatchedRepo[T]) indexes() []index {
+	createdAtOpts := options.Index()
+	if s.createdAtIndexOptions != nil {
+		// the options of the caller are not modified.
+		opts := *s.createdAtIndexOptions
+		createdAtOpts = &opts
+	}
+	createdAtOpts.SetName(s.createdAtIndexName())
+	indexes := []index{
+		{
+			coll: s.configs,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "created_at", Value: 1}},
+				Options: createdAtOpts,
+			},
+			createdAt: true,
+		},
+		{
+			coll: s.configs,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "updated_by", Value: 1}},
+				Options: options.Index().SetName("idx_updated_by_inc"),
+			},
+		},
+		{
+			coll: s.configs,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "tags", Value: 1}},
+				Options: options.Index().SetName("idx_tags_inc"),
+			},
+		},
+	}
+	if s.versionTTL > 0 {
+		indexes = append(indexes, index{
+			coll: s.configs,
+			model: mongo.IndexModel{
+				Keys: bson.D{{Key: ttlCreatedAtField, Value: 1}},
+				Options: options.Index().
+					SetName(ttlIndexName).
+					SetExpireAfterSeconds(int32(s.versionTTL.Seconds())),
+			},
+			ttl: true,
+		})
+	}
+	if s.environment != "" {
+		indexes = append(indexes, index{
+			coll: s.configs,
+			model: mongo.IndexModel{
+				Keys: bson.D{
+					{Key: environmentField, Value: 1},
+					{Key: "_id.version", Value: 1},
+				},
+				Options: options.Index().SetName("idx_environment_version_inc"),
+			},
+		})
+	}
+	if s.scheduled != nil {
+		indexes = append(indexes, index{
+			coll: s.scheduled,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: applyAtField, Value: 1}},
+				Options: options.Index().SetName("idx_apply_at_inc"),
+			},
+		})
+	}
+	for k := range s.metadata {
+		indexes = append(indexes, index{
+			coll: s.configs,
+			model: mongo.IndexModel{
+				Keys:    bson.D{{Key: "metadata." + k, Value: 1}},
+				Options: options.Index().SetName("idx_metadata_" + k + "_inc"),
+			},
+		})
+	}
+	if s.audit != nil {
+		indexes = append(indexes, index{
+			coll: s.audit,
+			model: mongo.IndexModel{
+				Keys:    auditOrder(false),
+				Options: options.Index().SetName("idx_created_at_id_inc"),
+			},
+		})
+	}
+	return indexes
+}
+
+// createdAtIndexName returns the name of the index on the creation time.
+func (s *WatchedRepo[T]) createdAtIndexName() string {
+	if s.createdAtIndexOptions != nil && s.createdAtIndexOptions.Name != nil {
+		return *s.createdAtIndexOptions.Name
+	}
+	return defaultCreatedAtIndexName
+}
+
+// VerifyIndexes returns the names of the indexes the repository relies on
+// that are missing, e.g. to detect the deployments using
+// WithSkipIndexOperations where the indexes were never created, which
+// silently degrades the queries. The indexes are matched by name. Start logs a
+// warning for the missing ones when WithSkipIndexOperations is set.
+//
+// It only applies to the repositories relying on MongoDB.
+func (s *WatchedRepo[T]) VerifyIndexes(ctx context.Context) ([]string, error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	return s.missingIndexes(ctxTimeout)
+}
+
+// missingIndexes implements VerifyIndexes.
+func (s *WatchedRepo[T]) missingIndexes(ctx context.Context) ([]string, error) {
+	existing := map[*mongo.Collection]map[string]bool{}
+	missing := make([]string, 0)
+	for _, idx := range s.indexes() {
+		names, ok := existing[idx.coll]
+		if !ok {
+			specs, err := idx.coll.Indexes().ListSpecifications(ctx)
+			var serverErr mongo.ServerError
+			if errors.As(err, &serverErr) && serverErr.HasErrorCode(namespaceNotFoundCode) {
+				// the collection, and thus its indexes, does not exist yet.
+				specs, err = nil, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("list the indexes of %s: %w", idx.coll.Name(), err)
+			}
+			names = make(map[string]bool, len(specs))
+			for _, spec := range specs {
+				names[spec.Name] = true
+			}
+			existing[idx.coll] = names
+		}
+		if name := *idx.model.Options.Name; !names[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// warnMissingIndexes logs a warning for the missing indexes.
+func (s *WatchedRepo[T]) warnMissingIndexes(ctx context.Context) {
+	missing, err := s.missingIndexes(ctx)
+	if err != nil {
+		s.lgr.With("error", err).WarnContext(ctx, "could not verify the indexes")
+		return
+	}
+	if len(missing) > 0 {
+		s.lgr.With("indexes", missing).WarnContext(ctx, "missing indexes, the queries may be slow")
+	}
+}
+
+// replaceIndex drops the indexes conflicting with the model, on the same keys
+// or with the same name, and creates it.
+func replaceIndex(ctx context.Context, coll *mongo.Collection, model mongo.IndexModel) error {
+	keys, err := bson.Marshal(model.Keys)
+	if err != nil {
+		return err
+	}
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if spec.Name != *model.Options.Name && !sameKeys(spec.KeysDocument, keys) {
+			continue
+		}
+		if err := dropIndex(ctx, coll, spec.Name); err != nil {
+			return err
+		}
+	}
+	_, err = coll.Indexes().CreateOne(ctx, model)
+	return err
+}
+
+// sameKeys reports whether the key documents of two indexes hold the same
+// fields in the same order and direction, whatever their numeric types.
+func sameKeys(a, b bson.Raw) bool {
+	aElems, err := a.Elements()
+	if err != nil {
+		return false
+	}
+	bElems, err := b.Elements()
+	if err != nil || len(aElems) != len(bElems) {
+		return false
+	}
+	for i := range aElems {
+		aOrder, aOK := aElems[i].Value().AsInt64OK()
+		bOrder, bOK := bElems[i].Value().AsInt64OK()
+		if !aOK || !bOK || aElems[i].Key() != bElems[i].Key() || aOrder != bOrder {
+			return false
+		}
+	}
+	return true
+}
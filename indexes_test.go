@@ -0,0 +1,85 @@
+package streamingconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func Test_createdAtIndex(t *testing.T) {
+	createdAt := func(s *WatchedRepo[*schemaConfig]) *options.IndexOptions {
+		for _, idx := range s.indexes() {
+			if idx.createdAt {
+				return idx.model.Options
+			}
+		}
+		t.Fatal("no index on the creation time")
+		return nil
+	}
+
+	t.Run("default", func(t *testing.T) {
+		s := &WatchedRepo[*schemaConfig]{}
+		opts := createdAt(s)
+		require.Equal(t, "idx_created_at_inc", *opts.Name)
+		require.Nil(t, opts.ExpireAfterSeconds)
+		require.Equal(t, "idx_created_at_inc", s.createdAtIndexName())
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		custom := options.Index().
+			SetName("created_at_1").
+			SetPartialFilterExpression(bson.M{"updated_by": bson.M{"$exists": true}})
+		s := &WatchedRepo[*schemaConfig]{versionTTL: time.Hour}
+		WithIndexOptions[*schemaConfig](custom)(s)
+		opts := createdAt(s)
+		require.Equal(t, "created_at_1", *opts.Name)
+		// the TTL index is another one.
+		require.Nil(t, opts.ExpireAfterSeconds)
+		require.Equal(t, custom.PartialFilterExpression, opts.PartialFilterExpression)
+		require.Equal(t, "created_at_1", s.createdAtIndexName())
+		// the options of the caller are left untouched.
+		require.Equal(t, options.Index().
+			SetName("created_at_1").
+			SetPartialFilterExpression(bson.M{"updated_by": bson.M{"$exists": true}}), custom)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		s := &WatchedRepo[*schemaConfig]{versionTTL: time.Hour}
+		var ttl *options.IndexOptions
+		for _, idx := range s.indexes() {
+			if idx.ttl {
+				ttl = idx.model.Options
+				require.Equal(t, bson.D{{Key: "ttl_created_at", Value: 1}}, idx.model.Keys)
+			}
+		}
+		require.NotNil(t, ttl)
+		require.Equal(t, "idx_ttl_created_at", *ttl.Name)
+		require.Equal(t, int32(3600), *ttl.ExpireAfterSeconds)
+	})
+
+	t.Run("unnamed", func(t *testing.T) {
+		s := &WatchedRepo[*schemaConfig]{}
+		WithIndexOptions[*schemaConfig](options.Index().SetSparse(true))(s)
+		opts := createdAt(s)
+		require.Equal(t, "idx_created_at_inc", *opts.Name)
+		require.True(t, *opts.Sparse)
+	})
+}
+
+func Test_sameKeys(t *testing.T) {
+	raw := func(d bson.D) bson.Raw {
+		b, err := bson.Marshal(d)
+		require.NoError(t, err)
+		return b
+	}
+	createdAt := raw(bson.D{{Key: "created_at", Value: 1}})
+	require.True(t, sameKeys(createdAt, raw(bson.D{{Key: "created_at", Value: int32(1)}})))
+	require.True(t, sameKeys(createdAt, raw(bson.D{{Key: "created_at", Value: 1.0}})))
+	require.False(t, sameKeys(createdAt, raw(bson.D{{Key: "created_at", Value: -1}})))
+	require.False(t, sameKeys(createdAt, raw(bson.D{{Key: "updated_by", Value: 1}})))
+	require.False(t, sameKeys(createdAt, raw(bson.D{{Key: "created_at", Value: "text"}})))
+	require.False(t, sameKeys(createdAt, raw(bson.D{{Key: "created_at", Value: 1}, {Key: "tags", Value: 1}})))
+}
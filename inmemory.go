@@ -0,0 +1,403 @@
+package streamingconfig
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Repo is the API shared by the configuration repositories, e.g. to swap the
+// WatchedRepo for an InMemoryRepo in tests.
+type Repo[T Config] interface {
+	Start(ctx context.Context) (<-chan struct{}, error)
+	// IsStarted reports whether Start completed and the repository is not
+	// shutting down: it turns false once the context provided to Start is
+	// done, or Stop was called for the WatchedRepo.
+	IsStarted() bool
+	GetConfig() (T, error)
+	GetLatestVersion() (*Versioned[T], error)
+	CurrentVersion() (uint64, error)
+	GetVersion(ctx context.Context, version uint64) (*Versioned[T], error)
+	UpdateConfig(ctx context.Context, cmd UpdateConfigCmd[T]) (*Versioned[T], error)
+	ValidateConfig(ctx context.Context, cmd UpdateConfigCmd[T]) error
+	PatchConfig(ctx context.Context, cmd PatchCmd) (*Versioned[T], error)
+	JSONPatchConfig(ctx context.Context, by string, patch []byte) (*Versioned[T], error)
+	Diff(ctx context.Context, fromVersion, toVersion uint64) ([]FieldChange, error)
+	ListVersionedConfigs(ctx context.Context, query ListVersionedConfigsQuery) ([]*Versioned[T], error)
+	ListVersionedConfigsByDate(ctx context.Context, query ListConfigDatesQuery) ([]*Versioned[T], error)
+	ListByTag(ctx context.Context, tag string) ([]*Versioned[T], error)
+	GetLastN(ctx context.Context, n int) ([]*Versioned[T], error)
+}
+
+// InMemoryRepo is a repository keeping the versions in memory, meant for tests
+// of the applications using a WatchedRepo. It applies the `Update` method,
+// the defaults and the validations as the WatchedRepo does, and invokes the
+// update callbacks synchronously from UpdateConfig.
+type InMemoryRepo[T Config] struct {
+	// settings holds the options, shared with the WatchedRepo.
+	settings *WatchedRepo[T]
+	mu       sync.RWMutex
+	versions []*Versioned[T]
+	// latest is the latest version with defaults applied.
+	latest  *Versioned[T]
+	started bool
+	// stopped is set once the context provided to Start is done.
+	stopped bool
+}
+
+// NewInMemoryRepo returns an in-memory repository. It accepts the options of
+// the WatchedRepo: the ones related to the storage have no effect.
+func NewInMemoryRepo[T Config](opts ...func(*WatchedRepo[T])) (*InMemoryRepo[T], error) {
+	if reflect.TypeOf((*T)(nil)).Elem().Kind() == reflect.Interface {
+		return nil, ErrTypeMustBePointer
+	}
+	settings := &WatchedRepo[T]{
+		lgr: slog.Default().With("struct", "InMemoryRepo"),
+		nowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
+	}
+	for _, opt := range opts {
+		opt(settings)
+	}
+	if settings.envOverride && settings.envPrefix == "" {
+		return nil, ErrEnvOverridePrefixRequired
+	}
+	if err := settings.compileJSONSchema(); err != nil {
+		return nil, err
+	}
+	return &InMemoryRepo[T]{settings: settings}, nil
+}
+
+// Start makes the repository usable. The returned channel is closed once the
+// input context is done, after which the operations fail with ErrStopped, as
+// they do for the WatchedRepo. Start may only be called once: the subsequent
+// calls return ErrAlreadyStarted.
+func (r *InMemoryRepo[T]) Start(ctx context.Context) (<-chan struct{}, error) {
+	cfg, err := defaultConfig[T]()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := r.settings.localVersion(&Versioned[T]{Config: cfg})
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	if r.started {
+		r.mu.Unlock()
+		return nil, ErrAlreadyStarted
+	}
+	r.latest = latest
+	r.started = true
+	r.mu.Unlock()
+	if r.settings.onStart != nil {
+		r.settings.onStart(latest.Config)
+	}
+	done := make(chan struct{})
+	context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		r.stopped = true
+		r.mu.Unlock()
+		close(done)
+	})
+	return done, nil
+}
+
+// IsStarted reports whether Start completed and the context provided to it
+// is not done, as the WatchedRepo does (see Repo).
+func (r *InMemoryRepo[T]) IsStarted() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.started && !r.stopped
+}
+
+// startedErr returns ErrNotStarted until Start completed, and ErrStopped once
+// the context provided to it is done. It must be called with r.mu held.
+func (r *InMemoryRepo[T]) startedErr() error {
+	switch {
+	case !r.started:
+		return ErrNotStarted
+	case r.stopped:
+		return ErrStopped
+	}
+	return nil
+}
+
+// GetConfig gets the current user-defined configuration with defaults applied to it.
+func (r *InMemoryRepo[T]) GetConfig() (T, error) {
+	v, err := r.GetLatestVersion()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.Config, nil
+}
+
+// GetLatestVersion returns the latest version of the user-provided configuration
+// along with auditing data.
+func (r *InMemoryRepo[T]) GetLatestVersion() (*Versioned[T], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.startedErr(); err != nil {
+		return nil, err
+	}
+	if r.settings.requireExplicitInit && r.latest.Version == 0 {
+		return nil, ErrNotInitialized
+	}
+	// a copy, for the callers not to alter the cached version.
+	return deepCopy(r.latest)
+}
+
+// CurrentVersion returns the version of the current configuration, 0 if none
+// was ever created.
+func (r *InMemoryRepo[T]) CurrentVersion() (uint64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.startedErr(); err != nil {
+		return 0, err
+	}
+	return r.latest.Version, nil
+}
+
+// GetVersion returns the requested version with defaults applied, or
+// ErrConfigurationNotFound if it does not exist.
+func (r *InMemoryRepo[T]) GetVersion(_ context.Context, version uint64) (*Versioned[T], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.startedErr(); err != nil {
+		return nil, err
+	}
+	for _, v := range r.versions {
+		if v.Version == version {
+			return r.settings.withDefaults(v)
+		}
+	}
+	return nil, ErrConfigurationNotFound
+}
+
+// Diff returns the changes of the fields between two versions, in path order.
+func (r *InMemoryRepo[T]) Diff(_ context.Context, fromVersion, toVersion uint64) ([]FieldChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.startedErr(); err != nil {
+		return nil, err
+	}
+	var from, to *Versioned[T]
+	for _, v := range r.versions {
+		if v.Version == fromVersion {
+			from = v
+		}
+		if v.Version == toVersion {
+			to = v
+		}
+	}
+	if from == nil {
+		return nil, fmt.Errorf("could not load version %d: %w", fromVersion, ErrConfigurationNotFound)
+	}
+	if to == nil {
+		return nil, fmt.Errorf("could not load version %d: %w", toVersion, ErrConfigurationNotFound)
+	}
+	return diffVersions(from, to)
+}
+
+// UpdateConfig modifies the latest configuration by calling the underlying
+// `Update` method and creates a new updated version. ErrConcurrentUpdate is
+// returned if another update created a version meanwhile, e.g. while the
+// pre-update hooks ran.
+func (r *InMemoryRepo[T]) UpdateConfig(ctx context.Context, cmd UpdateConfigCmd[T]) (*Versioned[T], error) {
+	r.mu.RLock()
+	if err := r.startedErr(); err != nil {
+		r.mu.RUnlock()
+		return nil, err
+	}
+	var latest *Versioned[T]
+	if len(r.versions) > 0 {
+		latest = r.versions[len(r.versions)-1]
+	}
+	r.mu.RUnlock()
+	cmd.By = r.settings.actorOf(ctx, cmd.By)
+	newVersion, err := r.settings.nextVersion(latest, cmd)
+	if err != nil {
+		return nil, err
+	}
+	var current *Versioned[T]
+	if latest != nil {
+		if current, err = r.settings.withDefaults(latest); err != nil {
+			return nil, err
+		}
+	}
+	// the hooks run without the lock, for them to be able to read the
+	// configuration.
+	if err := r.settings.preUpdate(ctx, current, newVersion.Config); err != nil {
+		return nil, err
+	}
+	// the stored version must not be changed by the caller.
+	if newVersion.Config, err = deepCopy(newVersion.Config); err != nil {
+		return nil, err
+	}
+	withDefaults, err := r.settings.withDefaults(newVersion)
+	if err != nil {
+		return nil, err
+	}
+	local, err := r.settings.localVersion(newVersion)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	if len(r.versions) > 0 && r.versions[len(r.versions)-1] != latest {
+		// another update created the version meanwhile.
+		r.mu.Unlock()
+		return nil, ErrConcurrentUpdate
+	}
+	prev := r.latest
+	r.versions = append(r.versions, newVersion)
+	r.latest = local
+	r.mu.Unlock()
+	for i, onUpdate := range r.settings.onUpdate {
+		r.settings.notifyUpdate(i, func() { onUpdate(local.Config) })
+	}
+	for i, onUpdate := range r.settings.onUpdateDiff {
+		r.settings.notifyUpdate(len(r.settings.onUpdate)+i, func() { onUpdate(prev.Config, local.Config) })
+	}
+	r.settings.postUpdate(ctx, withDefaults)
+	return withDefaults, nil
+}
+
+// ValidateConfig runs the same merge, validations and pre-update hooks as
+// UpdateConfig, and returns the same errors, without creating any version.
+func (r *InMemoryRepo[T]) ValidateConfig(ctx context.Context, cmd UpdateConfigCmd[T]) error {
+	r.mu.RLock()
+	if err := r.startedErr(); err != nil {
+		r.mu.RUnlock()
+		return err
+	}
+	var latest *Versioned[T]
+	if len(r.versions) > 0 {
+		latest = r.versions[len(r.versions)-1]
+	}
+	r.mu.RUnlock()
+	newVersion, err := r.settings.nextVersion(latest, cmd)
+	if err != nil {
+		return err
+	}
+	var current *Versioned[T]
+	if latest != nil {
+		if current, err = r.settings.withDefaults(latest); err != nil {
+			return err
+		}
+	}
+	// the hooks run without the lock, as for UpdateConfig.
+	if err := r.settings.preUpdate(ctx, current, newVersion.Config); err != nil {
+		return err
+	}
+	_, err = r.settings.withDefaults(newVersion)
+	return err
+}
+
+// PatchConfig applies a JSON Merge Patch onto the JSON representation of the
+// latest configuration and creates a new version out of it.
+func (r *InMemoryRepo[T]) PatchConfig(ctx context.Context, cmd PatchCmd) (*Versioned[T], error) {
+	latest, err := r.latestStored()
+	if err != nil {
+		return nil, err
+	}
+	updateCmd, err := patchUpdateCmd(latest, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return r.UpdateConfig(ctx, updateCmd)
+}
+
+// JSONPatchConfig applies an RFC 6902 JSON Patch onto the JSON representation
+// of the latest configuration and creates a new version out of it.
+func (r *InMemoryRepo[T]) JSONPatchConfig(ctx context.Context, by string, patch []byte) (*Versioned[T], error) {
+	latest, err := r.latestStored()
+	if err != nil {
+		return nil, err
+	}
+	updateCmd, err := jsonPatchUpdateCmd(latest, by, patch)
+	if err != nil {
+		return nil, err
+	}
+	return r.UpdateConfig(ctx, updateCmd)
+}
+
+// latestStored returns the latest version without defaults, nil if none.
+func (r *InMemoryRepo[T]) latestStored() (*Versioned[T], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.startedErr(); err != nil {
+		return nil, err
+	}
+	if len(r.versions) == 0 {
+		return nil, nil
+	}
+	return r.versions[len(r.versions)-1], nil
+}
+
+// ListVersionedConfigs returns a list of the user-provided configuration
+// versions along with auditing data.
+func (r *InMemoryRepo[T]) ListVersionedConfigs(_ context.Context, query ListVersionedConfigsQuery) ([]*Versioned[T], error) {
+	return r.list(func(v *Versioned[T]) bool {
+		return v.Matches(query)
+	}, query.Skip, query.Limit, query.Descending)
+}
+
+// GetLastN returns the n most recent versions, newest first. Non-positive n
+// return no versions.
+func (r *InMemoryRepo[T]) GetLastN(_ context.Context, n int) ([]*Versioned[T], error) {
+	return r.list(func(*Versioned[T]) bool { return n > 0 }, 0, int64(n), true)
+}
+
+// ListVersionedConfigsByDate returns a list of the user-provided configuration
+// versions along with auditing data.
+func (r *InMemoryRepo[T]) ListVersionedConfigsByDate(_ context.Context, query ListConfigDatesQuery) ([]*Versioned[T], error) {
+	return r.list(func(v *Versioned[T]) bool {
+		return !v.CreatedAt.Before(query.From) && v.CreatedAt.Before(query.To) &&
+			v.HasMetadata(query.Metadata)
+	}, query.Skip, query.Limit, query.Descending)
+}
+
+// ListByTag returns the versions labeled with the tag, in version order.
+func (r *InMemoryRepo[T]) ListByTag(_ context.Context, tag string) ([]*Versioned[T], error) {
+	return r.list(func(v *Versioned[T]) bool {
+		return slices.Contains(v.Tags, tag)
+	}, 0, 0, false)
+}
+
+// list returns the matching versions with defaults applied, in version order.
+func (r *InMemoryRepo[T]) list(match func(v *Versioned[T]) bool, skip, limit int64, descending bool) ([]*Versioned[T], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.startedErr(); err != nil {
+		return nil, err
+	}
+	versions := r.versions
+	if descending {
+		versions = slices.Clone(versions)
+		slices.Reverse(versions)
+	}
+	configs := make([]*Versioned[T], 0)
+	for _, v := range versions {
+		if !match(v) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if limit > 0 && int64(len(configs)) == limit {
+			break
+		}
+		cp, err := copyAndSetDefaults(v)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, cp)
+	}
+	return configs, nil
+}
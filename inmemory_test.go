@@ -0,0 +1,257 @@
+package streamingconfig_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	config "github.com/rbroggi/streamingconfig"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ config.Repo[*appConfigV0] = (*config.WatchedRepo[*appConfigV0])(nil)
+var _ config.Repo[*appConfigV0] = (*config.InMemoryRepo[*appConfigV0])(nil)
+
+func Test_InMemoryRepo(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	at := time.Unix(1700000000, 0).UTC()
+	var updates []string
+	repo, err := config.NewInMemoryRepo[*appConfigV0](
+		config.WithNowFn[*appConfigV0](func() time.Time { return at }),
+		config.WithOnUpdate[*appConfigV0](func(conf *appConfigV0) {
+			updates = append(updates, conf.Name)
+		}),
+	)
+	require.NoError(t, err)
+	_, err = repo.GetConfig()
+	require.ErrorIs(t, err, config.ErrNotStarted)
+	_, err = repo.CurrentVersion()
+	require.ErrorIs(t, err, config.ErrNotStarted)
+	require.False(t, repo.IsStarted())
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	require.True(t, repo.IsStarted())
+
+	t.Run("defaults before any update", func(t *testing.T) {
+		got, err := repo.GetConfig()
+		require.NoError(t, err)
+		require.Equal(t, &appConfigV0{Name: "bobby"}, got)
+		version, err := repo.CurrentVersion()
+		require.NoError(t, err)
+		require.Zero(t, version)
+	})
+
+	t.Run("updates", func(t *testing.T) {
+		cV1, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Duration: time.Second, List: []string{"a"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &config.Versioned[*appConfigV0]{
+			Version:   1,
+			UpdatedBy: "u1",
+			CreatedAt: at,
+			Config:    &appConfigV0{Name: "bobby", Duration: time.Second, List: []string{"a"}},
+		}, cV1)
+		version, err := repo.CurrentVersion()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), version)
+		cV2, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:       "u2",
+			Config:   &appConfigV0{Name: "n2"},
+			Reason:   "rename",
+			Metadata: map[string]string{"ticket": "OPS-1"},
+			Tags:     []string{"release"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), cV2.Version)
+		require.Equal(t, "rename", cV2.Reason)
+		require.Equal(t, map[string]string{"ticket": "OPS-1"}, cV2.Metadata)
+		require.Equal(t, []string{"bobby", "n2"}, updates)
+
+		latest, err := repo.GetLatestVersion()
+		require.NoError(t, err)
+		require.Equal(t, cV2, latest)
+		got, err := repo.GetVersion(ctx, 1)
+		require.NoError(t, err)
+		require.Equal(t, cV1, got)
+		_, err = repo.GetVersion(ctx, 3)
+		require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		_, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Duration: -time.Second},
+		})
+		require.Error(t, err)
+		expected := uint64(1)
+		_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:              "u1",
+			Config:          &appConfigV0{Name: "n3"},
+			ExpectedVersion: &expected,
+		})
+		require.ErrorIs(t, err, config.ErrVersionMismatch)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		require.NoError(t, repo.ValidateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: "n3"},
+		}))
+		err := repo.ValidateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Duration: -time.Second},
+		})
+		require.Error(t, err)
+		latest, err := repo.GetLatestVersion()
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), latest.Version)
+		require.Equal(t, []string{"bobby", "n2"}, updates)
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		cV3, err := repo.PatchConfig(ctx, config.PatchCmd{
+			By:         "u3",
+			MergePatch: []byte(`{"duration":1000,"name":null}`),
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), cV3.Version)
+		require.Equal(t, &appConfigV0{Name: "bobby", Duration: time.Microsecond}, cV3.Config)
+		_, err = repo.PatchConfig(ctx, config.PatchCmd{By: "u3", MergePatch: []byte(`{"duration":"1s"}`)})
+		require.ErrorIs(t, err, config.ErrInvalidPatch)
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		_, err := repo.JSONPatchConfig(ctx, "u4", []byte(`[
+			{"op": "test", "path": "/name", "value": "n2"},
+			{"op": "replace", "path": "/name", "value": "n4"}
+		]`))
+		require.ErrorIs(t, err, config.ErrPatchOperationFailed)
+		require.ErrorContains(t, err, "operation 0 (test /name)")
+		cV4, err := repo.JSONPatchConfig(ctx, "u4", []byte(`[
+			{"op": "test", "path": "/name", "value": ""},
+			{"op": "add", "path": "/list", "value": ["x"]},
+			{"op": "copy", "from": "/list/0", "path": "/name"}
+		]`))
+		require.NoError(t, err)
+		require.Equal(t, uint64(4), cV4.Version)
+		require.Equal(t, &appConfigV0{Name: "x", Duration: time.Microsecond, List: []string{"x"}}, cV4.Config)
+		_, err = repo.JSONPatchConfig(ctx, "u4", []byte(`{"op": "remove"}`))
+		require.ErrorIs(t, err, config.ErrInvalidPatch)
+	})
+
+	t.Run("listings", func(t *testing.T) {
+		all, err := repo.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+			FromVersion: 0,
+			ToVersion:   10,
+		})
+		require.NoError(t, err)
+		require.Len(t, all, 4)
+		page, err := repo.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+			FromVersion: 0,
+			ToVersion:   10,
+			Skip:        1,
+			Limit:       1,
+		})
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		require.Equal(t, uint64(2), page[0].Version)
+		newest, err := repo.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+			FromVersion: 0,
+			ToVersion:   10,
+			Skip:        1,
+			Limit:       2,
+			Descending:  true,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []*config.Versioned[*appConfigV0]{all[2], all[1]}, newest)
+		lastN, err := repo.GetLastN(ctx, 2)
+		require.NoError(t, err)
+		require.Equal(t, []*config.Versioned[*appConfigV0]{all[3], all[2]}, lastN)
+		none, err := repo.GetLastN(ctx, 0)
+		require.NoError(t, err)
+		require.Empty(t, none)
+		byDate, err := repo.ListVersionedConfigsByDate(ctx, config.ListConfigDatesQuery{
+			From: at,
+			To:   at.Add(time.Second),
+		})
+		require.NoError(t, err)
+		require.Equal(t, all, byDate)
+		datePage, err := repo.ListVersionedConfigsByDate(ctx, config.ListConfigDatesQuery{
+			From:  at,
+			To:    at.Add(time.Second),
+			Skip:  1,
+			Limit: 2,
+		})
+		require.NoError(t, err)
+		require.Equal(t, all[1:3], datePage)
+		byAuthor, err := repo.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+			FromVersion: 0,
+			ToVersion:   10,
+			UpdatedBy:   "u2",
+		})
+		require.NoError(t, err)
+		require.Len(t, byAuthor, 1)
+		require.Equal(t, uint64(2), byAuthor[0].Version)
+		tagged, err := repo.ListByTag(ctx, "release")
+		require.NoError(t, err)
+		require.Len(t, tagged, 1)
+		require.Equal(t, uint64(2), tagged[0].Version)
+	})
+
+	_, err = repo.Start(ctx)
+	require.ErrorIs(t, err, config.ErrAlreadyStarted)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+	require.False(t, repo.IsStarted())
+	// the reads and the writes fail once the context is done.
+	_, err = repo.GetConfig()
+	require.ErrorIs(t, err, config.ErrStopped)
+	_, err = repo.ListVersionedConfigs(context.Background(), config.ListVersionedConfigsQuery{ToVersion: 10})
+	require.ErrorIs(t, err, config.ErrStopped)
+	_, err = repo.UpdateConfig(context.Background(), config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n5"},
+	})
+	require.ErrorIs(t, err, config.ErrStopped)
+	_, err = repo.Start(context.Background())
+	require.ErrorIs(t, err, config.ErrAlreadyStarted)
+}
+
+func Test_InMemoryRepo_hookReadsConfig(t *testing.T) {
+	var repo *config.InMemoryRepo[*appConfigV0]
+	repo, err := config.NewInMemoryRepo[*appConfigV0](
+		config.WithPreUpdateHook[*appConfigV0](func(_ context.Context, _, candidate *appConfigV0) error {
+			// the hooks can read the configuration.
+			current, err := repo.GetConfig()
+			if err != nil {
+				return err
+			}
+			candidate.List = append(candidate.List, current.Name)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	_, err = repo.Start(context.Background())
+	require.NoError(t, err)
+
+	updated := make(chan *config.Versioned[*appConfigV0])
+	go func() {
+		v, err := repo.UpdateConfig(context.Background(), config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: "n1"},
+		})
+		require.NoError(t, err)
+		updated <- v
+	}()
+	select {
+	case v := <-updated:
+		require.Equal(t, []string{"bobby"}, v.Config.List)
+	case <-time.After(time.Second):
+		t.Fatal("update deadlocked")
+	}
+}
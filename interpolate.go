@@ -0,0 +1,162 @@
+package streamingconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrInterpolationCycle is returned when string fields reference each other.
+	ErrInterpolationCycle = errors.New("interpolation cycle")
+	// ErrInterpolationReference is returned when a reference does not point to
+	// a scalar field of the configuration.
+	ErrInterpolationReference = errors.New("invalid interpolation reference")
+)
+
+// interpolationPattern matches references such as `${host}` or
+// `${nested.counter}`.
+var interpolationPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// WithInterpolation resolves references to other fields in string values, e.g.
+// `"base_url": "http://${host}:${port}"`. References are the dotted JSON paths
+// of scalar fields (strings, numbers or booleans); referenced strings can
+// themselves hold references, as long as they do not form a cycle.
+//
+// Only string values are interpolated. The stored versions, and thus listings,
+// keep the raw templates while the configuration returned by GetConfig,
+// GetLatestVersion and UpdateConfig is resolved after defaults are applied.
+// UpdateConfig rejects configurations that cannot be resolved.
+func WithInterpolation[T Config]() func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.interpolation = true
+	}
+}
+
+// interpolate returns a copy of the configuration with all the references of
+// its string values resolved.
+func interpolate[T any](cfg T) (T, error) {
+	var zero T
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return zero, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// numbers are kept as is, e.g. large integers are not turned into floats.
+	dec.UseNumber()
+	var root any
+	if err := dec.Decode(&root); err != nil {
+		return zero, err
+	}
+	it := &interpolator{
+		root:      root,
+		resolved:  map[string]string{},
+		resolving: map[string]bool{},
+	}
+	resolved, err := it.resolveValue(root, "")
+	if err != nil {
+		return zero, err
+	}
+	if b, err = json.Marshal(resolved); err != nil {
+		return zero, err
+	}
+	return unmarshalNew[T](b)
+}
+
+type interpolator struct {
+	root any
+	// resolved caches the resolved string values by path.
+	resolved map[string]string
+	// resolving holds the paths being resolved, to detect cycles.
+	resolving map[string]bool
+}
+
+// resolveValue resolves the JSON value found at path. Values nested in arrays
+// have no path as they cannot be referenced.
+func (it *interpolator) resolveValue(v any, path string) (any, error) {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, child := range val {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			r, err := it.resolveValue(child, childPath)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(val))
+		for i, child := range val {
+			r, err := it.resolveValue(child, "")
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	case string:
+		return it.resolveString(val, path)
+	default:
+		return v, nil
+	}
+}
+
+func (it *interpolator) resolveString(s, path string) (string, error) {
+	if path != "" {
+		if r, ok := it.resolved[path]; ok {
+			return r, nil
+		}
+		if it.resolving[path] {
+			return "", fmt.Errorf("%w: field %s is part of a reference cycle", ErrInterpolationCycle, path)
+		}
+		it.resolving[path] = true
+		defer delete(it.resolving, path)
+	}
+	var resolveErr error
+	r := interpolationPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if resolveErr != nil {
+			return match
+		}
+		ref := interpolationPattern.FindStringSubmatch(match)[1]
+		var value string
+		value, resolveErr = it.lookup(ref)
+		return value
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	if path != "" {
+		it.resolved[path] = r
+	}
+	return r, nil
+}
+
+// lookup returns the resolved value of the scalar field referenced by path.
+func (it *interpolator) lookup(ref string) (string, error) {
+	v := it.root
+	for _, key := range strings.Split(ref, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("%w: %q", ErrInterpolationReference, ref)
+		}
+		if v, ok = obj[key]; !ok {
+			return "", fmt.Errorf("%w: %q", ErrInterpolationReference, ref)
+		}
+	}
+	switch val := v.(type) {
+	case string:
+		return it.resolveString(val, ref)
+	case json.Number, bool:
+		return fmt.Sprint(val), nil
+	default:
+		return "", fmt.Errorf("%w: %q is not a scalar field", ErrInterpolationReference, ref)
+	}
+}
@@ -0,0 +1,50 @@
+package streamingconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type interpolatedConfig struct {
+	Host    string            `json:"host"`
+	Port    int               `json:"port"`
+	BaseURL string            `json:"base_url"`
+	Health  string            `json:"health"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func Test_Interpolate(t *testing.T) {
+	t.Run("references are resolved", func(t *testing.T) {
+		got, err := interpolate(&interpolatedConfig{
+			Host:    "localhost",
+			Port:    8080,
+			BaseURL: "http://${host}:${port}",
+			Health:  "${base_url}/health",
+			Labels:  map[string]string{"url": "${base_url}"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &interpolatedConfig{
+			Host:    "localhost",
+			Port:    8080,
+			BaseURL: "http://localhost:8080",
+			Health:  "http://localhost:8080/health",
+			Labels:  map[string]string{"url": "http://localhost:8080"},
+		}, got)
+	})
+	t.Run("cycles are rejected", func(t *testing.T) {
+		_, err := interpolate(&interpolatedConfig{
+			Host:    "${base_url}",
+			BaseURL: "http://${host}:${port}",
+		})
+		require.ErrorIs(t, err, ErrInterpolationCycle)
+	})
+	t.Run("unknown references are rejected", func(t *testing.T) {
+		_, err := interpolate(&interpolatedConfig{BaseURL: "http://${hostname}"})
+		require.ErrorIs(t, err, ErrInterpolationReference)
+	})
+	t.Run("non-scalar references are rejected", func(t *testing.T) {
+		_, err := interpolate(&interpolatedConfig{BaseURL: "${labels}"})
+		require.ErrorIs(t, err, ErrInterpolationReference)
+	})
+}
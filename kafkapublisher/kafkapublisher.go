@@ -0,0 +1,87 @@
+// Package kafkapublisher provides a streamingconfig.Publisher publishing the
+// new versions to a Kafka topic, for services reacting to the configuration
+// changes through an existing event bus.
+package kafkapublisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+
+	config "github.com/rbroggi/streamingconfig"
+)
+
+const (
+	defaultKey = "streamingconfig"
+	// VersionHeader holds the version carried by a message.
+	VersionHeader = "version"
+)
+
+// Writer writes the messages to Kafka, e.g. a *kafka.Writer.
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Args holds the dependencies of the Publisher.
+type Args struct {
+	Writer Writer
+	// Topic is the topic of the messages, to be left empty when the writer
+	// sets it.
+	Topic string
+	// Key keys the messages, e.g. with the name of the configuration, so that
+	// its versions land on the same partition, in order. It defaults to
+	// "streamingconfig".
+	Key string
+	// Marshal encodes the versions, as JSON by default. It can be set e.g. to
+	// an Avro encoder.
+	Marshal func(v any) ([]byte, error)
+}
+
+// Publisher publishes each version as a message keyed by the configuration
+// key, with the version in the VersionHeader header.
+type Publisher[T config.Config] struct {
+	writer  Writer
+	topic   string
+	key     []byte
+	marshal func(v any) ([]byte, error)
+}
+
+// New returns a Publisher to be set with streamingconfig.WithEventPublisher.
+func New[T config.Config](args Args) (*Publisher[T], error) {
+	if args.Writer == nil {
+		return nil, errors.New("kafka writer is required")
+	}
+	key := args.Key
+	if key == "" {
+		key = defaultKey
+	}
+	marshal := args.Marshal
+	if marshal == nil {
+		marshal = json.Marshal
+	}
+	return &Publisher[T]{
+		writer:  args.Writer,
+		topic:   args.Topic,
+		key:     []byte(key),
+		marshal: marshal,
+	}, nil
+}
+
+func (p *Publisher[T]) Publish(ctx context.Context, v *config.Versioned[T]) error {
+	value, err := p.marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode version %d: %w", v.Version, err)
+	}
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Topic: p.topic,
+		Key:   p.key,
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: VersionHeader, Value: []byte(strconv.FormatUint(v.Version, 10))},
+		},
+	})
+}
@@ -0,0 +1,78 @@
+package kafkapublisher_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/rbroggi/streamingconfig"
+	"github.com/rbroggi/streamingconfig/kafkapublisher"
+)
+
+type appConfig struct {
+	Name string `json:"name" default:"bobby"`
+	Age  int    `json:"age"`
+}
+
+func (a *appConfig) Update(new config.Config) error {
+	newCfg, ok := new.(*appConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	a.Name = newCfg.Name
+	a.Age = newCfg.Age
+	return nil
+}
+
+type fakeWriter struct {
+	msgs []kafka.Message
+	err  error
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func TestPublisher(t *testing.T) {
+	w := &fakeWriter{}
+	p, err := kafkapublisher.New[*appConfig](kafkapublisher.Args{Writer: w, Topic: "configs", Key: "app"})
+	require.NoError(t, err)
+	v := &config.Versioned[*appConfig]{Version: 3, UpdatedBy: "u1", Config: &appConfig{Name: "n1", Age: 30}}
+	require.NoError(t, p.Publish(context.Background(), v))
+
+	require.Len(t, w.msgs, 1)
+	msg := w.msgs[0]
+	require.Equal(t, "configs", msg.Topic)
+	require.Equal(t, []byte("app"), msg.Key)
+	require.Equal(t, []kafka.Header{{Key: kafkapublisher.VersionHeader, Value: []byte("3")}}, msg.Headers)
+	var decoded config.Versioned[*appConfig]
+	require.NoError(t, json.Unmarshal(msg.Value, &decoded))
+	require.Equal(t, v.Config, decoded.Config)
+	require.Equal(t, v.Version, decoded.Version)
+
+	w.err = errors.New("broker unavailable")
+	require.ErrorIs(t, p.Publish(context.Background(), v), w.err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := kafkapublisher.New[*appConfig](kafkapublisher.Args{})
+	require.Error(t, err)
+
+	w := &fakeWriter{}
+	p, err := kafkapublisher.New[*appConfig](kafkapublisher.Args{
+		Writer:  w,
+		Marshal: func(any) ([]byte, error) { return []byte("encoded"), nil },
+	})
+	require.NoError(t, err)
+	require.NoError(t, p.Publish(context.Background(), &config.Versioned[*appConfig]{Version: 1}))
+	require.Equal(t, []byte("streamingconfig"), w.msgs[0].Key)
+	require.Equal(t, []byte("encoded"), w.msgs[0].Value)
+}
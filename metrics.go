@@ -0,0 +1,51 @@
+package streamingconfig
+
+import "time"
+
+// MetricsRecorder records the operations of the repository, e.g. to expose
+// them as Prometheus metrics (see the prommetrics module). Its methods are
+// called concurrently.
+type MetricsRecorder interface {
+	// ObserveUpdate records an update and its latency; err is
+	// ErrConcurrentUpdate when the update conflicted with another one.
+	ObserveUpdate(latency time.Duration, err error)
+	// ObserveEvent records a change stream event processed by the watcher.
+	ObserveEvent(operationType string)
+	// ObserveDecodeError records a change stream event that could not be
+	// decoded.
+	ObserveDecodeError()
+	// ObserveReconnect records an attempt to re-open the change stream.
+	ObserveReconnect()
+}
+
+// WithMetricsRecorder records the operations of the repository with the
+// recorder.
+func WithMetricsRecorder[T Config](r MetricsRecorder) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.metrics = r
+	}
+}
+
+func (s *WatchedRepo[T]) observeUpdate(start time.Time, err error) {
+	if s.metrics != nil {
+		s.metrics.ObserveUpdate(time.Since(start), err)
+	}
+}
+
+func (s *WatchedRepo[T]) observeEvent(operationType string) {
+	if s.metrics != nil {
+		s.metrics.ObserveEvent(operationType)
+	}
+}
+
+func (s *WatchedRepo[T]) observeDecodeError() {
+	if s.metrics != nil {
+		s.metrics.ObserveDecodeError()
+	}
+}
+
+func (s *WatchedRepo[T]) observeReconnect() {
+	if s.metrics != nil {
+		s.metrics.ObserveReconnect()
+	}
+}
@@ -0,0 +1,91 @@
+package streamingconfig
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoStore is the MongoDB realization of the Store. It relies on the
+// collection and on the MongoDB-specific options of the repository.
+type mongoStore[T Config] struct {
+	repo *WatchedRepo[T]
+}
+
+// init prepares the collection and detects the topology of the deployment,
+// which must be done before watching.
+func (m *mongoStore[T]) init(ctx context.Context) error {
+	s := m.repo
+	if !s.skipIndexOperation {
+		if err := s.createIndexes(ctx); err != nil {
+			return err
+		}
+	} else {
+		s.warnMissingIndexes(ctx)
+	}
+	topo, err := s.detectTopology(ctx)
+	if err != nil {
+		return err
+	}
+	s.topology = topo
+	s.lgr.With("topology", topo).InfoContext(ctx, "detected mongo topology")
+	return nil
+}
+
+func (m *mongoStore[T]) Latest(ctx context.Context) (*Versioned[T], error) {
+	return m.repo.getLatest(ctx)
+}
+
+func (m *mongoStore[T]) Insert(ctx context.Context, v *Versioned[T]) error {
+	return m.repo.createConfig(ctx, v)
+}
+
+func (m *mongoStore[T]) Range(ctx context.Context, query ListVersionedConfigsQuery, fn func(v *Versioned[T]) error) error {
+	cursor, err := m.repo.findVersions(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		cfg, err := m.repo.decodeVersion(cursor.Current)
+		if err != nil {
+			return err
+		}
+		if err := fn(cfg); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// rangeMetadata hands the auditing data of the versions matching the query to
+// fn one at a time, without reading their configurations.
+func (m *mongoStore[T]) rangeMetadata(ctx context.Context, query ListVersionedConfigsQuery, fn func(m *VersionMetadata) error) error {
+	s := m.repo
+	cursor, err := s.findVersions(ctx, query, options.Find().SetProjection(bson.M{"app_config": 0}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		md := &VersionMetadata{}
+		if err := decodeDocument(cursor.Current, md); err != nil {
+			return err
+		}
+		if md.Version, err = s.versionOf(cursor.Current); err != nil {
+			return err
+		}
+		if err := fn(md); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (m *mongoStore[T]) Watch(ctx context.Context, onVersion func(v *Versioned[T]) error) (<-chan struct{}, error) {
+	if m.repo.pollInterval > 0 {
+		return m.repo.pollChanges(ctx, onVersion), nil
+	}
+	return m.repo.watchChanges(ctx, onVersion)
+}
@@ -0,0 +1,430 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/creasty/defaults"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultNamespacedCollectionName = "namespaced_config"
+	// namespacedWatchRetryInterval is the wait before reopening the change
+	// stream after a failure.
+	namespacedWatchRetryInterval = time.Second
+)
+
+// namespacedID is the _id of the versions managed by a NamespacedRepo: the
+// versions of each key are numbered independently.
+type namespacedID struct {
+	Key     string `bson:"key"`
+	Version uint64 `bson:"version"`
+}
+
+// NamespacedRepo manages many independent configuration histories, one per
+// key, e.g. per tenant or per feature, in a single collection and behind a
+// single change stream. Each key behaves as the configuration of a WatchedRepo:
+// its versions are numbered from 1, and a key without any version holds the
+// default configuration.
+//
+// It accepts the options of the WatchedRepo, the update hooks, the update
+// retry, the metrics recorder and the actor resolution included, with these
+// exceptions:
+//   - WithEnvironment, WithStore, WithAuditCollection, WithWebhook and
+//     WithEventPublisher make the constructor fail with ErrNotSupported.
+//   - WithOnStart, WithOnUpdate, WithOnUpdateDiff, WithOnError,
+//     WithWatchStartAtTime, WithResumeTokenStore, WithBootstrapFile,
+//     WithPolling, WithStalenessCheck, WithScheduledUpdates, WithMaxVersions,
+//     WithVersionTTL, WithIndexOptions and WithTracerProvider have no effect.
+//
+// The versions are stored in the "namespaced_config" collection by default,
+// which must not be shared with a WatchedRepo.
+type NamespacedRepo[T Config] struct {
+	// settings holds the options and the collection.
+	settings *WatchedRepo[T]
+	mu       sync.RWMutex
+	// latest holds the latest version of each key, with defaults applied.
+	latest  map[string]*Versioned[T]
+	started bool
+}
+
+// NewNamespacedRepo returns a NamespacedRepo storing the versions in the
+// database of the input arguments.
+func NewNamespacedRepo[T Config](args Args, opts ...func(*WatchedRepo[T])) (*NamespacedRepo[T], error) {
+	opts = append([]func(*WatchedRepo[T]){WithCollectionName[T](defaultNamespacedCollectionName)}, opts...)
+	settings, err := NewWatchedRepo(args, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := settings.mongoOnly(); err != nil {
+		return nil, err
+	}
+	if settings.environment != "" {
+		return nil, fmt.Errorf("%w: environment scoping of the NamespacedRepo", ErrNotSupported)
+	}
+	if settings.audit != nil {
+		return nil, fmt.Errorf("%w: audit collection of the NamespacedRepo", ErrNotSupported)
+	}
+	if len(settings.webhooks) > 0 || len(settings.publishers) > 0 {
+		return nil, fmt.Errorf("%w: update notifications of the NamespacedRepo", ErrNotSupported)
+	}
+	settings.lgr = args.Logger.With("struct", "NamespacedRepo")
+	return &NamespacedRepo[T]{
+		settings: settings,
+		latest:   map[string]*Versioned[T]{},
+	}, nil
+}
+
+// Start loads the latest version of every key and watches for new versions
+// until the input context is done, at which point the returned channel is
+// closed.
+func (r *NamespacedRepo[T]) Start(ctx context.Context) (<-chan struct{}, error) {
+	s := r.settings
+	if err := s.store.(*mongoStore[T]).init(ctx); err != nil {
+		return nil, err
+	}
+	if !s.skipIndexOperation {
+		if err := r.createIndexes(ctx); err != nil {
+			return nil, err
+		}
+	}
+	// the stream is opened before loading the latest versions not to miss any.
+	cs, err := r.openChangeStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error watching configs: %w", err)
+	}
+	if err := r.loadLatest(ctx); err != nil {
+		_ = cs.Close(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	r.mu.Lock()
+	r.started = true
+	r.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.watch(ctx, cs)
+	}()
+	return done, nil
+}
+
+func (r *NamespacedRepo[T]) isStarted() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.started
+}
+
+// Keys returns the keys holding at least one version, in order.
+func (r *NamespacedRepo[T]) Keys() ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.started {
+		return nil, ErrNotStarted
+	}
+	keys := make([]string, 0, len(r.latest))
+	for k := range r.latest {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// GetConfig gets the current configuration of the key with defaults applied to
+// it.
+func (r *NamespacedRepo[T]) GetConfig(key string) (T, error) {
+	v, err := r.GetLatestVersion(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.Config, nil
+}
+
+// GetLatestVersion returns the latest version of the configuration of the key
+// along with auditing data. Version 0 means that no configuration was ever
+// created for the key.
+func (r *NamespacedRepo[T]) GetLatestVersion(key string) (*Versioned[T], error) {
+	r.mu.RLock()
+	started, latest := r.started, r.latest[key]
+	r.mu.RUnlock()
+	if !started {
+		return nil, ErrNotStarted
+	}
+	if latest != nil {
+		// a copy, for the callers not to alter the cached version.
+		return deepCopy(latest)
+	}
+	if r.settings.requireExplicitInit {
+		return nil, ErrNotInitialized
+	}
+	cfg, err := defaultConfig[T]()
+	if err != nil {
+		return nil, err
+	}
+	return r.settings.localVersion(&Versioned[T]{Config: cfg})
+}
+
+// UpdateConfig modifies the latest configuration of the key by calling the
+// underlying `Update` method and creates a new version, as the WatchedRepo
+// does.
+func (r *NamespacedRepo[T]) UpdateConfig(ctx context.Context, key string, cmd UpdateConfigCmd[T]) (_ *Versioned[T], err error) {
+	if !r.isStarted() {
+		return nil, ErrNotStarted
+	}
+	s := r.settings
+	cmd.By = s.actorOf(ctx, cmd.By)
+	defer func(start time.Time) { s.observeUpdate(start, err) }(time.Now())
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	var newVersion *Versioned[T]
+	err = s.retryConflicts(ctxTimeout, cmd, func() error {
+		latest, err := r.findLatest(ctxTimeout, key)
+		if err != nil && !errors.Is(err, ErrConfigurationNotFound) {
+			return err
+		}
+		if newVersion, err = s.nextVersion(latest, cmd); err != nil {
+			return err
+		}
+		var prev *Versioned[T]
+		if latest != nil {
+			if prev, err = s.withDefaults(latest); err != nil {
+				return err
+			}
+		}
+		if err := s.preUpdate(ctxTimeout, prev, newVersion.Config); err != nil {
+			return err
+		}
+		return r.insert(ctxTimeout, key, newVersion)
+	})
+	if err != nil {
+		return nil, err
+	}
+	withDefaults, err := s.withDefaults(newVersion)
+	if err != nil {
+		return nil, err
+	}
+	local, err := s.localVersion(newVersion)
+	if err != nil {
+		return nil, err
+	}
+	r.apply(key, local)
+	s.postUpdate(ctx, withDefaults)
+	return withDefaults, nil
+}
+
+// ListVersionedConfigs returns the versions of the configuration of the key
+// along with auditing data, in version order (see Descending).
+func (r *NamespacedRepo[T]) ListVersionedConfigs(ctx context.Context, key string, query ListVersionedConfigsQuery) ([]*Versioned[T], error) {
+	if !r.isStarted() {
+		return nil, ErrNotStarted
+	}
+	ctxTimeout, cnl := r.settings.operationContext(ctx)
+	defer cnl()
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "_id.version", Value: sortOrder(query.Descending)}})
+	opts.SetSkip(query.Skip)
+	opts.SetLimit(query.Limit)
+	cursor, err := r.settings.configs.Find(ctxTimeout, r.settings.filter(withAuthorFilter(withMetadataFilter(bson.M{
+		"_id.key":     key,
+		"_id.version": bson.M{"$gte": query.FromVersion, "$lt": query.ToVersion},
+	}, query.Metadata), query.UpdatedBy)), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctxTimeout)
+	configs := make([]*Versioned[T], 0)
+	for cursor.Next(ctxTimeout) {
+		_, cfg, err := r.decode(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		if err := defaults.Set(cfg); err != nil {
+			return nil, fmt.Errorf("failed to set defaults: %w", err)
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, cursor.Err()
+}
+
+// apply caches the version, with defaults applied, if it is more recent than
+// the cached one of the key.
+func (r *NamespacedRepo[T]) apply(key string, v *Versioned[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if curr := r.latest[key]; curr == nil || curr.Version < v.Version {
+		r.latest[key] = v
+	}
+}
+
+func (r *NamespacedRepo[T]) createIndexes(ctx context.Context) error {
+	ctx, cnl := context.WithTimeout(ctx, indexCreateTimeout)
+	defer cnl()
+	_, err := r.settings.configs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "_id.key", Value: 1},
+			{Key: "_id.version", Value: 1},
+		},
+		Options: options.Index().SetName("idx_key_version_inc"),
+	})
+	return err
+}
+
+// loadLatest caches the latest version of every key.
+func (r *NamespacedRepo[T]) loadLatest(ctx context.Context) error {
+	ctxTimeout, cnl := r.settings.operationContext(ctx)
+	defer cnl()
+	cursor, err := r.settings.configs.Aggregate(ctxTimeout, mongo.Pipeline{
+		{{Key: "$match", Value: r.settings.filter(bson.M{})}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.key", Value: 1}, {Key: "_id.version", Value: -1}}}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$_id.key"}, {Key: "doc", Value: bson.M{"$first": "$$ROOT"}}}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$doc"}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctxTimeout)
+	for cursor.Next(ctxTimeout) {
+		key, v, err := r.decode(cursor.Current)
+		if err != nil {
+			return err
+		}
+		local, err := r.settings.localVersion(v)
+		if err != nil {
+			return err
+		}
+		r.apply(key, local)
+	}
+	return cursor.Err()
+}
+
+// findLatest returns the latest stored version of the key.
+func (r *NamespacedRepo[T]) findLatest(ctx context.Context, key string) (*Versioned[T], error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id.version", Value: -1}})
+	raw, err := r.settings.configs.FindOne(ctx, r.settings.filter(bson.M{"_id.key": key}), opts).Raw()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrConfigurationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := r.decode(raw)
+	return v, err
+}
+
+func (r *NamespacedRepo[T]) insert(ctx context.Context, key string, v *Versioned[T]) error {
+	doc, err := r.encode(key, v)
+	if err != nil {
+		return err
+	}
+	ctxTimeout, cnl := r.settings.operationContext(ctx)
+	defer cnl()
+	if _, err := r.settings.configs.InsertOne(ctxTimeout, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConcurrentUpdate
+		}
+		return fmt.Errorf("create config failed: %w", err)
+	}
+	return nil
+}
+
+// encode returns the persisted form of the version of the key: the one of the
+// WatchedRepo, with the compound _id.
+func (r *NamespacedRepo[T]) encode(key string, v *Versioned[T]) (bson.D, error) {
+	doc, err := r.settings.document(v)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := encodeDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	return replaceID(raw, namespacedID{Key: key, Version: v.Version})
+}
+
+// decode decodes a persisted version and returns its key.
+func (r *NamespacedRepo[T]) decode(raw bson.Raw) (string, *Versioned[T], error) {
+	var id namespacedID
+	if err := raw.Lookup("_id").Unmarshal(&id); err != nil {
+		return "", nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	d, err := replaceID(raw, id.Version)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	b, err := bson.Marshal(d)
+	if err != nil {
+		return "", nil, err
+	}
+	v, err := r.settings.decodeVersion(b)
+	return id.Key, v, err
+}
+
+func (r *NamespacedRepo[T]) openChangeStream(ctx context.Context) (*mongo.ChangeStream, error) {
+	return r.settings.configs.Watch(ctx, r.settings.watchPipeline(), changeStreamOptions(r.settings.topology))
+}
+
+// watch routes the new versions to their key until the context is done. After
+// a failure, it reopens the stream and reloads the latest versions, as events
+// may have been missed meanwhile.
+func (r *NamespacedRepo[T]) watch(ctx context.Context, cs *mongo.ChangeStream) {
+	lgr := r.settings.lgr
+	for {
+		r.iterateChangeStream(ctx, cs)
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(namespacedWatchRetryInterval):
+		}
+		var err error
+		if cs, err = r.openChangeStream(ctx); err != nil {
+			lgr.With("error", err).ErrorContext(ctx, "could not reopen change stream")
+			cs = nil
+			continue
+		}
+		if err := r.loadLatest(ctx); err != nil {
+			lgr.With("error", err).ErrorContext(ctx, "could not reload latest versions")
+		}
+	}
+}
+
+func (r *NamespacedRepo[T]) iterateChangeStream(ctx context.Context, cs *mongo.ChangeStream) {
+	if cs == nil {
+		return
+	}
+	lgr := r.settings.lgr
+	defer cs.Close(context.WithoutCancel(ctx))
+	for cs.Next(ctx) {
+		var dto changeStreamDto
+		if err := cs.Decode(&dto); err != nil {
+			lgr.With("error", err).ErrorContext(ctx, "error decoding change stream element")
+			continue
+		}
+		if dto.OperationType != "insert" {
+			continue
+		}
+		key, v, err := r.decode(dto.FullDocument)
+		if err != nil {
+			lgr.With("error", err).ErrorContext(ctx, "error decoding change stream element")
+			continue
+		}
+		local, err := r.settings.localVersion(v)
+		if err != nil {
+			lgr.With("error", err, "key", key).ErrorContext(ctx, "could not apply new version")
+			continue
+		}
+		r.apply(key, local)
+	}
+	if err := cs.Err(); err != nil && ctx.Err() == nil {
+		lgr.With("error", err).ErrorContext(ctx, "change stream failed")
+	}
+}
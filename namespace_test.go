@@ -0,0 +1,68 @@
+package streamingconfig
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func Test_NamespacedRepo_encode(t *testing.T) {
+	c, err := NewAESGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	v := &Versioned[*schemaConfig]{
+		Version:   3,
+		UpdatedBy: "u1",
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Metadata:  map[string]string{"env": "prod"},
+		Config:    &schemaConfig{Name: "n1", Age: 30, Nested: schemaNested{Mode: "fast"}},
+	}
+	for name, settings := range map[string]*WatchedRepo[*schemaConfig]{
+		"plaintext": {documentFilter: bson.M{"type": "app"}},
+		"encrypted": {documentFilter: bson.M{"type": "app"}, cipher: c},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := &NamespacedRepo[*schemaConfig]{settings: settings}
+			doc, err := repo.encode("tenant-a", v)
+			require.NoError(t, err)
+			b, err := bson.Marshal(doc)
+			require.NoError(t, err)
+			raw := bson.Raw(b)
+			require.Equal(t, "tenant-a", raw.Lookup("_id", "key").StringValue())
+			require.Equal(t, int64(3), raw.Lookup("_id", "version").AsInt64())
+			require.Equal(t, "app", raw.Lookup("type").StringValue())
+
+			key, decoded, err := repo.decode(raw)
+			require.NoError(t, err)
+			require.Equal(t, "tenant-a", key)
+			require.Equal(t, v, decoded)
+		})
+	}
+}
+
+func Test_NewNamespacedRepo_unsupported(t *testing.T) {
+	// the client does not connect until used.
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	args := Args{Logger: slog.Default(), DB: client.Database("test")}
+
+	_, err = NewNamespacedRepo[*schemaConfig](args)
+	require.NoError(t, err)
+	for name, opt := range map[string]func(*WatchedRepo[*schemaConfig]){
+		"environment": WithEnvironment[*schemaConfig]("prod"),
+		"audit":       WithAuditCollection[*schemaConfig]("config_audit"),
+		"webhook":     WithWebhook[*schemaConfig]("http://localhost:8080/hook"),
+		"publisher":   WithEventPublisher[*schemaConfig](&fakePublisher{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewNamespacedRepo[*schemaConfig](args, opt)
+			require.ErrorIs(t, err, ErrNotSupported)
+		})
+	}
+}
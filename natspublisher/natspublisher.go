@@ -0,0 +1,102 @@
+// Package natspublisher provides a streamingconfig.Publisher publishing the
+// new versions to NATS, optionally persisted by JetStream so that late
+// subscribers can replay the history.
+package natspublisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	config "github.com/rbroggi/streamingconfig"
+)
+
+const (
+	defaultKey = "streamingconfig"
+	// VersionHeader holds the version carried by a message.
+	VersionHeader = "Streamingconfig-Version"
+)
+
+// Conn publishes core NATS messages, e.g. a *nats.Conn.
+type Conn interface {
+	PublishMsg(m *nats.Msg) error
+}
+
+// JetStream publishes persisted messages, e.g. a jetstream.JetStream.
+type JetStream interface {
+	PublishMsg(ctx context.Context, m *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+}
+
+// Args holds the dependencies of the Publisher: exactly one of Conn and
+// JetStream must be set.
+type Args struct {
+	Conn Conn
+	// JetStream publishes the versions to a stream, which must capture the
+	// subject of the Publisher, and waits for their acknowledgement.
+	JetStream JetStream
+	// Key names the configuration in the subject `config.<key>.updated`. It
+	// defaults to "streamingconfig".
+	Key string
+}
+
+// Publisher publishes each version as JSON on the subject
+// `config.<key>.updated`, with the version in the VersionHeader header.
+//
+// When the NATS connection drops, the core NATS messages are buffered by the
+// client until it reconnects; the publications failing meanwhile are retried,
+// then reported, by the repository, whose watcher is not affected.
+type Publisher[T config.Config] struct {
+	conn    Conn
+	js      JetStream
+	key     string
+	subject string
+}
+
+// New returns a Publisher to be set with streamingconfig.WithEventPublisher.
+func New[T config.Config](args Args) (*Publisher[T], error) {
+	if (args.Conn == nil) == (args.JetStream == nil) {
+		return nil, errors.New("exactly one of nats connection and jetstream is required")
+	}
+	key := args.Key
+	if key == "" {
+		key = defaultKey
+	}
+	if strings.ContainsAny(key, " \t\r\n*>") {
+		return nil, fmt.Errorf("invalid key %q: whitespaces and wildcards are not allowed in subjects", key)
+	}
+	return &Publisher[T]{
+		conn:    args.Conn,
+		js:      args.JetStream,
+		key:     key,
+		subject: "config." + key + ".updated",
+	}, nil
+}
+
+// Subject returns the subject the versions are published on.
+func (p *Publisher[T]) Subject() string {
+	return p.subject
+}
+
+func (p *Publisher[T]) Publish(ctx context.Context, v *config.Versioned[T]) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode version %d: %w", v.Version, err)
+	}
+	version := strconv.FormatUint(v.Version, 10)
+	msg := nats.NewMsg(p.subject)
+	msg.Data = data
+	msg.Header.Set(VersionHeader, version)
+	if p.js == nil {
+		return p.conn.PublishMsg(msg)
+	}
+	// the message ID lets JetStream discard the duplicates of the retries.
+	msg.Header.Set(nats.MsgIdHdr, p.key+"-"+version)
+	_, err = p.js.PublishMsg(ctx, msg)
+	return err
+}
@@ -0,0 +1,92 @@
+package natspublisher_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/rbroggi/streamingconfig"
+	"github.com/rbroggi/streamingconfig/natspublisher"
+)
+
+type appConfig struct {
+	Name string `json:"name" default:"bobby"`
+	Age  int    `json:"age"`
+}
+
+func (a *appConfig) Update(new config.Config) error {
+	newCfg, ok := new.(*appConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	a.Name = newCfg.Name
+	a.Age = newCfg.Age
+	return nil
+}
+
+type fakeConn struct {
+	msgs []*nats.Msg
+	err  error
+}
+
+func (c *fakeConn) PublishMsg(m *nats.Msg) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.msgs = append(c.msgs, m)
+	return nil
+}
+
+type fakeJetStream struct {
+	msgs []*nats.Msg
+}
+
+func (js *fakeJetStream) PublishMsg(_ context.Context, m *nats.Msg, _ ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	js.msgs = append(js.msgs, m)
+	return &jetstream.PubAck{Stream: "CONFIG", Sequence: uint64(len(js.msgs))}, nil
+}
+
+func TestPublisher(t *testing.T) {
+	conn := &fakeConn{}
+	p, err := natspublisher.New[*appConfig](natspublisher.Args{Conn: conn, Key: "app"})
+	require.NoError(t, err)
+	require.Equal(t, "config.app.updated", p.Subject())
+	v := &config.Versioned[*appConfig]{Version: 3, UpdatedBy: "u1", Config: &appConfig{Name: "n1", Age: 30}}
+	require.NoError(t, p.Publish(context.Background(), v))
+
+	require.Len(t, conn.msgs, 1)
+	msg := conn.msgs[0]
+	require.Equal(t, "config.app.updated", msg.Subject)
+	require.Equal(t, "3", msg.Header.Get(natspublisher.VersionHeader))
+	var decoded config.Versioned[*appConfig]
+	require.NoError(t, json.Unmarshal(msg.Data, &decoded))
+	require.Equal(t, v.Config, decoded.Config)
+
+	conn.err = nats.ErrConnectionClosed
+	require.ErrorIs(t, p.Publish(context.Background(), v), nats.ErrConnectionClosed)
+}
+
+func TestPublisher_JetStream(t *testing.T) {
+	js := &fakeJetStream{}
+	p, err := natspublisher.New[*appConfig](natspublisher.Args{JetStream: js})
+	require.NoError(t, err)
+	require.NoError(t, p.Publish(context.Background(), &config.Versioned[*appConfig]{Version: 1, Config: &appConfig{}}))
+
+	require.Len(t, js.msgs, 1)
+	require.Equal(t, "config.streamingconfig.updated", js.msgs[0].Subject)
+	require.Equal(t, "streamingconfig-1", js.msgs[0].Header.Get(nats.MsgIdHdr))
+}
+
+func TestNew(t *testing.T) {
+	_, err := natspublisher.New[*appConfig](natspublisher.Args{})
+	require.Error(t, err)
+	_, err = natspublisher.New[*appConfig](natspublisher.Args{Conn: &fakeConn{}, JetStream: &fakeJetStream{}})
+	require.Error(t, err)
+	_, err = natspublisher.New[*appConfig](natspublisher.Args{Conn: &fakeConn{}, Key: "app.*"})
+	require.Error(t, err)
+}
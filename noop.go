@@ -0,0 +1,49 @@
+package streamingconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ErrNoChange is returned by the updates leaving the configuration unchanged
+// when the repository is set with WithRejectNoopUpdates.
+var ErrNoChange = errors.New("configuration unchanged")
+
+// WithRejectNoopUpdates makes the updates fail with ErrNoChange, instead of
+// creating a version, when the updated configuration is the current one, for
+// the history to only hold actual changes. The configurations are compared in
+// their JSON form with defaults applied: setting a field to its default value
+// is not a change.
+func WithRejectNoopUpdates[T Config]() func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.rejectNoopUpdates = true
+	}
+}
+
+// checkChanged returns ErrNoChange if the updated configuration is the current
+// one once defaults are applied.
+func checkChanged[T Config](current, updated T) error {
+	currentJSON, err := defaultsJSON(current)
+	if err != nil {
+		return err
+	}
+	updatedJSON, err := defaultsJSON(updated)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(currentJSON, updatedJSON) {
+		return ErrNoChange
+	}
+	return nil
+}
+
+// defaultsJSON returns the JSON encoding of the configuration with defaults
+// applied.
+func defaultsJSON[T Config](cfg T) ([]byte, error) {
+	withDefaults, err := copyAndSetDefaults(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(withDefaults)
+}
@@ -0,0 +1,40 @@
+package streamingconfig
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_operationContext(t *testing.T) {
+	repo := &WatchedRepo[*schemaConfig]{}
+	WithOperationTimeout[*schemaConfig](time.Hour)(repo)
+
+	t.Run("configured timeout", func(t *testing.T) {
+		ctx, cnl := repo.operationContext(context.Background())
+		defer cnl()
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Minute)
+	})
+	t.Run("caller deadline takes precedence", func(t *testing.T) {
+		parent, parentCnl := context.WithTimeout(context.Background(), 2*time.Hour)
+		defer parentCnl()
+		ctx, cnl := repo.operationContext(parent)
+		defer cnl()
+		want, _ := parent.Deadline()
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		require.Equal(t, want, deadline)
+	})
+}
+
+func Test_WithOperationTimeout_notPositive(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		_, err := NewWatchedRepo[*schemaConfig](Args{Logger: slog.Default()}, WithOperationTimeout[*schemaConfig](d))
+		require.ErrorIs(t, err, ErrInvalidOperationTimeout)
+	}
+}
@@ -0,0 +1,156 @@
+package streamingconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+var (
+	// ErrInvalidPatch is returned when a patch is malformed or does not result
+	// in a valid configuration representation.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPatchOperationFailed is returned when an operation of a JSON Patch
+	// cannot apply, e.g. a failing `test` operation.
+	ErrPatchOperationFailed = errors.New("patch operation failed")
+)
+
+// PatchCmd is the command to partially update the latest configuration.
+type PatchCmd struct {
+	By string
+	// MergePatch is an RFC 7386 JSON Merge Patch, e.g. `{"age":31}` changes
+	// only the age. A `null` member removes the field, which then holds its
+	// zero value and thus its default, if any.
+	MergePatch []byte
+}
+
+// PatchConfig applies a JSON Merge Patch onto the JSON representation of the
+// latest configuration, as stored, and creates a new version out of it
+// through the UpdateConfig path. It returns ErrVersionMismatch if another
+// version was created concurrently.
+func (s *WatchedRepo[T]) PatchConfig(ctx context.Context, cmd PatchCmd) (*Versioned[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	latest, err := s.latestOrNil(ctxTimeout)
+	if err != nil {
+		return nil, err
+	}
+	updateCmd, err := patchUpdateCmd(latest, cmd)
+	if err != nil {
+		return nil, err
+	}
+	return s.UpdateConfig(ctx, updateCmd)
+}
+
+// JSONPatchConfig applies an RFC 6902 JSON Patch onto the JSON representation
+// of the latest configuration, as stored, and creates a new version out of it
+// through the UpdateConfig path. The operations apply in order and the first
+// one failing, e.g. a `test` one used as precondition, aborts the update with
+// ErrPatchOperationFailed. It returns ErrVersionMismatch if another version
+// was created concurrently.
+func (s *WatchedRepo[T]) JSONPatchConfig(ctx context.Context, by string, patch []byte) (*Versioned[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	latest, err := s.latestOrNil(ctxTimeout)
+	if err != nil {
+		return nil, err
+	}
+	updateCmd, err := jsonPatchUpdateCmd(latest, by, patch)
+	if err != nil {
+		return nil, err
+	}
+	return s.UpdateConfig(ctx, updateCmd)
+}
+
+// patchUpdateCmd returns the command updating the latest version, nil if
+// none, with the merge-patched configuration.
+func patchUpdateCmd[T Config](latest *Versioned[T], cmd PatchCmd) (UpdateConfigCmd[T], error) {
+	var patch any
+	if err := json.Unmarshal(cmd.MergePatch, &patch); err != nil {
+		return UpdateConfigCmd[T]{}, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	return patchedUpdateCmd(latest, cmd.By, func(doc []byte) ([]byte, error) {
+		var target any
+		if err := json.Unmarshal(doc, &target); err != nil {
+			return nil, err
+		}
+		return json.Marshal(mergePatch(target, patch))
+	})
+}
+
+// jsonPatchUpdateCmd returns the command updating the latest version, nil if
+// none, with the JSON-patched configuration.
+func jsonPatchUpdateCmd[T Config](latest *Versioned[T], by string, patch []byte) (UpdateConfigCmd[T], error) {
+	ops, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return UpdateConfigCmd[T]{}, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	return patchedUpdateCmd(latest, by, func(doc []byte) ([]byte, error) {
+		// operations apply one by one to report the failing one.
+		for i, op := range ops {
+			path, _ := op.Path()
+			if doc, err = (jsonpatch.Patch{op}).Apply(doc); err != nil {
+				return nil, fmt.Errorf("%w: operation %d (%s %s): %w", ErrPatchOperationFailed, i, op.Kind(), path, err)
+			}
+		}
+		return doc, nil
+	})
+}
+
+// patchedUpdateCmd returns the command updating the latest version, nil if
+// none, with the configuration resulting from patching its JSON
+// representation. The command expects the latest version not to change
+// meanwhile, as the patch applies onto it.
+func patchedUpdateCmd[T Config](latest *Versioned[T], by string, apply func(doc []byte) ([]byte, error)) (UpdateConfigCmd[T], error) {
+	var expected uint64
+	doc := []byte("{}")
+	if latest != nil {
+		expected = latest.Version
+		var err error
+		if doc, err = json.Marshal(latest.Config); err != nil {
+			return UpdateConfigCmd[T]{}, err
+		}
+	}
+	patched, err := apply(doc)
+	if err != nil {
+		return UpdateConfigCmd[T]{}, err
+	}
+	cfg, err := unmarshalNew[T](patched)
+	if err != nil {
+		return UpdateConfigCmd[T]{}, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	return UpdateConfigCmd[T]{
+		By:              by,
+		Config:          cfg,
+		ExpectedVersion: &expected,
+	}, nil
+}
+
+// mergePatch applies the patch onto the target as defined by RFC 7386.
+func mergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = map[string]any{}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
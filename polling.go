@@ -0,0 +1,78 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// pollOperation is the operation type of the errors of the polling.
+const pollOperation = "poll"
+
+// WithPolling makes the watcher poll the latest version at the interval
+// instead of watching the change stream, e.g. for standalone MongoDB
+// deployments and managed databases without change streams. Each poll only
+// reads the version of the latest document, and the whole document when it is
+// more recent than the cached one.
+//
+// The versions created in between two polls are skipped: the subscriptions and
+// the update callbacks only observe the latest one. Non-positive intervals
+// leave the change stream in use.
+func WithPolling[T Config](interval time.Duration) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.pollInterval = interval
+	}
+}
+
+// pollChanges applies the latest version at every poll interval until the
+// context is done.
+func (s *WatchedRepo[T]) pollChanges(ctx context.Context, onVersion func(v *Versioned[T]) error) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for {
+			s.poll(ctx, onVersion)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return done
+}
+
+// poll applies the latest version if it is more recent than the cached one.
+func (s *WatchedRepo[T]) poll(ctx context.Context, onVersion func(v *Versioned[T]) error) {
+	stored, err := s.latestVersion(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.watchDownSince.CompareAndSwap(0, time.Now().UnixNano())
+			s.reportError(ctx, "error polling configuration", &WatchError{OperationType: pollOperation, Err: err})
+		}
+		return
+	}
+	s.watchLiveOnce.Do(func() { close(s.watchLive) })
+	s.watchDownSince.Store(0)
+	s.mu.RLock()
+	upToDate := s.cfg != nil && stored <= s.cfg.Version
+	s.mu.RUnlock()
+	if stored == 0 || upToDate {
+		return
+	}
+	latest, err := s.getLatest(ctx)
+	if errors.Is(err, ErrConfigurationNotFound) {
+		return
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			s.reportError(ctx, "error polling configuration", &WatchError{OperationType: pollOperation, Err: err})
+		}
+		return
+	}
+	if err := onVersion(latest); err != nil {
+		s.reportError(ctx, "could not apply new version", &WatchError{OperationType: pollOperation, Version: latest.Version, Err: err})
+	}
+}
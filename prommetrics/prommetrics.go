@@ -0,0 +1,135 @@
+// Package prommetrics provides a streamingconfig.MetricsRecorder exposing the
+// operations of the repositories as Prometheus metrics, giving operators
+// visibility into the configuration churn and the propagation health.
+package prommetrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	config "github.com/rbroggi/streamingconfig"
+)
+
+const namespace = "streamingconfig"
+
+// update results, set in the `result` label of the updates.
+const (
+	resultSuccess  = "success"
+	resultConflict = "conflict"
+	resultError    = "error"
+)
+
+// Recorder records the operations of the repositories with the metrics:
+//   - streamingconfig_updates_total, by `result`: "success", "conflict" for
+//     concurrent-update conflicts, or "error";
+//   - streamingconfig_update_duration_seconds;
+//   - streamingconfig_change_stream_events_total, by `operation_type`;
+//   - streamingconfig_change_stream_reconnects_total;
+//   - streamingconfig_decode_errors_total.
+type Recorder struct {
+	updates        *prometheus.CounterVec
+	updateDuration prometheus.Histogram
+	events         *prometheus.CounterVec
+	reconnects     prometheus.Counter
+	decodeErrors   prometheus.Counter
+}
+
+// New returns a Recorder whose metrics are registered with the registerer.
+// The metrics already registered, e.g. by the Recorder of another repository,
+// are shared.
+func New(reg prometheus.Registerer) (*Recorder, error) {
+	r := &Recorder{
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "updates_total",
+			Help:      "Number of configuration updates, by result.",
+		}, []string{"result"}),
+		updateDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "update_duration_seconds",
+			Help:      "Latency of the configuration updates.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "change_stream_events_total",
+			Help:      "Number of change stream events processed, by operation type.",
+		}, []string{"operation_type"}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "change_stream_reconnects_total",
+			Help:      "Number of attempts to re-open the change stream.",
+		}),
+		decodeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decode_errors_total",
+			Help:      "Number of change stream events that could not be decoded.",
+		}),
+	}
+	var err error
+	if r.updates, err = register(reg, r.updates); err != nil {
+		return nil, err
+	}
+	if r.updateDuration, err = register(reg, r.updateDuration); err != nil {
+		return nil, err
+	}
+	if r.events, err = register(reg, r.events); err != nil {
+		return nil, err
+	}
+	if r.reconnects, err = register(reg, r.reconnects); err != nil {
+		return nil, err
+	}
+	if r.decodeErrors, err = register(reg, r.decodeErrors); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// WithMetrics records the operations of the repository with a Recorder
+// registered with the registerer. It panics if the metrics cannot be
+// registered, as prometheus.MustRegister does.
+func WithMetrics[T config.Config](reg prometheus.Registerer) func(repo *config.WatchedRepo[T]) {
+	r, err := New(reg)
+	if err != nil {
+		panic(err)
+	}
+	return config.WithMetricsRecorder[T](r)
+}
+
+// register registers the collector, or returns the one already registered.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+func (r *Recorder) ObserveUpdate(latency time.Duration, err error) {
+	result := resultSuccess
+	switch {
+	case errors.Is(err, config.ErrConcurrentUpdate):
+		result = resultConflict
+	case err != nil:
+		result = resultError
+	}
+	r.updates.WithLabelValues(result).Inc()
+	r.updateDuration.Observe(latency.Seconds())
+}
+
+func (r *Recorder) ObserveEvent(operationType string) {
+	r.events.WithLabelValues(operationType).Inc()
+}
+
+func (r *Recorder) ObserveDecodeError() {
+	r.decodeErrors.Inc()
+}
+
+func (r *Recorder) ObserveReconnect() {
+	r.reconnects.Inc()
+}
@@ -0,0 +1,81 @@
+package prommetrics_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/rbroggi/streamingconfig"
+	"github.com/rbroggi/streamingconfig/prommetrics"
+)
+
+func TestRecorder(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	r, err := prommetrics.New(reg)
+	require.NoError(t, err)
+
+	r.ObserveUpdate(10*time.Millisecond, nil)
+	r.ObserveUpdate(5*time.Millisecond, config.ErrConcurrentUpdate)
+	r.ObserveUpdate(time.Millisecond, errors.New("boom"))
+	r.ObserveEvent("insert")
+	r.ObserveEvent("insert")
+	r.ObserveEvent("delete")
+	r.ObserveDecodeError()
+	r.ObserveReconnect()
+
+	count, err := testutil.GatherAndCount(reg)
+	require.NoError(t, err)
+	require.Equal(t, 8, count)
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	values := map[string]float64{}
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			name := mf.GetName()
+			for _, l := range m.GetLabel() {
+				name += "/" + l.GetValue()
+			}
+			switch {
+			case m.GetCounter() != nil:
+				values[name] = m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				values[name] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	require.Equal(t, map[string]float64{
+		"streamingconfig_updates_total/success":             1,
+		"streamingconfig_updates_total/conflict":            1,
+		"streamingconfig_updates_total/error":               1,
+		"streamingconfig_update_duration_seconds":           3,
+		"streamingconfig_change_stream_events_total/insert": 2,
+		"streamingconfig_change_stream_events_total/delete": 1,
+		"streamingconfig_change_stream_reconnects_total":    1,
+		"streamingconfig_decode_errors_total":               1,
+	}, values)
+}
+
+func TestNew_shared(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r1, err := prommetrics.New(reg)
+	require.NoError(t, err)
+	r2, err := prommetrics.New(reg)
+	require.NoError(t, err)
+
+	r1.ObserveReconnect()
+	r2.ObserveReconnect()
+	count, err := testutil.GatherAndCount(reg, "streamingconfig_change_stream_reconnects_total")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range families {
+		if mf.GetName() == "streamingconfig_change_stream_reconnects_total" {
+			require.Equal(t, float64(2), mf.GetMetric()[0].GetCounter().GetValue())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WithMaxVersions keeps at most n versions: the older ones are pruned after
+// every successful update (see PruneVersions). Pruning failures are logged and
+// do not fail the update.
+func WithMaxVersions[T Config](n int) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.maxVersions = n
+	}
+}
+
+// PruneBefore deletes the versions created before the input time, e.g. to
+// comply with a retention policy, and returns the number of deleted versions.
+// The latest version is never deleted, even when older than the input time.
+func (s *WatchedRepo[T]) PruneBefore(ctx context.Context, t time.Time) (int64, error) {
+	if err := s.checkStarted(); err != nil {
+		return 0, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return 0, err
+	}
+	if err := s.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.writes.Done()
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	latest, err := s.latestVersion(ctxTimeout)
+	if err != nil {
+		return 0, err
+	}
+	if latest == 0 {
+		return 0, nil
+	}
+	res, err := s.configs.DeleteMany(ctxTimeout, s.filter(bson.M{
+		"created_at":     bson.M{"$lt": t},
+		s.versionField(): bson.M{"$lt": latest},
+	}))
+	if err != nil {
+		return 0, fmt.Errorf("prune failed: %w", err)
+	}
+	return res.DeletedCount, nil
+}
+
+// PruneVersions deletes all the versions but the keepLast most recent ones and
+// returns the number of deleted versions. The latest version and the version
+// currently cached are never deleted.
+func (s *WatchedRepo[T]) PruneVersions(ctx context.Context, keepLast int) (int64, error) {
+	if err := s.checkStarted(); err != nil {
+		return 0, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return 0, err
+	}
+	if err := s.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.writes.Done()
+	return s.pruneVersions(ctx, keepLast)
+}
+
+func (s *WatchedRepo[T]) pruneVersions(ctx context.Context, keepLast int) (int64, error) {
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	// the oldest version to keep is the keepLast-th most recent one.
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: s.versionField(), Value: -1}}).
+		SetSkip(int64(max(keepLast, 1) - 1)).
+		SetProjection(bson.M{"_id": 1})
+	oldestKept, err := s.configs.FindOne(ctxTimeout, s.filter(bson.M{}), opts).Raw()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// there are no more than keepLast versions.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("prune failed: %w", err)
+	}
+	threshold, err := s.versionOf(oldestKept)
+	if err != nil {
+		return 0, fmt.Errorf("prune failed: %w", err)
+	}
+	s.mu.RLock()
+	if s.cfg != nil && s.cfg.Version < threshold {
+		threshold = s.cfg.Version
+	}
+	s.mu.RUnlock()
+	res, err := s.configs.DeleteMany(ctxTimeout, s.filter(bson.M{
+		s.versionField(): bson.M{"$lt": threshold},
+	}))
+	if err != nil {
+		return 0, fmt.Errorf("prune failed: %w", err)
+	}
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,117 @@
+package streamingconfig
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Publisher publishes the new versions to an event bus, e.g. Kafka (see the
+// kafkapublisher module), so that services can react to the configuration
+// changes without watching MongoDB.
+type Publisher[T Config] interface {
+	Publish(ctx context.Context, v *Versioned[T]) error
+}
+
+// PublishError is reported to the WithOnError callback when a version could
+// not be published, after retries, or was dropped (see ErrOutboxFull).
+type PublishError struct {
+	Version uint64
+	Err     error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("could not publish version %d: %v", e.Version, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// WithEventPublisher publishes each version created by the updates of the
+// repository, with defaults applied, through the publisher. Only the
+// repository creating a version publishes it: the replicas watching the
+// versions do not, for each version to be published once. The versions are
+// published in the background, in the order of the updates: failures are
+// attempted up to 5 times with an exponential backoff, then logged and
+// reported to the WithOnError callback as a *PublishError. Up to 100 versions
+// wait for publication: the next ones are dropped, and reported as a
+// *PublishError wrapping ErrOutboxFull.
+func WithEventPublisher[T Config](p Publisher[T]) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.publishers = append(repo.publishers, &eventPublisher[T]{
+			publisher:   p,
+			maxAttempts: defaultNotifyAttempts,
+			backoff:     defaultNotifyBackoff,
+			outbox:      make(chan *Versioned[T], defaultOutboxSize),
+		})
+	}
+}
+
+type eventPublisher[T Config] struct {
+	publisher   Publisher[T]
+	maxAttempts int
+	backoff     time.Duration
+	outbox      chan *Versioned[T]
+}
+
+// notifyPublishers queues the version for publication.
+func (s *WatchedRepo[T]) notifyPublishers(v *Versioned[T]) {
+	for _, p := range s.publishers {
+		select {
+		case p.outbox <- v:
+		default:
+			s.publishFailed(context.Background(), v.Version, ErrOutboxFull)
+		}
+	}
+}
+
+// runPublisher publishes the versions queued for the publisher until the
+// context is done.
+func (s *WatchedRepo[T]) runPublisher(ctx context.Context, p *eventPublisher[T]) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v := <-p.outbox:
+				err := retryWithBackoff(ctx, p.maxAttempts, p.backoff, func() (bool, error) {
+					return true, p.publisher.Publish(ctx, v)
+				})
+				if err != nil {
+					s.publishFailed(ctx, v.Version, err)
+				}
+			}
+		}
+	}()
+	return done
+}
+
+// publishFailed logs the failure to publish the version and reports it to the
+// error callback, if any.
+func (s *WatchedRepo[T]) publishFailed(ctx context.Context, version uint64, err error) {
+	s.lgr.With("error", err, "version", version).ErrorContext(ctx, "could not publish version")
+	if s.onError != nil {
+		s.onError(&PublishError{Version: version, Err: err})
+	}
+}
+
+// retryWithBackoff calls fn until it succeeds, reports a failure not worth
+// retrying or was attempted maxAttempts times, waiting between the attempts
+// for a delay starting at backoff and doubled on each retry.
+func retryWithBackoff(ctx context.Context, maxAttempts int, backoff time.Duration, fn func() (retry bool, err error)) error {
+	for attempt := 1; ; attempt++ {
+		retry, err := fn()
+		if err == nil || !retry || attempt >= maxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last attempt: %v)", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,89 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePublisher struct {
+	mu        sync.Mutex
+	failures  int
+	published []uint64
+}
+
+func (p *fakePublisher) Publish(_ context.Context, v *Versioned[*schemaConfig]) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, v.Version)
+	return nil
+}
+
+func Test_eventPublisher(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		errs   []error
+		failed = &fakePublisher{failures: 10}
+		flaky  = &fakePublisher{failures: 1}
+	)
+	repo := &WatchedRepo[*schemaConfig]{
+		lgr: slog.Default(),
+		onError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	}
+	WithEventPublisher[*schemaConfig](flaky)(repo)
+	WithEventPublisher[*schemaConfig](failed)(repo)
+	ctx, cnl := context.WithCancel(context.Background())
+	var done []<-chan struct{}
+	for _, p := range repo.publishers {
+		p.maxAttempts, p.backoff = 2, time.Millisecond
+		done = append(done, repo.runPublisher(ctx, p))
+	}
+	defer func() {
+		cnl()
+		<-allDone(done...)
+	}()
+
+	repo.notifyPublishers(&Versioned[*schemaConfig]{Version: 1, Config: &schemaConfig{}})
+	repo.notifyPublishers(&Versioned[*schemaConfig]{Version: 2, Config: &schemaConfig{}})
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		flaky.mu.Lock()
+		defer flaky.mu.Unlock()
+		require.Equal(c, []uint64{1, 2}, flaky.published)
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(c, errs, 2)
+	}, 5*time.Second, 10*time.Millisecond)
+	var publishErr *PublishError
+	require.ErrorAs(t, errs[0], &publishErr)
+	require.Equal(t, uint64(1), publishErr.Version)
+	require.Empty(t, failed.published)
+}
+
+func Test_notifyPublishers_outboxFull(t *testing.T) {
+	var errs []error
+	repo := &WatchedRepo[*schemaConfig]{lgr: slog.Default(), onError: func(err error) { errs = append(errs, err) }}
+	WithEventPublisher[*schemaConfig](&fakePublisher{})(repo)
+	repo.publishers[0].outbox = make(chan *Versioned[*schemaConfig], 1)
+	repo.notifyPublishers(&Versioned[*schemaConfig]{Version: 1, Config: &schemaConfig{}})
+	repo.notifyPublishers(&Versioned[*schemaConfig]{Version: 2, Config: &schemaConfig{}})
+	require.Equal(t, uint64(1), (<-repo.publishers[0].outbox).Version)
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], ErrOutboxFull)
+	var publishErr *PublishError
+	require.ErrorAs(t, errs[0], &publishErr)
+	require.Equal(t, uint64(2), publishErr.Version)
+}
@@ -0,0 +1,98 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	reconnectMinBackoff = 100 * time.Millisecond
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+var (
+	// errChangeStreamClosed is returned when the change stream ends without
+	// error.
+	errChangeStreamClosed = errors.New("change stream closed")
+	// errChangeStreamInvalidated is returned when the change stream ends upon an
+	// invalidate event, i.e. the collection was dropped or renamed.
+	errChangeStreamInvalidated = errors.New("change stream invalidated")
+)
+
+// Reconnects returns the number of attempts of the watcher to re-open the
+// change stream after a failure.
+func (s *WatchedRepo[T]) Reconnects() uint64 {
+	return s.reconnects.Load()
+}
+
+// watch iterates the change stream, re-opening it with an exponential backoff
+// upon failures until the context is done. Re-opened streams resume after the
+// last seen event and the latest version is re-read, in case the stream could
+// not be resumed.
+//
+// Invalidated streams, i.e. whose collection was dropped or renamed, are
+// re-opened after the invalidate event, once the indexes are re-created, and
+// the cached configuration is reconciled with the remaining versions.
+func (s *WatchedRepo[T]) watch(ctx context.Context, cs *mongo.ChangeStream, onVersion func(v *Versioned[T]) error) {
+	backoff := reconnectMinBackoff
+	for {
+		live, err := s.iterateChangeStream(ctx, cs, onVersion)
+		if ctx.Err() != nil {
+			return
+		}
+		s.watchDownSince.CompareAndSwap(0, time.Now().UnixNano())
+		invalidated := errors.Is(err, errChangeStreamInvalidated)
+		if invalidated {
+			s.lgr.WarnContext(ctx, "change stream invalidated, the configuration collection was dropped or renamed: re-opening it")
+			if !s.skipIndexOperation {
+				if err := s.createIndexes(ctx); err != nil {
+					s.lgr.With("error", err).ErrorContext(ctx, "error re-creating the indexes after invalidation")
+				}
+			}
+		} else {
+			s.reportError(ctx, "change stream failed", &WatchError{Err: err})
+		}
+		if live {
+			backoff = reconnectMinBackoff
+		}
+		token := cs.ResumeToken()
+		cs = nil
+		for cs == nil {
+			attempt := s.reconnects.Add(1)
+			s.observeReconnect()
+			wait := jitter(backoff)
+			s.lgr.With("error", err, "attempt", attempt, "backoff", wait).
+				WarnContext(ctx, "reconnecting change stream")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			backoff = min(2*backoff, reconnectMaxBackoff)
+			if invalidated && token != nil {
+				// streams cannot resume after an invalidate event, only start
+				// after it.
+				cs, err = s.configs.Watch(ctx, s.watchPipeline(), changeStreamOptions(s.topology).SetStartAfter(token))
+			} else {
+				cs, err = s.openChangeStream(ctx, token)
+			}
+		}
+		refresh := s.refresh
+		if invalidated {
+			// the versions may be gone with the collection.
+			refresh = s.reconcile
+		}
+		if err := refresh(ctx); err != nil {
+			s.lgr.With("error", err).ErrorContext(ctx, "error refreshing configuration after reconnecting")
+		}
+	}
+}
+
+// jitter returns a random duration between half and the whole input duration.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,18 @@
+package streamingconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_jitter(t *testing.T) {
+	for _, d := range []time.Duration{reconnectMinBackoff, time.Second, reconnectMaxBackoff} {
+		for i := 0; i < 100; i++ {
+			got := jitter(d)
+			assert.GreaterOrEqual(t, got, d/2)
+			assert.LessOrEqual(t, got, d)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package redisstore provides a Redis-backed streamingconfig.Store, for
+// applications already depending on Redis.
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+
+	config "github.com/rbroggi/streamingconfig"
+)
+
+const defaultKey = "streamingconfig"
+
+// rangeBatchSize is the number of versions Range reads at once.
+const rangeBatchSize = 100
+
+// insertScript stores a version unless its number is already taken, moves the
+// latest version index and notifies the watchers, atomically.
+var insertScript = redis.NewScript(`
+local latest = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) <= latest then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[2])
+redis.call('SET', KEYS[1], ARGV[1])
+redis.call('PUBLISH', KEYS[3], ARGV[2])
+return 1
+`)
+
+// Args holds the dependencies of the Store.
+type Args struct {
+	Logger *slog.Logger
+	Client redis.UniversalClient
+	// Key prefixes the keys and the channel used by the store, which
+	// defaults to "streamingconfig". It is wrapped in a hash tag, e.g.
+	// "{streamingconfig}:latest", for all the keys to share a slot of Redis
+	// Cluster.
+	Key string
+}
+
+// Store persists each version as JSON under a key of its own, and notifies the
+// watchers of the new versions through pub/sub.
+//
+// Pub/sub does not deliver the messages published while a watcher is
+// disconnected: a version missed this way is observed with the next one.
+type Store[T config.Config] struct {
+	lgr    *slog.Logger
+	client redis.UniversalClient
+	key    string
+}
+
+// New returns a Store to be set with streamingconfig.WithStore.
+func New[T config.Config](args Args) (*Store[T], error) {
+	if args.Client == nil {
+		return nil, errors.New("redis client is required")
+	}
+	key := args.Key
+	if key == "" {
+		key = defaultKey
+	}
+	return &Store[T]{
+		lgr:    args.Logger.With("struct", "redisstore.Store"),
+		client: args.Client,
+		key:    key,
+	}, nil
+}
+
+// prefix returns the hash tag of the keys: the insertion script touches
+// several of them, which Redis Cluster requires to be in the same slot.
+func (s *Store[T]) prefix() string {
+	return "{" + s.key + "}"
+}
+
+func (s *Store[T]) latestKey() string {
+	return s.prefix() + ":latest"
+}
+
+func (s *Store[T]) versionKey(version uint64) string {
+	return s.prefix() + ":versions:" + strconv.FormatUint(version, 10)
+}
+
+func (s *Store[T]) channel() string {
+	return s.prefix() + ":updates"
+}
+
+// Latest returns the version with the highest number, or
+// streamingconfig.ErrConfigurationNotFound if there is none.
+func (s *Store[T]) Latest(ctx context.Context) (*config.Versioned[T], error) {
+	latest, err := s.latestVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest == 0 {
+		return nil, config.ErrConfigurationNotFound
+	}
+	raw, err := s.client.Get(ctx, s.versionKey(latest)).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version %d: %w", latest, err)
+	}
+	return decode[T](raw)
+}
+
+// Insert stores a new version, or returns
+// streamingconfig.ErrConcurrentUpdate if its number is already taken.
+func (s *Store[T]) Insert(ctx context.Context, v *config.Versioned[T]) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode version %d: %w", v.Version, err)
+	}
+	inserted, err := insertScript.Run(ctx, s.client,
+		[]string{s.latestKey(), s.versionKey(v.Version), s.channel()},
+		v.Version, raw,
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to insert version %d: %w", v.Version, err)
+	}
+	if inserted == 0 {
+		return config.ErrConcurrentUpdate
+	}
+	return nil
+}
+
+// Range hands the versions matching the query to fn one at a time, in
+// version order, reading them by batches of rangeBatchSize.
+func (s *Store[T]) Range(ctx context.Context, query config.ListVersionedConfigsQuery, fn func(v *config.Versioned[T]) error) error {
+	latest, err := s.latestVersion(ctx)
+	if err != nil {
+		return err
+	}
+	from, to := query.FromVersion, min(query.ToVersion, latest+1)
+	skip, handed := query.Skip, int64(0)
+	for from < to {
+		// the batch is taken from the end of the range when descending.
+		lo, hi := from, to
+		if hi-lo > rangeBatchSize {
+			if query.Descending {
+				lo = hi - rangeBatchSize
+			} else {
+				hi = lo + rangeBatchSize
+			}
+		}
+		keys := make([]string, 0, hi-lo)
+		for version := lo; version < hi; version++ {
+			keys = append(keys, s.versionKey(version))
+		}
+		if query.Descending {
+			slices.Reverse(keys)
+		}
+		values, err := s.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get versions: %w", err)
+		}
+		for _, value := range values {
+			raw, ok := value.(string)
+			if !ok {
+				// version 0 and the pruned versions do not exist.
+				continue
+			}
+			v, err := decode[T]([]byte(raw))
+			if err != nil {
+				return err
+			}
+			if !v.Matches(query) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if query.Limit > 0 && handed == query.Limit {
+				return nil
+			}
+			handed++
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		if query.Descending {
+			to = lo
+		} else {
+			from = hi
+		}
+	}
+	return nil
+}
+
+// Watch delivers the versions published on the channel of the store until the
+// context is done.
+func (s *Store[T]) Watch(ctx context.Context, onVersion func(v *config.Versioned[T]) error) (<-chan struct{}, error) {
+	pubsub := s.client.Subscribe(ctx, s.channel())
+	// the subscription is only effective once confirmed.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, fmt.Errorf("error subscribing to %s: %w", s.channel(), err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				v, err := decode[T]([]byte(msg.Payload))
+				if err != nil {
+					s.lgr.With("error", err).ErrorContext(ctx, "error decoding published version")
+					continue
+				}
+				if err := onVersion(v); err != nil {
+					s.lgr.With("error", err, "version", v.Version).ErrorContext(ctx, "could not apply new version")
+				}
+			}
+		}
+	}()
+	return done, nil
+}
+
+// latestVersion returns the highest version number, or 0 if there is none.
+func (s *Store[T]) latestVersion(ctx context.Context) (uint64, error) {
+	latest, err := s.client.Get(ctx, s.latestKey()).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest version: %w", err)
+	}
+	return latest, nil
+}
+
+func decode[T config.Config](raw []byte) (*config.Versioned[T], error) {
+	var v config.Versioned[T]
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	return &v, nil
+}
@@ -0,0 +1,160 @@
+package redisstore_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/rbroggi/streamingconfig"
+	"github.com/rbroggi/streamingconfig/redisstore"
+)
+
+type appConfig struct {
+	Name string `json:"name" default:"bobby"`
+	Age  int    `json:"age"`
+}
+
+func (a *appConfig) Update(new config.Config) error {
+	newCfg, ok := new.(*appConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	a.Name = newCfg.Name
+	a.Age = newCfg.Age
+	return nil
+}
+
+func newRepo(t *testing.T, ctx context.Context, addr string) (*config.WatchedRepo[*appConfig], <-chan struct{}) {
+	t.Helper()
+	store, err := redisstore.New[*appConfig](redisstore.Args{
+		Logger: slog.Default(),
+		Client: redis.NewClient(&redis.Options{Addr: addr}),
+	})
+	require.NoError(t, err)
+	repo, err := config.NewWatchedRepo[*appConfig](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfig](store),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	return repo, done
+}
+
+func Test_Store(t *testing.T) {
+	srv := miniredis.RunT(t)
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	writer, writerDone := newRepo(t, ctx, srv.Addr())
+	reader, readerDone := newRepo(t, ctx, srv.Addr())
+
+	got, err := reader.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, &appConfig{Name: "bobby"}, got)
+
+	cV1, err := writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfig]{
+		By:     "u1",
+		Config: &appConfig{Name: "n1", Age: 1},
+	})
+	require.NoError(t, err)
+	cV2, err := writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfig]{
+		By:     "u2",
+		Config: &appConfig{Age: 2},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), cV2.Version)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		got, err := reader.GetConfig()
+		require.NoError(c, err)
+		assert.Equal(c, &appConfig{Name: "bobby", Age: 2}, got)
+	}, time.Second, 10*time.Millisecond)
+
+	v1, err := reader.GetVersion(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, cV1.Config, v1.Config)
+	require.Equal(t, "u1", v1.UpdatedBy)
+	_, err = reader.GetVersion(ctx, 3)
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+
+	page, err := reader.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+		FromVersion: 0,
+		ToVersion:   10,
+		Skip:        1,
+	})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Equal(t, uint64(2), page[0].Version)
+	// the keys share the slot of their hash tag, for Redis Cluster.
+	require.ElementsMatch(t, []string{
+		"{streamingconfig}:latest", "{streamingconfig}:versions:1", "{streamingconfig}:versions:2",
+	}, srv.Keys())
+
+	cnl()
+	for _, done := range []<-chan struct{}{writerDone, readerDone} {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("repository did not stop")
+		}
+	}
+}
+
+func Test_StoreConcurrentInsert(t *testing.T) {
+	srv := miniredis.RunT(t)
+	store, err := redisstore.New[*appConfig](redisstore.Args{
+		Logger: slog.Default(),
+		Client: redis.NewClient(&redis.Options{Addr: srv.Addr()}),
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = store.Latest(ctx)
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+	v := &config.Versioned[*appConfig]{Version: 1, Config: &appConfig{Name: "n1"}}
+	require.NoError(t, store.Insert(ctx, v))
+	require.ErrorIs(t, store.Insert(ctx, v), config.ErrConcurrentUpdate)
+	latest, err := store.Latest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, v.Config, latest.Config)
+}
+
+func Test_StoreRange(t *testing.T) {
+	srv := miniredis.RunT(t)
+	store, err := redisstore.New[*appConfig](redisstore.Args{
+		Logger: slog.Default(),
+		Client: redis.NewClient(&redis.Options{Addr: srv.Addr()}),
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	// more versions than a batch.
+	for version := uint64(1); version <= 250; version++ {
+		require.NoError(t, store.Insert(ctx, &config.Versioned[*appConfig]{Version: version, Config: &appConfig{Age: int(version)}}))
+	}
+
+	collect := func(query config.ListVersionedConfigsQuery) []uint64 {
+		var versions []uint64
+		require.NoError(t, store.Range(ctx, query, func(v *config.Versioned[*appConfig]) error {
+			versions = append(versions, v.Version)
+			return nil
+		}))
+		return versions
+	}
+	require.Len(t, collect(config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 1000}), 250)
+	require.Equal(t, []uint64{150, 151}, collect(config.ListVersionedConfigsQuery{FromVersion: 50, ToVersion: 1000, Skip: 100, Limit: 2}))
+	require.Equal(t, []uint64{148, 147}, collect(config.ListVersionedConfigsQuery{FromVersion: 50, ToVersion: 200, Skip: 51, Limit: 2, Descending: true}))
+
+	errStop := errors.New("stop")
+	var handed int
+	err = store.Range(ctx, config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 1000}, func(*config.Versioned[*appConfig]) error {
+		handed++
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 1, handed)
+}
@@ -0,0 +1,38 @@
+package streamingconfig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrWrongConfigType is returned by ReplaceUpdate when the new configuration
+// is not of the type of the updated one.
+var ErrWrongConfigType = errors.New("wrong configuration type")
+
+// ReplaceUpdate replaces all the fields of dst with the ones of src, which
+// must be of the same type, sparing the configurations the copy of each of
+// their fields in their `Update` method:
+//
+//	func (c *conf) Update(new config.Config) error {
+//		return config.ReplaceUpdate(c, new)
+//	}
+//
+// The configurations still validate themselves by implementing Validator.
+// Configurations of value types are left untouched, as their `Update` method
+// cannot modify them.
+func ReplaceUpdate[T Config](dst T, src Config) error {
+	newCfg, ok := src.(T)
+	if !ok {
+		return fmt.Errorf("%w: got %T, want %T", ErrWrongConfigType, src, dst)
+	}
+	if !isPointer[T]() {
+		return nil
+	}
+	newValue := reflect.ValueOf(newCfg)
+	if newValue.IsNil() {
+		return fmt.Errorf("%w: got nil %T", ErrWrongConfigType, src)
+	}
+	reflect.ValueOf(dst).Elem().Set(newValue.Elem())
+	return nil
+}
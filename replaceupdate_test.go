@@ -0,0 +1,21 @@
+package streamingconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReplaceUpdate(t *testing.T) {
+	cfg := &schemaConfig{Name: "bobby", Age: 30, Nested: schemaNested{Mode: "fast"}}
+	require.NoError(t, ReplaceUpdate(cfg, &schemaConfig{Age: 31}))
+	require.Equal(t, &schemaConfig{Age: 31}, cfg)
+
+	require.ErrorIs(t, ReplaceUpdate(cfg, valueConfig{Name: "bobby"}), ErrWrongConfigType)
+	require.ErrorIs(t, ReplaceUpdate(cfg, (*schemaConfig)(nil)), ErrWrongConfigType)
+	require.Equal(t, &schemaConfig{Age: 31}, cfg)
+
+	value := valueConfig{Name: "bobby"}
+	require.NoError(t, ReplaceUpdate(value, valueConfig{Name: "tom"}))
+	require.ErrorIs(t, ReplaceUpdate(value, cfg), ErrWrongConfigType)
+}
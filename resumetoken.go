@@ -0,0 +1,118 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ResumeTokenStore persists the resume token of the change stream, so that
+// the watcher resumes where it left off, e.g. across restarts.
+type ResumeTokenStore interface {
+	// LoadResumeToken returns the last saved token, nil if none was saved.
+	LoadResumeToken(ctx context.Context) (bson.Raw, error)
+	// SaveResumeToken is called after every change stream event.
+	SaveResumeToken(ctx context.Context, token bson.Raw) error
+}
+
+// WithResumeTokenStore makes the watcher save the resume token of every event
+// and resume after the saved token when started, so that no event is missed
+// in between. The saved token takes precedence over WithWatchStartAtTime: the
+// repository starts from the latest version, the versions inserted since the
+// token included, which the WithOnStart hook is invoked with, and the update
+// callbacks are only invoked for the versions inserted afterwards.
+//
+// The change stream must still hold the events since that token (see the
+// oplog window of the deployment); otherwise the token is ignored, with a
+// warning.
+func WithResumeTokenStore[T Config](store ResumeTokenStore) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.resumeTokens = store
+	}
+}
+
+// MongoResumeTokenStore saves the resume token in a document of a collection.
+type MongoResumeTokenStore struct {
+	coll *mongo.Collection
+	id   string
+}
+
+// NewMongoResumeTokenStore returns a store saving the token in the document
+// with the input id. Repositories that do not share their watcher must use
+// distinct ids.
+func NewMongoResumeTokenStore(coll *mongo.Collection, id string) *MongoResumeTokenStore {
+	return &MongoResumeTokenStore{coll: coll, id: id}
+}
+
+type resumeTokenDocument struct {
+	ID    string   `bson:"_id"`
+	Token bson.Raw `bson:"token"`
+}
+
+func (m *MongoResumeTokenStore) LoadResumeToken(ctx context.Context) (bson.Raw, error) {
+	ctxTimeout, cnl := context.WithTimeout(ctx, defaultOperationTimeout)
+	defer cnl()
+	var doc resumeTokenDocument
+	err := m.coll.FindOne(ctxTimeout, bson.M{"_id": m.id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+func (m *MongoResumeTokenStore) SaveResumeToken(ctx context.Context, token bson.Raw) error {
+	ctxTimeout, cnl := context.WithTimeout(ctx, defaultOperationTimeout)
+	defer cnl()
+	_, err := m.coll.ReplaceOne(
+		ctxTimeout,
+		bson.M{"_id": m.id},
+		resumeTokenDocument{ID: m.id, Token: token},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// openChangeStream watches the configurations, resuming after the input
+// token, or else after the saved token if any.
+func (s *WatchedRepo[T]) openChangeStream(ctx context.Context, token bson.Raw) (*mongo.ChangeStream, error) {
+	opts := changeStreamOptions(s.topology)
+	if !s.watchStartAt.IsZero() {
+		opts.SetStartAtOperationTime(&primitive.Timestamp{T: uint32(s.watchStartAt.Unix())})
+	}
+	if token == nil && s.resumeTokens != nil {
+		var err error
+		if token, err = s.resumeTokens.LoadResumeToken(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if token == nil {
+		return s.configs.Watch(ctx, s.watchPipeline(), opts)
+	}
+	resumeOpts := changeStreamOptions(s.topology).SetResumeAfter(token)
+	cs, err := s.configs.Watch(ctx, s.watchPipeline(), resumeOpts)
+	if err == nil {
+		return cs, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	s.lgr.With("error", err).WarnContext(ctx, "could not resume after the token, watching without it")
+	return s.configs.Watch(ctx, s.watchPipeline(), opts)
+}
+
+// saveResumeToken saves the token of the current event, if enabled.
+func (s *WatchedRepo[T]) saveResumeToken(ctx context.Context, cs *mongo.ChangeStream) {
+	if s.resumeTokens == nil {
+		return
+	}
+	if err := s.resumeTokens.SaveResumeToken(ctx, cs.ResumeToken()); err != nil {
+		s.lgr.With("error", err).ErrorContext(ctx, "could not save resume token")
+	}
+}
@@ -0,0 +1,55 @@
+package streamingconfig
+
+import (
+	"context"
+	"fmt"
+)
+
+// RollbackCmd identifies the version to roll back to.
+type RollbackCmd[T Config] struct {
+	By        string
+	ToVersion uint64
+}
+
+// Rollback creates a new version holding the configuration of a previous one:
+// history is never rewritten. The configuration goes through the `Update`
+// method and the validations as UpdateConfig does, and ErrConcurrentUpdate is
+// returned likewise. ErrConfigurationNotFound is returned if the target
+// version does not exist.
+func (s *WatchedRepo[T]) Rollback(ctx context.Context, cmd RollbackCmd[T]) (*Versioned[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	target, err := s.findVersion(ctx, cmd.ToVersion)
+	if err != nil {
+		return nil, fmt.Errorf("could not load version %d: %w", cmd.ToVersion, err)
+	}
+	return s.UpdateConfig(ctx, UpdateConfigCmd[T]{
+		By:     cmd.By,
+		Config: target.Config,
+	})
+}
+
+// ResetToDefaults creates a new version holding the configuration only made of
+// the `default` tags, e.g. to recover from a series of bad changes without
+// picking a version to roll back to. As Rollback does, it keeps the history
+// and goes through the `Update` method and the validations, failing if the
+// default configuration is not valid.
+func (s *WatchedRepo[T]) ResetToDefaults(ctx context.Context, by string) (*Versioned[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	defaults, err := defaultConfig[T]()
+	if err != nil {
+		return nil, fmt.Errorf("could not build the default configuration: %w", err)
+	}
+	v, err := s.UpdateConfig(ctx, UpdateConfigCmd[T]{
+		By:     by,
+		Config: defaults,
+		Reason: "reset to defaults",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not reset to defaults: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,356 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	scheduledCollectionSuffix = "_scheduled"
+	applyAtField              = "apply_at"
+	expectedVersionField      = "expected_version"
+	// scheduledUpdateField holds the update, in the persisted form of a
+	// version, so that it is encrypted and scoped as the versions are.
+	scheduledUpdateField = "update"
+	// claimedUntilField holds the end of the lease of the repository applying
+	// the update.
+	claimedUntilField = "claimed_until"
+	// scheduleClaimDuration is the lease of the repository applying an update,
+	// after which the others may apply it, e.g. once it crashed.
+	scheduleClaimDuration = time.Minute
+)
+
+var (
+	// ErrScheduledUpdateNotFound is returned when cancelling a scheduled
+	// update that does not exist, e.g. because it was already applied.
+	ErrScheduledUpdateNotFound = errors.New("scheduled update not found")
+	// ErrInvalidScheduleInterval is returned by the constructor of the repo
+	// when the interval of WithScheduledUpdates is not positive.
+	ErrInvalidScheduleInterval = errors.New("schedule check interval must be positive")
+)
+
+// ScheduledUpdate is an update waiting for its application time.
+type ScheduledUpdate[T Config] struct {
+	// ID identifies the scheduled update, e.g. to cancel it. The IDs are never
+	// reused.
+	ID        string
+	ApplyAt   time.Time
+	CreatedAt time.Time
+	Cmd       UpdateConfigCmd[T]
+}
+
+// WithScheduledUpdates enables the scheduled updates (see ScheduleUpdate):
+// the repository creates the `<collection>_scheduled` collection and its
+// index at Start, and looks for the scheduled updates that are due, to apply
+// them, at every interval, which must be positive. Otherwise, the scheduled
+// updates are disabled and the collection is left untouched: the operations
+// on the scheduled updates return ErrNotSupported.
+//
+// It only applies to the repositories relying on MongoDB.
+func WithScheduledUpdates[T Config](interval time.Duration) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.scheduledUpdates = true
+		repo.scheduleCheckInterval = interval
+	}
+}
+
+// scheduledOnly returns ErrNotSupported unless the scheduled updates are
+// enabled with WithScheduledUpdates.
+func (s *WatchedRepo[T]) scheduledOnly() error {
+	if s.scheduled == nil {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+// ScheduleUpdate stores the update to be applied, as UpdateConfig does, once
+// applyAt is past, e.g. to roll out a change during a maintenance window. The
+// update is stored aside of the versions: GetConfig and the listings ignore it
+// until it is applied. The configuration is validated on schedule and once
+// again on application, when ExpectedVersion is checked too; an update failing
+// then is logged and dropped, unless the failure is transient, e.g. a
+// concurrent update, in which case it is retried.
+//
+// The scheduled updates are applied by any of the started repositories
+// sharing the collection, within the interval set with WithScheduledUpdates,
+// unless which ErrNotSupported is returned. The repository applying an update holds it for a
+// minute, after which the others apply it if it is still there, e.g. because
+// the repository crashed: an update is thus applied at least once, and twice
+// if the repository crashed between creating the version and removing the
+// update.
+func (s *WatchedRepo[T]) ScheduleUpdate(ctx context.Context, cmd UpdateConfigCmd[T], applyAt time.Time) (*ScheduledUpdate[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	if err := s.scheduledOnly(); err != nil {
+		return nil, err
+	}
+	cmd.By = s.actorOf(ctx, cmd.By)
+	validateCmd := cmd
+	validateCmd.ExpectedVersion = nil
+	if err := s.ValidateConfig(ctx, validateCmd); err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	scheduled := &ScheduledUpdate[T]{
+		ID:        primitive.NewObjectID().Hex(),
+		ApplyAt:   applyAt.UTC(),
+		CreatedAt: s.now(),
+		Cmd:       cmd,
+	}
+	doc, err := s.scheduledDocument(scheduled)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.scheduled.InsertOne(ctxTimeout, doc); err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+// ListScheduled returns the updates waiting for their application time, in
+// application order.
+func (s *WatchedRepo[T]) ListScheduled(ctx context.Context) ([]*ScheduledUpdate[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	if err := s.scheduledOnly(); err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	opts := options.Find().SetSort(scheduledOrder)
+	cursor, err := s.scheduled.Find(ctxTimeout, s.filter(bson.M{}), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctxTimeout)
+	updates := make([]*ScheduledUpdate[T], 0)
+	for cursor.Next(ctxTimeout) {
+		scheduled, err := s.decodeScheduled(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, scheduled)
+	}
+	return updates, cursor.Err()
+}
+
+// CancelScheduled removes the scheduled update so that it is never applied.
+// ErrScheduledUpdateNotFound is returned if it does not exist, e.g. because it
+// was already applied.
+func (s *WatchedRepo[T]) CancelScheduled(ctx context.Context, id string) error {
+	if err := s.checkStarted(); err != nil {
+		return err
+	}
+	if err := s.scheduledOnly(); err != nil {
+		return err
+	}
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("scheduled update %s: %w", id, ErrScheduledUpdateNotFound)
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	res, err := s.scheduled.DeleteOne(ctxTimeout, s.filter(bson.M{"_id": oid}))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("scheduled update %s: %w", id, ErrScheduledUpdateNotFound)
+	}
+	return nil
+}
+
+// scheduledOrder is the application order of the scheduled updates.
+var scheduledOrder = bson.D{{Key: applyAtField, Value: 1}, {Key: "_id", Value: 1}}
+
+// applyScheduled periodically applies the scheduled updates that are due.
+func (s *WatchedRepo[T]) applyScheduled(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.scheduleCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			s.applyDueUpdates(ctx)
+		}
+	}()
+	return done
+}
+
+// applyDueUpdates applies, in application order, the scheduled updates that
+// are due. Each update is claimed for a lease, so that the repositories
+// sharing the collection apply it once, and removed once applied.
+func (s *WatchedRepo[T]) applyDueUpdates(ctx context.Context) {
+	for ctx.Err() == nil {
+		raw, err := s.claimDueUpdate(ctx)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		if err != nil {
+			s.lgr.With("error", err).ErrorContext(ctx, "could not claim scheduled update")
+			return
+		}
+		scheduled, err := s.decodeScheduled(raw)
+		if err != nil {
+			s.lgr.With("error", err).ErrorContext(ctx, "could not decode scheduled update, dropping it")
+			s.removeScheduled(context.WithoutCancel(ctx), raw)
+			continue
+		}
+		_, err = s.UpdateConfig(ctx, scheduled.Cmd)
+		switch {
+		case err == nil:
+			s.lgr.With("scheduledID", scheduled.ID).InfoContext(ctx, "applied scheduled update")
+			s.removeScheduled(context.WithoutCancel(ctx), raw)
+		case isTransientScheduleError(ctx, err):
+			// the update is retried, by this repository at the next check or
+			// by the others.
+			s.lgr.With("error", err, "scheduledID", scheduled.ID).
+				WarnContext(ctx, "could not apply scheduled update, retrying it")
+			s.releaseUpdate(context.WithoutCancel(ctx), raw)
+			return
+		default:
+			s.lgr.With("error", err, "scheduledID", scheduled.ID).
+				ErrorContext(ctx, "could not apply scheduled update, dropping it")
+			s.removeScheduled(context.WithoutCancel(ctx), raw)
+		}
+	}
+}
+
+// isTransientScheduleError reports whether the scheduled update may apply
+// once retried.
+func isTransientScheduleError(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, ErrStopped) || errors.Is(err, ErrConcurrentUpdate) ||
+		mongo.IsNetworkError(err) || mongo.IsTimeout(err)
+}
+
+// claimDueUpdate claims the first due update that no repository holds.
+func (s *WatchedRepo[T]) claimDueUpdate(ctx context.Context) (bson.Raw, error) {
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	now := s.nowFunc()
+	filter := s.filter(bson.M{
+		applyAtField: bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{claimedUntilField: bson.M{"$exists": false}},
+			bson.M{claimedUntilField: bson.M{"$lte": now}},
+		},
+	})
+	update := bson.M{"$set": bson.M{claimedUntilField: now.Add(scheduleClaimDuration)}}
+	opts := options.FindOneAndUpdate().SetSort(scheduledOrder)
+	return s.scheduled.FindOneAndUpdate(ctxTimeout, filter, update, opts).Raw()
+}
+
+// releaseUpdate gives up the lease of a claimed update that could not be
+// applied. If it fails, the update is released once the lease expires.
+func (s *WatchedRepo[T]) releaseUpdate(ctx context.Context, raw bson.Raw) {
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	_, err := s.scheduled.UpdateOne(ctxTimeout,
+		bson.M{"_id": raw.Lookup("_id")},
+		bson.M{"$unset": bson.M{claimedUntilField: ""}},
+	)
+	if err != nil {
+		s.lgr.With("error", err).ErrorContext(ctx, "could not release scheduled update")
+	}
+}
+
+// removeScheduled removes a claimed update once applied or dropped.
+func (s *WatchedRepo[T]) removeScheduled(ctx context.Context, raw bson.Raw) {
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	if _, err := s.scheduled.DeleteOne(ctxTimeout, bson.M{"_id": raw.Lookup("_id")}); err != nil {
+		s.lgr.With("error", err).ErrorContext(ctx, "could not remove scheduled update")
+	}
+}
+
+// scheduledDocument returns the persisted form of the scheduled update: the
+// update in the form of a version, with its application time. The document
+// filter is set on the update as well, to scope the queries.
+func (s *WatchedRepo[T]) scheduledDocument(scheduled *ScheduledUpdate[T]) (bson.D, error) {
+	id, err := primitive.ObjectIDFromHex(scheduled.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scheduled update ID %q: %w", scheduled.ID, err)
+	}
+	doc, err := s.document(&Versioned[T]{
+		UpdatedBy: scheduled.Cmd.By,
+		CreatedAt: scheduled.CreatedAt,
+		Reason:    scheduled.Cmd.Reason,
+		Tags:      scheduled.Cmd.Tags,
+		Metadata:  scheduled.Cmd.Metadata,
+		Config:    scheduled.Cmd.Config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw, err := encodeDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	d := bson.D{
+		{Key: "_id", Value: id},
+		{Key: scheduledUpdateField, Value: raw},
+		{Key: applyAtField, Value: scheduled.ApplyAt},
+	}
+	if scheduled.Cmd.ExpectedVersion != nil {
+		d = append(d, bson.E{Key: expectedVersionField, Value: *scheduled.Cmd.ExpectedVersion})
+	}
+	for k, v := range s.documentFilter {
+		d = append(d, bson.E{Key: k, Value: v})
+	}
+	return d, nil
+}
+
+func (s *WatchedRepo[T]) decodeScheduled(raw bson.Raw) (*ScheduledUpdate[T], error) {
+	oid, ok := raw.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return nil, errors.New("failed to decode scheduled update: invalid id")
+	}
+	update, ok := raw.Lookup(scheduledUpdateField).DocumentOK()
+	if !ok {
+		return nil, errors.New("failed to decode scheduled update: missing update")
+	}
+	v, err := s.decodeVersion(update)
+	if err != nil {
+		return nil, err
+	}
+	applyAt, ok := raw.Lookup(applyAtField).TimeOK()
+	if !ok {
+		return nil, errors.New("failed to decode scheduled update: invalid application time")
+	}
+	scheduled := &ScheduledUpdate[T]{
+		ID:        oid.Hex(),
+		ApplyAt:   applyAt.UTC(),
+		CreatedAt: v.CreatedAt,
+		Cmd: UpdateConfigCmd[T]{
+			By:       v.UpdatedBy,
+			Config:   v.Config,
+			Reason:   v.Reason,
+			Metadata: v.Metadata,
+			Tags:     v.Tags,
+		},
+	}
+	if expected, err := raw.LookupErr(expectedVersionField); err == nil {
+		version, ok := expected.AsInt64OK()
+		if !ok {
+			return nil, errors.New("failed to decode scheduled update: invalid expected version")
+		}
+		expectedVersion := uint64(version)
+		scheduled.Cmd.ExpectedVersion = &expectedVersion
+	}
+	return scheduled, nil
+}
@@ -0,0 +1,106 @@
+package streamingconfig
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func Test_scheduledDocument(t *testing.T) {
+	c, err := NewAESGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	expected := uint64(7)
+	scheduled := &ScheduledUpdate[*schemaConfig]{
+		ID:        primitive.NewObjectID().Hex(),
+		ApplyAt:   time.Date(2024, 1, 2, 22, 0, 0, 0, time.UTC),
+		CreatedAt: time.Date(2024, 1, 1, 3, 4, 5, 0, time.UTC),
+		Cmd: UpdateConfigCmd[*schemaConfig]{
+			By:              "u1",
+			Config:          &schemaConfig{Name: "n1", Age: 30},
+			Reason:          "maintenance window",
+			Metadata:        map[string]string{"ticket": "OPS-1"},
+			ExpectedVersion: &expected,
+		},
+	}
+	for name, repo := range map[string]*WatchedRepo[*schemaConfig]{
+		"plaintext":   {documentFilter: bson.M{"type": "app"}},
+		"encrypted":   {documentFilter: bson.M{"type": "app"}, cipher: c},
+		"environment": {documentFilter: bson.M{"type": "app"}, environment: "prod"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo.scopeToEnvironment()
+			doc, err := repo.scheduledDocument(scheduled)
+			require.NoError(t, err)
+			b, err := bson.Marshal(doc)
+			require.NoError(t, err)
+			raw := bson.Raw(b)
+			require.Equal(t, "app", raw.Lookup("type").StringValue())
+			require.Equal(t, scheduled.ApplyAt, raw.Lookup(applyAtField).Time().UTC())
+			require.Equal(t, scheduled.ID, raw.Lookup("_id").ObjectID().Hex())
+
+			decoded, err := repo.decodeScheduled(raw)
+			require.NoError(t, err)
+			require.Equal(t, scheduled, decoded)
+		})
+	}
+}
+
+func Test_decodeScheduled_invalid(t *testing.T) {
+	repo := &WatchedRepo[*schemaConfig]{}
+	doc, err := repo.document(&Versioned[*schemaConfig]{
+		Version:   3,
+		UpdatedBy: "u1",
+		CreatedAt: time.Date(2024, 1, 1, 3, 4, 5, 0, time.UTC),
+		Config:    &schemaConfig{Name: "n1"},
+	})
+	require.NoError(t, err)
+	raw, err := encodeDocument(doc)
+	require.NoError(t, err)
+	var d bson.D
+	require.NoError(t, bson.Unmarshal(raw, &d))
+	b, err := bson.Marshal(append(d, bson.E{Key: applyAtField, Value: time.Now()}))
+	require.NoError(t, err)
+
+	_, err = repo.decodeScheduled(b)
+	require.Error(t, err)
+}
+
+func Test_WithScheduledUpdates(t *testing.T) {
+	// the client does not connect until used.
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:27017"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	args := Args{Logger: slog.Default(), DB: client.Database("test")}
+	scheduledIndex := func(s *WatchedRepo[*schemaConfig]) bool {
+		for _, idx := range s.indexes() {
+			if idx.coll == s.scheduled {
+				return true
+			}
+		}
+		return false
+	}
+
+	s, err := NewWatchedRepo[*schemaConfig](args)
+	require.NoError(t, err)
+	require.Nil(t, s.scheduled)
+	require.False(t, scheduledIndex(s))
+	require.ErrorIs(t, s.scheduledOnly(), ErrNotSupported)
+
+	s, err = NewWatchedRepo[*schemaConfig](args, WithScheduledUpdates[*schemaConfig](time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "config_scheduled", s.scheduled.Name())
+	require.True(t, scheduledIndex(s))
+	require.NoError(t, s.scheduledOnly())
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		_, err = NewWatchedRepo[*schemaConfig](args, WithScheduledUpdates[*schemaConfig](interval))
+		require.ErrorIs(t, err, ErrInvalidScheduleInterval)
+	}
+}
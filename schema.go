@@ -0,0 +1,121 @@
+package streamingconfig
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// GenerateJSONSchema generates the JSON Schema describing the JSON
+// representation of the configuration type, e.g. to render edit forms or to
+// validate configurations before submitting them. The allowed values of the
+// fields carrying an `enum` tag are exposed through the `enum` keyword.
+func GenerateJSONSchema[T Config]() ([]byte, error) {
+	var zero T
+	schema := typeSchema(reflect.TypeOf(zero), map[reflect.Type]bool{})
+	schema["$schema"] = jsonSchemaDialect
+	return json.Marshal(schema)
+}
+
+// typeSchema returns the schema of the JSON representation of the type.
+// Visiting holds the struct types being generated to stop on recursive types.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// the representation is only known at runtime.
+		return map[string]any{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// byte slices are base64-encoded.
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]any{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		properties := map[string]any{}
+		structProperties(t, visiting, properties)
+		return map[string]any{"type": "object", "properties": properties}
+	default:
+		return map[string]any{}
+	}
+}
+
+// structProperties adds the schema of every serialized field of the struct to
+// properties, promoting the fields of embedded structs.
+func structProperties(t reflect.Type, visiting map[reflect.Type]bool, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			structProperties(embedded, visiting, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		schema := typeSchema(field.Type, visiting)
+		if allowed, ok := field.Tag.Lookup(enumTag); ok {
+			schema["enum"] = enumValues(strings.Split(allowed, ","), schema["type"] == "string")
+		}
+		properties[name] = schema
+	}
+}
+
+// enumValues returns the JSON values of the allowed values of an `enum` tag.
+// Unless the field is a string, values are parsed as JSON, and values that are
+// not valid JSON (e.g. `DEBUG` for a slog.Level) are strings.
+func enumValues(allowed []string, isString bool) []any {
+	values := make([]any, 0, len(allowed))
+	for _, a := range allowed {
+		var v any
+		if isString || json.Unmarshal([]byte(a), &v) != nil {
+			v = a
+		}
+		values = append(values, v)
+	}
+	return values
+}
@@ -0,0 +1,52 @@
+package streamingconfig_test
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	config "github.com/rbroggi/streamingconfig"
+
+	"github.com/stretchr/testify/require"
+)
+
+type schemaConfig struct {
+	LogLevel slog.Level        `json:"logLevel" enum:"DEBUG,INFO,WARN,ERROR"`
+	Mode     string            `json:"mode" enum:"fast,safe"`
+	Retries  int               `json:"retries" enum:"1,3,5"`
+	Enabled  bool              `json:"enabled"`
+	Ratio    float64           `json:"ratio"`
+	At       time.Time         `json:"at"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Nested   *nestedSchema     `json:"nested"`
+	Ignored  string            `json:"-"`
+}
+
+type nestedSchema struct {
+	Counter int `json:"counter"`
+}
+
+func (c *schemaConfig) Update(config.Config) error {
+	return nil
+}
+
+func Test_GenerateJSONSchema(t *testing.T) {
+	b, err := config.GenerateJSONSchema[*schemaConfig]()
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"logLevel": {"enum": ["DEBUG", "INFO", "WARN", "ERROR"]},
+			"mode": {"type": "string", "enum": ["fast", "safe"]},
+			"retries": {"type": "integer", "enum": [1, 3, 5]},
+			"enabled": {"type": "boolean"},
+			"ratio": {"type": "number"},
+			"at": {"type": "string", "format": "date-time"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"nested": {"type": "object", "properties": {"counter": {"type": "integer"}}}
+		}
+	}`, string(b))
+}
@@ -0,0 +1,86 @@
+package streamingconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const jsonSchemaResource = "config.schema.json"
+
+// ErrSchemaViolation is returned when the configuration provided to
+// UpdateConfig does not validate against the schema set with WithJSONSchema.
+var ErrSchemaViolation = errors.New("schema violation")
+
+// WithJSONSchema validates the JSON representation of the configurations
+// provided to UpdateConfig against the input JSON Schema before persisting
+// them, e.g. when they are edited through a generic UI. It catches the
+// structural problems that neither the type nor the `Update` method cover,
+// such as numbers out of range or missing properties. Every violation is
+// reported with the JSON pointer of the offending value. An invalid schema
+// makes the repository constructor fail.
+func WithJSONSchema[T Config](schema []byte) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.rawJSONSchema = schema
+	}
+}
+
+// compileJSONSchema compiles the schema set with WithJSONSchema, if any.
+func (s *WatchedRepo[T]) compileJSONSchema() error {
+	if s.rawJSONSchema == nil {
+		return nil
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(jsonSchemaResource, bytes.NewReader(s.rawJSONSchema)); err != nil {
+		return fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	schema, err := compiler.Compile(jsonSchemaResource)
+	if err != nil {
+		return fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	s.jsonSchema = schema
+	return nil
+}
+
+// validateJSONSchema validates the JSON representation of the configuration
+// against the schema set with WithJSONSchema, if any, and returns an error per
+// violation.
+func (s *WatchedRepo[T]) validateJSONSchema(cfg T) error {
+	if s.jsonSchema == nil {
+		return nil
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	err = s.jsonSchema.Validate(doc)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+	return errors.Join(schemaViolations(validationErr)...)
+}
+
+// schemaViolations returns the leaves of the validation error tree, which are
+// the actual violations.
+func schemaViolations(err *jsonschema.ValidationError) []error {
+	if len(err.Causes) == 0 {
+		location := err.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []error{fmt.Errorf("%s: %w: %s", location, ErrSchemaViolation, err.Message)}
+	}
+	var errs []error
+	for _, cause := range err.Causes {
+		errs = append(errs, schemaViolations(cause)...)
+	}
+	return errs
+}
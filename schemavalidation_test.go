@@ -0,0 +1,74 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type schemaConfig struct {
+	Name   string       `json:"name"`
+	Age    int          `json:"age"`
+	Nested schemaNested `json:"nested"`
+}
+
+type schemaNested struct {
+	Mode string `json:"mode"`
+}
+
+func (c *schemaConfig) Update(new Config) error {
+	newCfg, ok := new.(*schemaConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	*c = *newCfg
+	return nil
+}
+
+const testJSONSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0, "maximum": 150},
+		"nested": {
+			"type": "object",
+			"properties": {"mode": {"enum": ["fast", "safe"]}}
+		}
+	}
+}`
+
+func Test_WithJSONSchema(t *testing.T) {
+	repo, err := NewInMemoryRepo[*schemaConfig](WithJSONSchema[*schemaConfig]([]byte(testJSONSchema)))
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = repo.Start(ctx)
+	require.NoError(t, err)
+
+	t.Run("valid config", func(t *testing.T) {
+		_, err := repo.UpdateConfig(ctx, UpdateConfigCmd[*schemaConfig]{
+			By:     "u1",
+			Config: &schemaConfig{Name: "n1", Age: 30, Nested: schemaNested{Mode: "fast"}},
+		})
+		require.NoError(t, err)
+	})
+	t.Run("violations are all reported", func(t *testing.T) {
+		_, err := repo.UpdateConfig(ctx, UpdateConfigCmd[*schemaConfig]{
+			By:     "u1",
+			Config: &schemaConfig{Age: 200, Nested: schemaNested{Mode: "slow"}},
+		})
+		require.ErrorIs(t, err, ErrSchemaViolation)
+		require.ErrorContains(t, err, "/name: schema violation")
+		require.ErrorContains(t, err, "/age: schema violation")
+		require.ErrorContains(t, err, "/nested/mode: schema violation")
+		latest, err := repo.GetLatestVersion()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), latest.Version)
+	})
+	t.Run("invalid schema", func(t *testing.T) {
+		_, err := NewInMemoryRepo[*schemaConfig](WithJSONSchema[*schemaConfig]([]byte(`{"type": 1}`)))
+		require.ErrorContains(t, err, "invalid JSON schema")
+	})
+}
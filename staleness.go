@@ -0,0 +1,124 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WithStalenessCheck periodically verifies that the cached configuration is
+// not behind the stored one (see VerifyCacheFresh). When the cache is found
+// stale at the same version on two consecutive checks, i.e. the watcher did not
+// catch up within one interval, a warning is logged and the latest version is
+// re-read from the database.
+func WithStalenessCheck[T Config](interval time.Duration) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.stalenessCheckInterval = interval
+	}
+}
+
+// VerifyCacheFresh compares the version of the cached configuration with the
+// latest stored version, reading only the version of the latest stored
+// document. The cache is stale when the stored version is ahead of the cached
+// one, which happens shortly after every update (the watcher being eventually
+// consistent) but must not last.
+func (s *WatchedRepo[T]) VerifyCacheFresh(ctx context.Context) (stale bool, storedVersion, cachedVersion uint64, err error) {
+	if err := s.checkStarted(); err != nil {
+		return false, 0, 0, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return false, 0, 0, err
+	}
+	s.mu.RLock()
+	cachedVersion = s.cfg.Version
+	s.mu.RUnlock()
+	storedVersion, err = s.latestVersion(ctx)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return storedVersion > cachedVersion, storedVersion, cachedVersion, nil
+}
+
+// latestVersion returns the latest stored version, 0 if none.
+func (s *WatchedRepo[T]) latestVersion(ctx context.Context) (uint64, error) {
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: s.versionField(), Value: -1}}).
+		SetProjection(bson.M{"_id": 1})
+	raw, err := s.configs.FindOne(ctxTimeout, s.filter(bson.M{}), opts).Raw()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return s.versionOf(raw)
+}
+
+// ReloadLatest re-reads the latest stored version and applies it if it is more
+// recent than the cached one, independently of the watcher, e.g. as a manual
+// recovery path when the watcher drifted, wired to SIGHUP. It is safe to call
+// concurrently with the watcher. It returns ErrNotStarted if the repository is
+// not started.
+func (s *WatchedRepo[T]) ReloadLatest(ctx context.Context) error {
+	if err := s.checkStarted(); err != nil {
+		return err
+	}
+	return s.refresh(ctx)
+}
+
+// refresh re-reads the latest stored version and applies it if it is more
+// recent than the cached one.
+func (s *WatchedRepo[T]) refresh(ctx context.Context) error {
+	latest, err := s.store.Latest(ctx)
+	if errors.Is(err, ErrConfigurationNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.apply(latest)
+	return err
+}
+
+func (s *WatchedRepo[T]) checkStaleness(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.stalenessCheckInterval)
+		defer ticker.Stop()
+		wasStale, staleAt := false, uint64(0)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			stale, stored, cached, err := s.VerifyCacheFresh(ctx)
+			if err != nil {
+				s.lgr.With("error", err).ErrorContext(ctx, "error verifying cache freshness")
+				continue
+			}
+			if !stale {
+				wasStale = false
+				continue
+			}
+			if !wasStale || staleAt != cached {
+				wasStale, staleAt = true, cached
+				continue
+			}
+			s.lgr.With("storedVersion", stored, "cachedVersion", cached).
+				WarnContext(ctx, "cached configuration is stale, refreshing")
+			if err := s.refresh(ctx); err != nil {
+				s.lgr.With("error", err).ErrorContext(ctx, "error refreshing stale configuration")
+			}
+			wasStale = false
+		}
+	}()
+	return done
+}
@@ -0,0 +1,73 @@
+package streamingconfig
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CollStats reports the storage used by the configuration collection. Sizes
+// are in bytes.
+type CollStats struct {
+	// Count is the number of documents of the collection.
+	Count int64 `bson:"count,truncate"`
+	// Size is the uncompressed size of the documents.
+	Size int64 `bson:"size,truncate"`
+	// AvgObjSize is the average uncompressed size of a document.
+	AvgObjSize int64 `bson:"avgObjSize,truncate"`
+	// StorageSize is the size allocated on disk for the documents.
+	StorageSize int64 `bson:"storageSize,truncate"`
+	// TotalIndexSize is the size of all the indexes.
+	TotalIndexSize int64 `bson:"totalIndexSize,truncate"`
+	// IndexSizes holds the size of each index by name.
+	IndexSizes map[string]int64 `bson:"indexSizes"`
+}
+
+// CollectionStats returns storage statistics of the configuration collection
+// through the `collStats` command, e.g. to decide on a retention policy.
+//
+// Statistics cover the whole collection, including the documents not matching
+// the document filter of the repository, if any.
+func (s *WatchedRepo[T]) CollectionStats(ctx context.Context) (CollStats, error) {
+	if err := s.mongoOnly(); err != nil {
+		return CollStats{}, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	var stats CollStats
+	err := s.source.RunCommand(ctxTimeout, bson.D{{Key: "collStats", Value: s.collectionName}}).
+		Decode(&stats)
+	if err != nil {
+		return CollStats{}, fmt.Errorf("error getting collection stats: %w", err)
+	}
+	return stats, nil
+}
+
+// CountVersions returns the number of stored versions. Pruned versions are not
+// counted.
+func (s *WatchedRepo[T]) CountVersions(ctx context.Context) (int64, error) {
+	return s.countVersions(ctx, bson.M{})
+}
+
+// CountVersionsByUser returns the number of stored versions created by the
+// user.
+func (s *WatchedRepo[T]) CountVersionsByUser(ctx context.Context, user string) (int64, error) {
+	return s.countVersions(ctx, bson.M{"updated_by": user})
+}
+
+func (s *WatchedRepo[T]) countVersions(ctx context.Context, filter bson.M) (int64, error) {
+	if err := s.checkStarted(); err != nil {
+		return 0, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return 0, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	count, err := s.configs.CountDocuments(ctxTimeout, s.filter(filter))
+	if err != nil {
+		return 0, fmt.Errorf("error counting versions: %w", err)
+	}
+	return count, nil
+}
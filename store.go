@@ -0,0 +1,54 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotSupported is returned by the operations that the store of the
+// repository does not support, e.g. the MongoDB-specific ones when the store
+// is set with WithStore.
+var ErrNotSupported = fmt.Errorf("operation not supported by the store: %w", errors.ErrUnsupported)
+
+// Store persists the versions of a WatchedRepo. Repositories rely on MongoDB
+// unless another store is set with WithStore.
+type Store[T Config] interface {
+	// Latest returns the version with the highest number, or
+	// ErrConfigurationNotFound if there is none.
+	Latest(ctx context.Context) (*Versioned[T], error)
+	// Insert stores a new version, or returns ErrConcurrentUpdate if its number
+	// is already taken.
+	Insert(ctx context.Context, v *Versioned[T]) error
+	// Range hands the versions matching the query, without defaults applied,
+	// to fn one at a time, in version order (see Descending), until fn returns
+	// an error, which Range returns. The versions are to be read as they are
+	// handed, so that ranges of any length are processed with constant memory.
+	Range(ctx context.Context, query ListVersionedConfigsQuery, fn func(v *Versioned[T]) error) error
+	// Watch delivers the inserted versions to onVersion, from a single
+	// goroutine, until the context is done; the returned channel is closed
+	// once it stopped. It returns once every version inserted afterwards is
+	// guaranteed to be delivered. Versions may be delivered more than once:
+	// the ones that are not more recent than the current one are ignored.
+	// Errors returned by onVersion are for the store to report.
+	Watch(ctx context.Context, onVersion func(v *Versioned[T]) error) (<-chan struct{}, error)
+}
+
+// WithStore makes the repository persist the versions with the input store
+// instead of MongoDB, in which case the DB of the Args is not used. The
+// MongoDB-specific operations (e.g. Import, PruneVersions or
+// CollectionStats) then return ErrNotSupported and the MongoDB-specific
+// options have no effect.
+func WithStore[T Config](store Store[T]) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.store = store
+	}
+}
+
+// mongoOnly returns ErrNotSupported unless the repository relies on MongoDB.
+func (s *WatchedRepo[T]) mongoOnly() error {
+	if s.configs == nil {
+		return ErrNotSupported
+	}
+	return nil
+}
@@ -0,0 +1,1199 @@
+package streamingconfig_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/rbroggi/streamingconfig"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// memStore is a Store keeping the versions in memory.
+type memStore[T config.Config] struct {
+	mu       sync.Mutex
+	versions []*config.Versioned[T]
+	inserted chan *config.Versioned[T]
+}
+
+func newMemStore[T config.Config]() *memStore[T] {
+	return &memStore[T]{inserted: make(chan *config.Versioned[T], 16)}
+}
+
+func (m *memStore[T]) Latest(context.Context) (*config.Versioned[T], error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.versions) == 0 {
+		return nil, config.ErrConfigurationNotFound
+	}
+	return m.versions[len(m.versions)-1], nil
+}
+
+func (m *memStore[T]) Insert(_ context.Context, v *config.Versioned[T]) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.versions) > 0 && m.versions[len(m.versions)-1].Version >= v.Version {
+		return config.ErrConcurrentUpdate
+	}
+	m.versions = append(m.versions, v)
+	m.inserted <- v
+	return nil
+}
+
+func (m *memStore[T]) Range(_ context.Context, query config.ListVersionedConfigsQuery, fn func(v *config.Versioned[T]) error) error {
+	m.mu.Lock()
+	versions := slices.Clone(m.versions)
+	m.mu.Unlock()
+	if query.Descending {
+		slices.Reverse(versions)
+	}
+	skip, handed := query.Skip, int64(0)
+	for _, v := range versions {
+		if !v.Matches(query) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if query.Limit > 0 && handed == query.Limit {
+			break
+		}
+		handed++
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memStore[T]) Watch(ctx context.Context, onVersion func(v *config.Versioned[T]) error) (<-chan struct{}, error) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v := <-m.inserted:
+				_ = onVersion(v)
+			}
+		}
+	}()
+	return done, nil
+}
+
+func Test_WithStore(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	got, err := repo.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, &appConfigV0{Name: "bobby"}, got)
+
+	cV1, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), cV1.Version)
+	cV2, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{Duration: time.Second},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &appConfigV0{Name: "bobby", Duration: time.Second}, cV2.Config)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		got, err := repo.GetConfig()
+		require.NoError(c, err)
+		assert.Equal(c, cV2.Config, got)
+	}, time.Second, 10*time.Millisecond)
+
+	v1, err := repo.GetVersion(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, cV1, v1)
+	_, err = repo.GetVersion(ctx, 3)
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+	all, err := repo.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+		FromVersion: 0,
+		ToVersion:   10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []*config.Versioned[*appConfigV0]{cV1, cV2}, all)
+
+	_, err = repo.CountVersions(ctx)
+	require.ErrorIs(t, err, config.ErrNotSupported)
+	_, err = repo.PruneVersions(ctx, 1)
+	require.ErrorIs(t, err, config.ErrNotSupported)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+// updatesRecorder is a MetricsRecorder keeping the errors of the updates.
+type updatesRecorder struct {
+	mu      sync.Mutex
+	updates []error
+}
+
+func (r *updatesRecorder) ObserveUpdate(_ time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, err)
+}
+
+func (r *updatesRecorder) ObserveEvent(string) {}
+
+func (r *updatesRecorder) ObserveDecodeError() {}
+
+func (r *updatesRecorder) ObserveReconnect() {}
+
+func Test_WithMetricsRecorder(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	recorder := &updatesRecorder{}
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+		config.WithMetricsRecorder[*appConfigV0](recorder),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}})
+	require.NoError(t, err)
+	stale := uint64(0)
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u2", Config: &appConfigV0{Name: "n2"}, ExpectedVersion: &stale})
+	require.ErrorIs(t, err, config.ErrVersionMismatch)
+
+	recorder.mu.Lock()
+	require.Len(t, recorder.updates, 2)
+	require.NoError(t, recorder.updates[0])
+	require.ErrorIs(t, recorder.updates[1], config.ErrVersionMismatch)
+	recorder.mu.Unlock()
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_WithTracerProvider(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+		config.WithTracerProvider[*appConfigV0](tp),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+
+	parentCtx, parent := tp.Tracer("test").Start(ctx, "handler")
+	_, err = repo.UpdateConfig(parentCtx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}})
+	require.NoError(t, err)
+	stale := uint64(0)
+	_, err = repo.UpdateConfig(parentCtx, config.UpdateConfigCmd[*appConfigV0]{By: "u2", Config: &appConfigV0{Name: "n2"}, ExpectedVersion: &stale})
+	require.ErrorIs(t, err, config.ErrVersionMismatch)
+	_, err = repo.ListVersionedConfigs(parentCtx, config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 10})
+	require.NoError(t, err)
+	parent.End()
+
+	var updates []sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		switch span.Name() {
+		case "streamingconfig.UpdateConfig":
+			updates = append(updates, span)
+			require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		case "streamingconfig.ListVersionedConfigs":
+			require.Contains(t, span.Attributes(), attribute.Int("streamingconfig.count", 1))
+		}
+	}
+	require.Len(t, updates, 2)
+	require.Contains(t, updates[0].Attributes(), attribute.String("streamingconfig.author", "u1"))
+	require.Contains(t, updates[0].Attributes(), attribute.Int64("streamingconfig.version", 1))
+	require.Contains(t, updates[0].Attributes(), attribute.Bool("streamingconfig.conflict", false))
+	require.Equal(t, codes.Unset, updates[0].Status().Code)
+	require.Equal(t, codes.Error, updates[1].Status().Code)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_HealthCheck(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	require.ErrorIs(t, repo.HealthCheck(ctx), config.ErrNotStarted)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	require.NoError(t, repo.HealthCheck(ctx))
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+	require.ErrorIs(t, repo.HealthCheck(context.Background()), config.ErrWatcherStale)
+}
+
+// immutableConfig is a configuration of a value type.
+type immutableConfig struct {
+	Name string `json:"name" default:"bobby"`
+	Age  int    `json:"age"`
+}
+
+func (c immutableConfig) Update(new config.Config) error {
+	if _, ok := new.(immutableConfig); !ok {
+		return errors.New("wrong type")
+	}
+	return nil
+}
+
+func Test_WithStore_valueType(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[immutableConfig](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[immutableConfig](newMemStore[immutableConfig]()),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	got, err := repo.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, immutableConfig{Name: "bobby"}, got)
+
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[immutableConfig]{By: "u1", Config: immutableConfig{Name: "n1", Age: 30}})
+	require.NoError(t, err)
+	v2, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[immutableConfig]{By: "u1", Config: immutableConfig{Age: 31}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), v2.Version)
+	require.Equal(t, immutableConfig{Name: "bobby", Age: 31}, v2.Config)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		got, err := repo.GetConfig()
+		require.NoError(c, err)
+		assert.Equal(c, v2.Config, got)
+	}, time.Second, 10*time.Millisecond)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_WithBootstrapFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte("list: [a, b]\nnested:\n  counter: 3\n"), 0o600))
+
+	t.Run("seeds the first version", func(t *testing.T) {
+		ctx, cnl := context.WithCancel(context.Background())
+		t.Cleanup(cnl)
+		repo, err := config.NewWatchedRepo[*appConfigV0](
+			config.Args{Logger: slog.Default()},
+			config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+			config.WithBootstrapFile[*appConfigV0](yamlFile),
+			config.WithBootstrapAuthor[*appConfigV0]("deployer"),
+		)
+		require.NoError(t, err)
+		done, err := repo.Start(ctx)
+		require.NoError(t, err)
+		v1, err := repo.GetVersion(ctx, 1)
+		require.NoError(t, err)
+		require.Equal(t, "deployer", v1.UpdatedBy)
+		require.Equal(t, "bootstrapped from config.yaml", v1.Reason)
+		// the defaults apply to the fields missing from the file.
+		want := &appConfigV0{Name: "bobby", List: []string{"a", "b"}, Nested: nestedConfig{Counter: 3}}
+		require.Equal(t, want, v1.Config)
+		got, err := repo.GetConfig()
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+
+		cnl()
+		doneOrTimeout(t, done, time.Second)
+	})
+
+	t.Run("runs the update hooks", func(t *testing.T) {
+		ctx, cnl := context.WithCancel(context.Background())
+		t.Cleanup(cnl)
+		var created []uint64
+		repo, err := config.NewWatchedRepo[*appConfigV0](
+			config.Args{Logger: slog.Default()},
+			config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+			config.WithBootstrapFile[*appConfigV0](yamlFile),
+			config.WithPreUpdateHook[*appConfigV0](func(_ context.Context, old, candidate *appConfigV0) error {
+				require.Equal(t, "bobby", old.Name)
+				candidate.Name = "enriched"
+				return nil
+			}),
+			config.WithPostUpdateHook[*appConfigV0](func(_ context.Context, v *config.Versioned[*appConfigV0]) {
+				created = append(created, v.Version)
+			}),
+		)
+		require.NoError(t, err)
+		done, err := repo.Start(ctx)
+		require.NoError(t, err)
+		got, err := repo.GetConfig()
+		require.NoError(t, err)
+		require.Equal(t, "enriched", got.Name)
+		require.Equal(t, []uint64{1}, created)
+
+		cnl()
+		doneOrTimeout(t, done, time.Second)
+	})
+
+	t.Run("existing version", func(t *testing.T) {
+		ctx, cnl := context.WithCancel(context.Background())
+		t.Cleanup(cnl)
+		store := newMemStore[*appConfigV0]()
+		require.NoError(t, store.Insert(ctx, &config.Versioned[*appConfigV0]{
+			Version: 1,
+			Config:  &appConfigV0{Name: "n1"},
+		}))
+		repo, err := config.NewWatchedRepo[*appConfigV0](
+			config.Args{Logger: slog.Default()},
+			config.WithStore[*appConfigV0](store),
+			config.WithBootstrapFile[*appConfigV0](filepath.Join(dir, "missing.json")),
+		)
+		require.NoError(t, err)
+		done, err := repo.Start(ctx)
+		require.NoError(t, err)
+		got, err := repo.GetConfig()
+		require.NoError(t, err)
+		require.Equal(t, &appConfigV0{Name: "n1"}, got)
+
+		cnl()
+		doneOrTimeout(t, done, time.Second)
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		jsonFile := filepath.Join(dir, "config.json")
+		require.NoError(t, os.WriteFile(jsonFile, []byte(`{"name": 1}`), 0o600))
+		for _, path := range []string{jsonFile, filepath.Join(dir, "missing.json")} {
+			repo, err := config.NewWatchedRepo[*appConfigV0](
+				config.Args{Logger: slog.Default()},
+				config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+				config.WithBootstrapFile[*appConfigV0](path),
+			)
+			require.NoError(t, err)
+			_, err = repo.Start(context.Background())
+			require.Error(t, err)
+		}
+	})
+}
+
+func Test_ReloadLatest(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	store := newMemStore[*appConfigV0]()
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](store),
+	)
+	require.NoError(t, err)
+	require.ErrorIs(t, repo.ReloadLatest(ctx), config.ErrNotStarted)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	require.NoError(t, repo.ReloadLatest(ctx))
+
+	// the watcher misses the version.
+	store.mu.Lock()
+	store.versions = append(store.versions, &config.Versioned[*appConfigV0]{
+		Version: 1,
+		Config:  &appConfigV0{Name: "n1"},
+	})
+	store.mu.Unlock()
+	got, err := repo.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, "bobby", got.Name)
+
+	version, err := repo.CurrentVersion()
+	require.NoError(t, err)
+	require.Zero(t, version)
+
+	require.NoError(t, repo.ReloadLatest(ctx))
+	latest, err := repo.GetLatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), latest.Version)
+	require.Equal(t, "n1", latest.Config.Name)
+	version, err = repo.CurrentVersion()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), version)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_GetConfig_copy(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	v1, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1", List: []string{"a"}},
+	})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		got, err := repo.GetConfig()
+		require.NoError(c, err)
+		assert.Equal(c, v1.Config, got)
+	}, time.Second, 10*time.Millisecond)
+
+	got, err := repo.GetConfig()
+	require.NoError(t, err)
+	got.Name = "mutated"
+	got.List[0] = "mutated"
+	latest, err := repo.GetLatestVersion()
+	require.NoError(t, err)
+	latest.Config.Nested.Counter = 42
+	latest.UpdatedBy = "mutated"
+
+	got, err = repo.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, &appConfigV0{Name: "n1", List: []string{"a"}}, got)
+	latest, err = repo.GetLatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, "u1", latest.UpdatedBy)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_Observe_copy(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	current, versions, cancel, err := repo.Observe(ctx)
+	require.NoError(t, err)
+	t.Cleanup(cancel)
+	other := repo.Subscribe(ctx)
+	current.Config.Name = "mutated"
+	got, err := repo.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, "bobby", got.Name)
+
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1", List: []string{"a"}},
+	})
+	require.NoError(t, err)
+	received := <-versions
+	received.Config.List[0] = "mutated"
+	received.UpdatedBy = "mutated"
+	fromOther := <-other
+	require.Equal(t, "u1", fromOther.UpdatedBy)
+	require.Equal(t, []string{"a"}, fromOther.Config.List)
+	latest, err := repo.GetLatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, "u1", latest.UpdatedBy)
+	require.Equal(t, []string{"a"}, latest.Config.List)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_RangeVersions(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	require.ErrorIs(t, repo.RangeVersions(ctx, config.ListVersionedConfigsQuery{}, nil), config.ErrNotStarted)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	for _, name := range []string{"n1", "", "n3"} {
+		_, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: name}})
+		require.NoError(t, err)
+	}
+
+	query := config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 10}
+	var names []string
+	require.NoError(t, repo.RangeVersions(ctx, query, func(v *config.Versioned[*appConfigV0]) error {
+		names = append(names, v.Config.Name)
+		return nil
+	}))
+	require.Equal(t, []string{"n1", "bobby", "n3"}, names)
+
+	errStop := errors.New("stop")
+	var versions []uint64
+	err = repo.RangeVersions(ctx, query, func(v *config.Versioned[*appConfigV0]) error {
+		versions = append(versions, v.Version)
+		if v.Version == 2 {
+			return errStop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, []uint64{1, 2}, versions)
+
+	query.Descending, query.Skip, query.Limit = true, 1, 5
+	versions = nil
+	require.NoError(t, repo.RangeVersions(ctx, query, func(v *config.Versioned[*appConfigV0]) error {
+		versions = append(versions, v.Version)
+		return nil
+	}))
+	require.Equal(t, []uint64{2, 1}, versions)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_ListVersionMetadata(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	v1, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+		Reason: "first",
+		Tags:   []string{"release"},
+	})
+	require.NoError(t, err)
+
+	got, err := repo.ListVersionMetadata(ctx, config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 10})
+	require.NoError(t, err)
+	require.Equal(t, []*config.VersionMetadata{{
+		Version:   1,
+		UpdatedBy: "u1",
+		CreatedAt: v1.CreatedAt,
+		Reason:    "first",
+		Tags:      []string{"release"},
+	}}, got)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_WaitForVersion(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	store := newMemStore[*appConfigV0]()
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](store),
+	)
+	require.NoError(t, err)
+	_, err = repo.WaitForVersion(ctx, 1)
+	require.ErrorIs(t, err, config.ErrNotStarted)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+
+	current, err := repo.WaitForVersion(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, "bobby", current.Config.Name)
+
+	// another process creates the version.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = store.Insert(ctx, &config.Versioned[*appConfigV0]{
+			Version: 1,
+			Config:  &appConfigV0{Name: "n1"},
+		})
+	}()
+	waitCtx, waitCnl := context.WithTimeout(ctx, time.Second)
+	defer waitCnl()
+	got, err := repo.WaitForVersion(waitCtx, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), got.Version)
+	require.Equal(t, "n1", got.Config.Name)
+
+	timeoutCtx, timeoutCnl := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer timeoutCnl()
+	_, err = repo.WaitForVersion(timeoutCtx, 2)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+func Test_WithRejectNoopUpdates(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+		config.WithRejectNoopUpdates[*appConfigV0](),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{List: []string{"a"}},
+	})
+	require.NoError(t, err)
+
+	// the name is set to its default value.
+	noop := config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{Name: "bobby", List: []string{"a"}},
+	}
+	_, err = repo.UpdateConfig(ctx, noop)
+	require.ErrorIs(t, err, config.ErrNoChange)
+	require.ErrorIs(t, repo.ValidateConfig(ctx, noop), config.ErrNoChange)
+
+	v2, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{List: []string{"a", "b"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), v2.Version)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+// conflictingStore is a memStore where another writer creates a version right
+// before each of the first insertions.
+type conflictingStore[T config.Config] struct {
+	*memStore[T]
+	conflicts int
+}
+
+func (c *conflictingStore[T]) Insert(ctx context.Context, v *config.Versioned[T]) error {
+	if c.conflicts > 0 {
+		c.conflicts--
+		concurrent := *v
+		concurrent.UpdatedBy = "concurrent"
+		if err := c.memStore.Insert(ctx, &concurrent); err != nil {
+			return err
+		}
+	}
+	return c.memStore.Insert(ctx, v)
+}
+
+func Test_WithUpdateRetry(t *testing.T) {
+	newRepo := func(t *testing.T, conflicts int) (*config.WatchedRepo[*appConfigV0], context.Context) {
+		ctx, cnl := context.WithCancel(context.Background())
+		repo, err := config.NewWatchedRepo[*appConfigV0](
+			config.Args{Logger: slog.Default()},
+			config.WithStore[*appConfigV0](&conflictingStore[*appConfigV0]{
+				memStore:  newMemStore[*appConfigV0](),
+				conflicts: conflicts,
+			}),
+			config.WithUpdateRetry[*appConfigV0](3, config.ExponentialBackoff(time.Millisecond, 10*time.Millisecond)),
+		)
+		require.NoError(t, err)
+		done, err := repo.Start(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			cnl()
+			doneOrTimeout(t, done, time.Second)
+		})
+		return repo, ctx
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		repo, ctx := newRepo(t, 2)
+		got, prev, err := repo.UpdateConfigWithPrev(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: "n1"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), got.Version)
+		require.Equal(t, "u1", got.UpdatedBy)
+		require.Equal(t, uint64(2), prev.Version)
+		require.Equal(t, "concurrent", prev.UpdatedBy)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		repo, ctx := newRepo(t, 3)
+		_, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: "n1"},
+		})
+		require.ErrorIs(t, err, config.ErrConcurrentUpdate)
+	})
+
+	t.Run("expected version", func(t *testing.T) {
+		repo, ctx := newRepo(t, 1)
+		expected := uint64(0)
+		_, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:              "u1",
+			Config:          &appConfigV0{Name: "n1"},
+			ExpectedVersion: &expected,
+		})
+		require.ErrorIs(t, err, config.ErrConcurrentUpdate)
+	})
+}
+
+func Test_Stop(t *testing.T) {
+	ctx := context.Background()
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	require.ErrorIs(t, repo.Stop(ctx), config.ErrNotStarted)
+	require.False(t, repo.IsStarted())
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	require.True(t, repo.IsStarted())
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Stop(ctx))
+	require.NoError(t, repo.Stop(ctx))
+	doneOrTimeout(t, done, time.Second)
+	require.False(t, repo.IsStarted())
+
+	_, err = repo.GetConfig()
+	require.ErrorIs(t, err, config.ErrStopped)
+	_, err = repo.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{ToVersion: 10})
+	require.ErrorIs(t, err, config.ErrStopped)
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n2"},
+	})
+	require.ErrorIs(t, err, config.ErrStopped)
+	require.ErrorIs(t, repo.HealthCheck(ctx), config.ErrWatcherStale)
+}
+
+func Test_StartTwice(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, time.Second)
+	})
+
+	goroutines := runtime.NumGoroutine()
+	_, err = repo.Start(ctx)
+	require.ErrorIs(t, err, config.ErrAlreadyStarted)
+	require.Equal(t, goroutines, runtime.NumGoroutine())
+
+	// once stopped, the repository is not restarted either.
+	require.NoError(t, repo.Stop(ctx))
+	_, err = repo.Start(ctx)
+	require.ErrorIs(t, err, config.ErrAlreadyStarted)
+}
+
+func Test_StartRetry(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	path := filepath.Join(t.TempDir(), "config.json")
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+		config.WithBootstrapFile[*appConfigV0](path),
+	)
+	require.NoError(t, err)
+	// the bootstrap file is missing.
+	_, err = repo.Start(ctx)
+	require.Error(t, err)
+	require.False(t, repo.IsStarted())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"name": "n1"}`), 0o600))
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	require.True(t, repo.IsStarted())
+	got, err := repo.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, "n1", got.Name)
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n2"}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, err := repo.GetConfig()
+		return err == nil && got.Name == "n2"
+	}, time.Second, 10*time.Millisecond)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+type invalidDefaultsConfig struct {
+	Workers int `json:"workers" default:"-1"`
+}
+
+func (c *invalidDefaultsConfig) Update(new config.Config) error {
+	if err := config.ReplaceUpdate(c, new); err != nil {
+		return err
+	}
+	if c.Workers < 0 {
+		return errors.New("workers must not be negative")
+	}
+	return nil
+}
+
+func Test_ResetToDefaults(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, time.Second)
+	})
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1", Duration: time.Second, List: []string{"a"}},
+	})
+	require.NoError(t, err)
+
+	reset, err := repo.ResetToDefaults(ctx, "u2")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), reset.Version)
+	require.Equal(t, "u2", reset.UpdatedBy)
+	require.Equal(t, &appConfigV0{Name: "bobby"}, reset.Config)
+	// history is kept.
+	v1, err := repo.GetVersion(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "n1", v1.Config.Name)
+
+	t.Run("invalid defaults", func(t *testing.T) {
+		invalid, err := config.NewWatchedRepo[*invalidDefaultsConfig](
+			config.Args{Logger: slog.Default()},
+			config.WithStore[*invalidDefaultsConfig](newMemStore[*invalidDefaultsConfig]()),
+		)
+		require.NoError(t, err)
+		done, err := invalid.Start(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			cnl()
+			doneOrTimeout(t, done, time.Second)
+		})
+		_, err = invalid.ResetToDefaults(ctx, "u1")
+		require.ErrorContains(t, err, "workers must not be negative")
+		_, err = invalid.GetVersion(ctx, 1)
+		require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+	})
+}
+
+func Test_GetSetField(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, time.Second)
+	})
+	v1, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Nested: nestedConfig{Counter: 3}, List: []string{"a", "b"}},
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		v, err := repo.CurrentVersion()
+		return err == nil && v == v1.Version
+	}, time.Second, time.Millisecond)
+
+	for path, want := range map[string]any{
+		"name":           "bobby",
+		"nested.counter": 3.0,
+		"list.1":         "b",
+		"nested":         map[string]any{"counter": 3.0},
+	} {
+		got, err := repo.GetField(path)
+		require.NoError(t, err, path)
+		require.Equal(t, want, got, path)
+	}
+	for _, path := range []string{"", "unknown", "nested.unknown", "name.unknown", "list.2", "list.x"} {
+		_, err := repo.GetField(path)
+		require.ErrorIs(t, err, config.ErrUnknownField, path)
+	}
+
+	v2, err := repo.SetField(ctx, "u2", "nested.counter", 4)
+	require.NoError(t, err)
+	require.Equal(t, "u2", v2.UpdatedBy)
+	require.Equal(t, &appConfigV0{Name: "bobby", Nested: nestedConfig{Counter: 4}, List: []string{"a", "b"}}, v2.Config)
+
+	_, err = repo.SetField(ctx, "u2", "list.0", "c")
+	require.ErrorIs(t, err, config.ErrUnknownField)
+	_, err = repo.SetField(ctx, "u2", "nested.unknown", 1)
+	require.ErrorIs(t, err, config.ErrUnknownField)
+	_, err = repo.SetField(ctx, "u2", "nested.counter", "x")
+	require.ErrorIs(t, err, config.ErrInvalidPatch)
+}
+
+func Test_UpdateHooks(t *testing.T) {
+	type call struct {
+		old, candidate string
+	}
+	newOpts := func(pre *[]call, post *[]uint64) []func(*config.WatchedRepo[*appConfigV0]) {
+		return []func(*config.WatchedRepo[*appConfigV0]){
+			config.WithPreUpdateHook[*appConfigV0](func(_ context.Context, old, candidate *appConfigV0) error {
+				*pre = append(*pre, call{old: old.Name, candidate: candidate.Name})
+				if candidate.Name == "forbidden" {
+					return errors.New("forbidden name")
+				}
+				candidate.List = append(candidate.List, "enriched")
+				return nil
+			}),
+			config.WithPostUpdateHook[*appConfigV0](func(_ context.Context, v *config.Versioned[*appConfigV0]) {
+				*post = append(*post, v.Version)
+			}),
+		}
+	}
+	for name, newRepo := range map[string]func(t *testing.T, pre *[]call, post *[]uint64) config.Repo[*appConfigV0]{
+		"watched": func(t *testing.T, pre *[]call, post *[]uint64) config.Repo[*appConfigV0] {
+			ctx, cnl := context.WithCancel(context.Background())
+			repo, err := config.NewWatchedRepo[*appConfigV0](
+				config.Args{Logger: slog.Default()},
+				append(newOpts(pre, post), config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()))...,
+			)
+			require.NoError(t, err)
+			done, err := repo.Start(ctx)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				cnl()
+				doneOrTimeout(t, done, time.Second)
+			})
+			return repo
+		},
+		"in memory": func(t *testing.T, pre *[]call, post *[]uint64) config.Repo[*appConfigV0] {
+			repo, err := config.NewInMemoryRepo[*appConfigV0](newOpts(pre, post)...)
+			require.NoError(t, err)
+			_, err = repo.Start(context.Background())
+			require.NoError(t, err)
+			return repo
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			var pre []call
+			var post []uint64
+			repo := newRepo(t, &pre, &post)
+
+			v1, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+				By:     "u1",
+				Config: &appConfigV0{Name: "n1"},
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"enriched"}, v1.Config.List)
+
+			_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+				By:     "u1",
+				Config: &appConfigV0{Name: "forbidden"},
+			})
+			require.EqualError(t, err, "forbidden name")
+			// the validation runs the pre-update hooks too.
+			err = repo.ValidateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+				By:     "u1",
+				Config: &appConfigV0{Name: "forbidden"},
+			})
+			require.EqualError(t, err, "forbidden name")
+
+			// upon the first version, the current configuration is the default one.
+			require.Equal(t, []call{
+				{old: "bobby", candidate: "n1"},
+				{old: "n1", candidate: "forbidden"},
+				{old: "n1", candidate: "forbidden"},
+			}, pre)
+			require.Equal(t, []uint64{1}, post)
+			_, err = repo.GetVersion(ctx, 2)
+			require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+		})
+	}
+}
+
+func Test_CreatedAt_milliseconds(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	at := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+		config.WithNowFn[*appConfigV0](func() time.Time { return at }),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, time.Second)
+	})
+
+	// the versions are created at the precision MongoDB stores.
+	v, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}})
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC), v.CreatedAt)
+}
+
+func Test_WithActorFromContext(t *testing.T) {
+	type actorKey struct{}
+	ctx, cnl := context.WithCancel(context.Background())
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](newMemStore[*appConfigV0]()),
+		config.WithActorFromContext[*appConfigV0](func(ctx context.Context) string {
+			actor, _ := ctx.Value(actorKey{}).(string)
+			return actor
+		}),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, time.Second)
+	})
+	userCtx := context.WithValue(ctx, actorKey{}, "from-context")
+
+	v1, err := repo.UpdateConfig(userCtx, config.UpdateConfigCmd[*appConfigV0]{
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "from-context", v1.UpdatedBy)
+
+	// the explicit author takes precedence.
+	v2, err := repo.UpdateConfig(userCtx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "explicit",
+		Config: &appConfigV0{Name: "n2"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "explicit", v2.UpdatedBy)
+
+	v3, err := repo.PatchConfig(userCtx, config.PatchCmd{MergePatch: []byte(`{"name":"n3"}`)})
+	require.NoError(t, err)
+	require.Equal(t, "from-context", v3.UpdatedBy)
+
+	v4, err := repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		Config: &appConfigV0{Name: "n4"},
+	})
+	require.NoError(t, err)
+	require.Empty(t, v4.UpdatedBy)
+}
+
+func Test_WithWebhook_writerOnly(t *testing.T) {
+	var mu sync.Mutex
+	var notified []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		notified = append(notified, r.Header.Get(config.WebhookVersionHeader))
+	}))
+	t.Cleanup(srv.Close)
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	store := newMemStore[*appConfigV0]()
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](store),
+		config.WithWebhook[*appConfigV0](srv.URL),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+
+	// the version created by another replica is not notified by this one.
+	require.NoError(t, store.Insert(ctx, &config.Versioned[*appConfigV0]{
+		Version: 1, UpdatedBy: "u1", Config: &appConfigV0{Name: "n1"},
+	}))
+	_, err = repo.WaitForVersion(ctx, 1)
+	require.NoError(t, err)
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u2", Config: &appConfigV0{Name: "n2"}})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(c, []string{"2"}, notified)
+	}, time.Second, 10*time.Millisecond)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
+
+// versionsPublisher is a Publisher keeping the published versions.
+type versionsPublisher struct {
+	mu        sync.Mutex
+	published []uint64
+}
+
+func (p *versionsPublisher) Publish(_ context.Context, v *config.Versioned[*appConfigV0]) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, v.Version)
+	return nil
+}
+
+func Test_WithEventPublisher_writerOnly(t *testing.T) {
+	ctx, cnl := context.WithCancel(context.Background())
+	t.Cleanup(cnl)
+	store := newMemStore[*appConfigV0]()
+	publisher := &versionsPublisher{}
+	repo, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default()},
+		config.WithStore[*appConfigV0](store),
+		config.WithEventPublisher[*appConfigV0](publisher),
+	)
+	require.NoError(t, err)
+	done, err := repo.Start(ctx)
+	require.NoError(t, err)
+
+	// the version created by another replica is not published by this one.
+	require.NoError(t, store.Insert(ctx, &config.Versioned[*appConfigV0]{
+		Version: 1, UpdatedBy: "u1", Config: &appConfigV0{Name: "n1"},
+	}))
+	_, err = repo.WaitForVersion(ctx, 1)
+	require.NoError(t, err)
+	_, err = repo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u2", Config: &appConfigV0{Name: "n2"}})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		publisher.mu.Lock()
+		defer publisher.mu.Unlock()
+		require.Equal(c, []uint64{2}, publisher.published)
+	}, time.Second, 10*time.Millisecond)
+
+	cnl()
+	doneOrTimeout(t, done, time.Second)
+}
@@ -3,28 +3,57 @@ package streamingconfig
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/creasty/defaults"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Config is a representation of the app configuration. It is wrapped into
 // a generic configuration which includes additional fields for the sake of
 // auditability (version, updated_at and updated_by).
+//
+// Configurations are typically pointers to structs, whose `Update` method
+// applies the new configuration to the receiver. Value types are supported
+// too, e.g. for immutability: as their `Update` method only receives a copy,
+// the new configuration replaces the current one once accepted by `Update`,
+// which then acts as a check of the transition.
 type Config interface {
 	Update(new Config) error
 }
 
+// Validator is optionally implemented by the configurations to check their
+// invariants apart from applying changes in `Update`. When implemented,
+// UpdateConfig calls Validate on the candidate configuration, without
+// defaults, before persisting it; otherwise the first configuration is
+// validated by updating it with itself.
+type Validator interface {
+	Validate() error
+}
+
+// MultiValidator is optionally implemented by the configurations reporting all
+// their invalid fields at once, e.g. for UIs to highlight them together. It is
+// called as Validator is, which it takes precedence over, and UpdateConfig
+// returns the errors joined with errors.Join: errors.Is and errors.As match
+// each of them, and their Unwrap() []error method lists them.
+type MultiValidator interface {
+	ValidateAll() []error
+}
+
 // Versioned encapsulates a version of the configuration and adds some auditing
 // information on top of the configuration.
 type Versioned[T Config] struct {
@@ -34,18 +63,63 @@ type Versioned[T Config] struct {
 	UpdatedBy string `json:"updated_by" bson:"updated_by"`
 	// CreatedAt time of the last config update.
 	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// Reason explains why the version was created, empty if not provided.
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
+	// Tags label the version, e.g. "release" or "known-good" (see ListByTag).
+	Tags []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	// Metadata holds the extra fields stamped by the repository that created
+	// the version (see WithMetadata) and provided with the update.
+	Metadata map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
 	// Config embeds the application-specific configuration.
 	Config T `json:"config" bson:"app_config"`
 }
 
+// Matches reports whether the version matches the filters of the query, i.e.
+// all but the pagination.
+func (v *Versioned[T]) Matches(query ListVersionedConfigsQuery) bool {
+	return v.Version >= query.FromVersion && v.Version < query.ToVersion &&
+		(query.UpdatedBy == "" || v.UpdatedBy == query.UpdatedBy) &&
+		v.HasMetadata(query.Metadata)
+}
+
+// HasMetadata reports whether the version holds all the input metadata
+// entries.
+func (v *Versioned[T]) HasMetadata(metadata map[string]string) bool {
+	for k, val := range metadata {
+		if got, ok := v.Metadata[k]; !ok || got != val {
+			return false
+		}
+	}
+	return true
+}
+
 var (
 	// ErrNotStarted is returned when a user attempts to use the store before calling the `Start` method.
 	ErrNotStarted            = errors.New("config store not started - call Start() before using it")
 	ErrConfigurationNotFound = errors.New("configuration not found")
 	// ErrConcurrentUpdate signals that multiple repositories are attempting to change the configuration concurrently.
 	ErrConcurrentUpdate = errors.New("configuration concurrently being updated by someone-else")
-	// ErrTypeMustBePointer by the constructor of the repo if the provided type is not a pointer type.
-	ErrTypeMustBePointer = errors.New("configuration type argument must be pointer")
+	// ErrStopped is returned by the operations once the repository is
+	// shutting down (see Stop).
+	ErrStopped = errors.New("config store stopped")
+	// ErrAlreadyStarted is returned by Start when the repository was already
+	// started, or is starting.
+	ErrAlreadyStarted = errors.New("config store already started")
+	// ErrNotInitialized is returned by the getters of a repository configured
+	// with WithRequireExplicitInit while no configuration was ever created.
+	ErrNotInitialized = errors.New("configuration not initialized - create it with UpdateConfig before using it")
+	// ErrVersionMismatch is returned by UpdateConfig when the latest version is
+	// not the expected one.
+	ErrVersionMismatch = errors.New("configuration version mismatch")
+	// ErrVersionExists is returned by Import when a version is already stored.
+	ErrVersionExists = errors.New("configuration version already exists")
+	// ErrTypeMustBePointer is returned by the constructors of the repositories
+	// when the configuration type is an interface type. Despite its name, kept
+	// for compatibility, both pointer and value types are supported.
+	ErrTypeMustBePointer = errors.New("configuration type argument must be a pointer or value type")
+	// ErrInvalidOperationTimeout is returned by the constructor of the repo
+	// when the operation timeout is not positive.
+	ErrInvalidOperationTimeout = errors.New("operation timeout must be positive")
 )
 
 type Args struct {
@@ -71,54 +145,287 @@ func WithCollectionName[T Config](collectionName string) func(repo *WatchedRepo[
 	}
 }
 
+// WithOperationTimeout sets the timeout of the individual database operations,
+// 5s by default. It applies only when the context passed to the repository
+// methods has no deadline: a deadline set by the caller takes precedence. The
+// timeout must be positive.
+func WithOperationTimeout[T Config](d time.Duration) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.operationTimeout = d
+	}
+}
+
+// WithWriteConcern sets the write concern of the configuration collection,
+// majority with a 5s timeout by default. Weakening it trades durability for
+// latency: an acknowledged version may be lost on failover, and concurrent
+// updates acknowledged by different members may both succeed instead of one
+// failing with ErrConcurrentUpdate.
+func WithWriteConcern[T Config](wc *writeconcern.WriteConcern) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.writeConcern = wc
+	}
+}
+
+// WithReadPreference sets the read preference of the configuration
+// collection, the one of the database by default. Reading from secondaries
+// may return a stale latest version, in which case UpdateConfig fails with
+// ErrConcurrentUpdate until the secondaries catch up.
+func WithReadPreference[T Config](rp *readpref.ReadPref) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.readPref = rp
+	}
+}
+
+// WithOnStart registers a hook invoked once, at the end of Start, with the
+// loaded configuration with defaults applied (the defaulted zero value if no
+// configuration was ever created). Contrary to WithOnUpdate, it is not invoked
+// upon subsequent updates.
+func WithOnStart[T Config](onStart func(conf T)) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.onStart = onStart
+	}
+}
+
+// WithWatchStartAtTime makes the watcher replay all the versions inserted
+// since the input time, e.g. to catch up from the last processed time after a
+// downtime. The repository starts from the latest version created before that
+// time and the update callback is invoked for every replayed version.
+//
+// The change stream must still hold the events since that time (see the
+// oplog window of the deployment). The time has a second precision.
+func WithWatchStartAtTime[T Config](t time.Time) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.watchStartAt = t
+	}
+}
+
+// WithRequireExplicitInit forces an explicit initial configuration: until a
+// first version is created with UpdateConfig, GetConfig and GetLatestVersion
+// return ErrNotInitialized instead of the zero value with defaults applied.
+func WithRequireExplicitInit[T Config]() func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.requireExplicitInit = true
+	}
+}
+
+// WithMetadata stamps the metadata (e.g. environment or region) on every
+// version created by the repository. Versions can be filtered by metadata in
+// listings and an index is created for each metadata key.
+func WithMetadata[T Config](metadata map[string]string) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.metadata = metadata
+	}
+}
+
+// WithDocumentFilter namespaces the repository to the documents of the
+// collection matching the filter (e.g. `bson.M{"type": "appconfig"}`), so that
+// the configuration can share a collection with unrelated documents. The filter
+// fields are stamped on every inserted version and all reads and the watcher
+// ignore documents not matching it.
+//
+// The filter must only hold equality conditions on top-level fields. As the
+// version is used as `_id`, the other documents of the collection must not use
+// numeric `_id` values.
+func WithDocumentFilter[T Config](filter bson.M) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.documentFilter = filter
+	}
+}
+
+// WithWatchPipeline appends the stages to the pipeline of the change stream,
+// after the ones of WithDocumentFilter, so that events are filtered server-side,
+// e.g. `{$match: {operationType: "insert"}}` to skip the deletions of
+// pruning, which the watcher ignores anyway. This saves network and CPU on
+// high-churn shared collections.
+//
+// The watcher applies the versions from the `fullDocument` of the insert
+// events: stages filtering out the insertions of the versions of the
+// repository, or reshaping the events, make it miss updates.
+func WithWatchPipeline[T Config](pipeline mongo.Pipeline) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.watchStages = pipeline
+	}
+}
+
+// WithOnUpdate registers a callback invoked with every new version applied by
+// the watcher. It can be used multiple times: callbacks are invoked in
+// registration order and a panicking callback is recovered and logged without
+// preventing the others from running.
 func WithOnUpdate[T Config](onUpdate func(conf T)) func(repo *WatchedRepo[T]) {
 	return func(repo *WatchedRepo[T]) {
-		repo.onUpdate = onUpdate
+		repo.onUpdate = append(repo.onUpdate, onUpdate)
+	}
+}
+
+// WithOnUpdateDiff registers a callback invoked with the previous and the new
+// configuration, with defaults applied, every time the watcher applies a new
+// version, e.g. to react to a specific field changing. Upon the first version,
+// the previous configuration is the default one. Like WithOnUpdate, it can be
+// used multiple times and panics are recovered; these callbacks run after the
+// ones of WithOnUpdate.
+func WithOnUpdateDiff[T Config](onUpdate func(old, new T)) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.onUpdateDiff = append(repo.onUpdateDiff, onUpdate)
 	}
 }
 
 type WatchedRepo[T Config] struct {
-	lgr             *slog.Logger
-	source          *mongo.Database
+	lgr    *slog.Logger
+	source *mongo.Database
+	// mu guards cfg, cfgWithDefaults, subscriptions and stopping.
+	mu              sync.RWMutex
 	cfg             *Versioned[T]
 	cfgWithDefaults *Versioned[T]
+	subscriptions   map[*subscription[T]]struct{}
+	// stopping is set once the repository starts shutting down: the operations
+	// fail with ErrStopped and the in-flight writes, tracked by writes, are
+	// awaited.
+	stopping bool
+	writes   sync.WaitGroup
+	// cancelWatch stops the background routines started by Start, which close
+	// done once over.
+	cancelWatch context.CancelFunc
+	done        <-chan struct{}
 	// optionally overrideable
 	nowFunc            func() time.Time
 	collectionName     string
 	skipIndexOperation bool
-	configs            *mongo.Collection
-	started            bool
-	onUpdate           func(conf T)
+	operationTimeout   time.Duration
+	writeConcern       *writeconcern.WriteConcern
+	readPref           *readpref.ReadPref
+	store              Store[T]
+	// configs is nil unless the repository relies on MongoDB, scheduled
+	// unless the scheduled updates are enabled too, and audit unless the audit
+	// collection is set too.
+	configs   *mongo.Collection
+	scheduled *mongo.Collection
+	audit     *mongo.Collection
+	topology  topology
+	// starting is set, under mu, once Start is called, and reset if it fails.
+	starting       bool
+	started        bool
+	onUpdate       []func(conf T)
+	onUpdateDiff   []func(old, new T)
+	onStart        func(conf T)
+	onError        func(err error)
+	documentFilter bson.M
+	environment    string
+	// watchStages are appended to the change stream pipeline.
+	watchStages mongo.Pipeline
+	// stalenessCheckInterval is 0 when the staleness check is disabled.
+	stalenessCheckInterval time.Duration
+	scheduledUpdates       bool
+	scheduleCheckInterval  time.Duration
+	watchStartAt           time.Time
+	requireExplicitInit    bool
+	interpolation          bool
+	metadata               map[string]string
+	resumeTokens           ResumeTokenStore
+	maxVersions            int
+	versionTTL             time.Duration
+	rawJSONSchema          []byte
+	jsonSchema             *jsonschema.Schema
+	cipher                 Cipher
+	fieldCipher            Cipher
+	webhooks               []*webhook
+	publishers             []*eventPublisher[T]
+	metrics                MetricsRecorder
+	tracer                 trace.Tracer
+	codec                  Codec
+	bootstrapFile          string
+	bootstrapBy            string
+	envOverride            bool
+	envPrefix              string
+	pollInterval           time.Duration
+	auditCollectionName    string
+	rejectNoopUpdates      bool
+	updateMaxAttempts      int
+	updateBackoff          BackoffFunc
+	createdAtIndexOptions  *options.IndexOptions
+	preUpdateHooks         []func(ctx context.Context, old, candidate T) error
+	postUpdateHooks        []func(ctx context.Context, new *Versioned[T])
+	actorFromContext       func(ctx context.Context) string
+	// startDone is closed once Start completed.
+	startDone chan struct{}
+	// watchLive is closed once the change stream is confirmed live.
+	watchLive     chan struct{}
+	watchLiveOnce sync.Once
+	reconnects    atomic.Uint64
+	// watchDownSince is the time, in Unix nanoseconds, since when the change
+	// stream is down, 0 while it is live.
+	watchDownSince atomic.Int64
 }
 
 func NewWatchedRepo[T Config](
 	args Args,
 	opts ...func(*WatchedRepo[T]),
 ) (*WatchedRepo[T], error) {
-	var zeroValue T
-	typeOfT := reflect.TypeOf(zeroValue)
-	if typeOfT.Kind() != reflect.Ptr {
+	typeOfT := reflect.TypeOf((*T)(nil)).Elem()
+	if typeOfT.Kind() == reflect.Interface {
 		return nil, ErrTypeMustBePointer
 	}
 	wc := writeconcern.Majority()
 	wc.WTimeout = writeConcernTimeout
 	s := &WatchedRepo[T]{
-		lgr:            args.Logger.With("struct", "WatchedRepo"),
-		source:         args.DB,
-		collectionName: defaultConfigurationCollectionName,
+		lgr:              args.Logger.With("struct", "WatchedRepo"),
+		source:           args.DB,
+		collectionName:   defaultConfigurationCollectionName,
+		operationTimeout: defaultOperationTimeout,
+		writeConcern:     wc,
 		nowFunc: func() time.Time {
 			return time.Now().UTC()
 		},
+		startDone: make(chan struct{}),
+		watchLive: make(chan struct{}),
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
-	connectionOpts := options.Collection().
-		SetWriteConcern(wc).
-		SetBSONOptions(&options.BSONOptions{
-			UseJSONStructTags: true,
-		})
-	s.configs = args.DB.Collection(s.collectionName, connectionOpts)
+	if s.versionTTL > 0 && s.versionTTL < minVersionTTL {
+		return nil, ErrVersionTTLTooShort
+	}
+	if s.operationTimeout <= 0 {
+		return nil, ErrInvalidOperationTimeout
+	}
+	if s.scheduledUpdates && s.scheduleCheckInterval <= 0 {
+		return nil, ErrInvalidScheduleInterval
+	}
+	if s.envOverride && s.envPrefix == "" {
+		return nil, ErrEnvOverridePrefixRequired
+	}
+	if err := s.compileJSONSchema(); err != nil {
+		return nil, err
+	}
+	if err := s.checkWebhooks(); err != nil {
+		return nil, err
+	}
+	s.scopeToEnvironment()
+	if s.fieldCipher != nil {
+		if err := checkEncryptTags(typeOfT, map[reflect.Type]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	if s.store == nil {
+		connectionOpts := options.Collection().
+			SetWriteConcern(s.writeConcern).
+			SetBSONOptions(&options.BSONOptions{
+				UseJSONStructTags: true,
+			})
+		if s.readPref != nil {
+			connectionOpts.SetReadPreference(s.readPref)
+		}
+		s.configs = args.DB.Collection(s.collectionName, connectionOpts)
+		if s.scheduledUpdates {
+			s.scheduled = args.DB.Collection(s.collectionName+scheduledCollectionSuffix, connectionOpts)
+		}
+		if s.auditCollectionName != "" {
+			// the audit records are read in transactions, on the primary.
+			s.audit = args.DB.Collection(s.auditCollectionName, options.Collection().
+				SetWriteConcern(s.writeConcern).
+				SetBSONOptions(&options.BSONOptions{UseJSONStructTags: true}))
+		}
+		s.store = &mongoStore[T]{repo: s}
+	}
 
 	return s, nil
 }
@@ -126,44 +433,210 @@ func NewWatchedRepo[T Config](
 // Start is a non-blocking call that starts the store and watches for updates on
 // the persisted configurations.
 //
-// For graceful shutdown, cancel the input context and wait for the returned
-// channel to be closed.
-func (s *WatchedRepo[T]) Start(ctx context.Context) (<-chan struct{}, error) {
-	if !s.skipIndexOperation {
-		if err := s.createIndexes(ctx); err != nil {
+// For graceful shutdown, cancel the input context (or call Stop) and wait for
+// the returned channel to be closed: in-flight writes complete before it is.
+// Start may only be called once: the subsequent calls return ErrAlreadyStarted,
+// unless it failed.
+func (s *WatchedRepo[T]) Start(ctx context.Context) (_ <-chan struct{}, err error) {
+	s.mu.Lock()
+	if s.starting {
+		s.mu.Unlock()
+		return nil, ErrAlreadyStarted
+	}
+	s.starting = true
+	s.mu.Unlock()
+	ctx, s.cancelWatch = context.WithCancel(ctx)
+	var storeDone <-chan struct{}
+	defer func() {
+		if err != nil {
+			s.cancelWatch()
+			if storeDone != nil {
+				// the watcher must be over for Start to be retried.
+				<-storeDone
+			}
+			s.mu.Lock()
+			s.starting = false
+			s.mu.Unlock()
+		}
+	}()
+	ms, isMongo := s.store.(*mongoStore[T])
+	if isMongo {
+		if err := ms.init(ctx); err != nil {
 			return nil, err
 		}
 	}
-
-	done, err := s.watchChanges(ctx)
+	storeDone, err = s.store.Watch(ctx, func(v *Versioned[T]) error {
+		_, err := s.apply(v)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	latest, err := s.getLatest(ctx)
+	if !isMongo {
+		// the MongoDB watcher confirms that it is live on its own.
+		s.watchLiveOnce.Do(func() { close(s.watchLive) })
+	}
+	resuming := false
+	if isMongo && s.resumeTokens != nil {
+		token, err := s.resumeTokens.LoadResumeToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resuming = token != nil
+	}
+	var latest *Versioned[T]
+	if s.watchStartAt.IsZero() || !isMongo || resuming {
+		// the watcher resuming after a saved token may replay older versions
+		// only, which are ignored.
+		latest, err = s.store.Latest(ctx)
+	} else {
+		// the watcher replays the versions created since then.
+		latest, err = s.findLatest(ctx, bson.M{"created_at": bson.M{"$lt": s.watchStartAt}})
+	}
 	if err != nil && !errors.Is(err, ErrConfigurationNotFound) {
 		return nil, err
 	}
-	if errors.Is(err, ErrConfigurationNotFound) {
-		var zeroValue T
-		typeOfT := reflect.TypeOf(zeroValue)
-		if typeOfT.Kind() == reflect.Ptr {
-			valOfT := reflect.New(typeOfT.Elem())
-			zeroValue = valOfT.Interface().(T)
-		}
-		s.cfg = &Versioned[T]{
-			Config: zeroValue,
+	if errors.Is(err, ErrConfigurationNotFound) && s.bootstrapFile != "" {
+		if latest, err = s.bootstrap(ctx); err != nil {
+			return nil, err
 		}
-	} else {
-		s.cfg = latest
 	}
-	if s.cfgWithDefaults, err = copyAndSetDefaults(s.cfg); err != nil {
+	if errors.Is(err, ErrConfigurationNotFound) {
+		latest = emptyVersion[T]()
+	}
+	latestWithDefaults, err := s.localVersion(latest)
+	if err != nil {
 		return nil, err
 	}
+	// the shutdown is only handled once Start cannot fail anymore, for a
+	// failed Start to be retried.
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		defer s.closeSubscriptions()
+		<-storeDone
+		s.settleWrites()
+	}()
+	var done <-chan struct{} = watchDone
+	s.mu.Lock()
+	// the watcher may already have observed a more recent version.
+	if s.cfg == nil || s.cfg.Version < latest.Version {
+		s.cfg = latest
+		s.cfgWithDefaults = latestWithDefaults
+	}
 	s.started = true
+	startCfg := s.cfgWithDefaults
+	s.mu.Unlock()
+	if s.onStart != nil {
+		s.onStart(startCfg.Config)
+	}
+	if s.stalenessCheckInterval > 0 && isMongo {
+		done = allDone(done, s.checkStaleness(ctx))
+	}
+	if s.scheduled != nil {
+		done = allDone(done, s.applyScheduled(ctx))
+	}
+	for _, wh := range s.webhooks {
+		done = allDone(done, s.deliverWebhook(ctx, wh))
+	}
+	for _, p := range s.publishers {
+		done = allDone(done, s.runPublisher(ctx, p))
+	}
+	s.done = done
+	close(s.startDone)
 
 	return done, nil
 }
 
+// Stop shuts the repository down as cancelling the context provided to Start
+// does: new writes are rejected with ErrStopped, in-flight writes complete and
+// the watcher stops. It blocks until the shutdown is over or the input context
+// is done. Once the shutdown began, all the methods but Stop fail with
+// ErrStopped. Calling Stop multiple times is safe.
+func (s *WatchedRepo[T]) Stop(ctx context.Context) error {
+	s.mu.RLock()
+	started := s.started
+	s.mu.RUnlock()
+	if !started {
+		return ErrNotStarted
+	}
+	s.cancelWatch()
+	// done is set by Start after started.
+	select {
+	case <-s.startDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsStarted reports whether the repository is usable: Start completed and the
+// repository is not shutting down, i.e. neither the context provided to Start
+// is done nor Stop was called, e.g. to enable the features relying on it once
+// started (see Repo).
+func (s *WatchedRepo[T]) IsStarted() bool {
+	return s.checkStarted() == nil
+}
+
+// checkStarted returns ErrNotStarted until Start completed, and ErrStopped
+// once the repository is shutting down.
+func (s *WatchedRepo[T]) checkStarted() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.startedErr()
+}
+
+// startedErr implements checkStarted. It must be called with s.mu held.
+func (s *WatchedRepo[T]) startedErr() error {
+	switch {
+	case !s.started:
+		return ErrNotStarted
+	case s.stopping:
+		return ErrStopped
+	}
+	return nil
+}
+
+// beginWrite registers an in-flight write, to be ended with s.writes.Done(). It
+// fails once the repository is shutting down.
+func (s *WatchedRepo[T]) beginWrite() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return ErrStopped
+	}
+	s.writes.Add(1)
+	return nil
+}
+
+// settleWrites rejects new writes and waits for the in-flight ones.
+func (s *WatchedRepo[T]) settleWrites() {
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+	s.writes.Wait()
+}
+
+// WaitReady blocks until Start completed and the change stream watching for
+// updates is confirmed live, or until the context is done. It is stricter than
+// Start returning and is meant for readiness probes; it can be called before
+// or concurrently with Start.
+func (s *WatchedRepo[T]) WaitReady(ctx context.Context) error {
+	for _, ch := range []chan struct{}{s.startDone, s.watchLive} {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
 // GetConfig gets the current user-defined configuration with defaults applied to it.
 func (s *WatchedRepo[T]) GetConfig() (T, error) {
 	v, err := s.GetLatestVersion()
@@ -175,21 +648,88 @@ func (s *WatchedRepo[T]) GetConfig() (T, error) {
 }
 
 // GetLatestVersion returns the latest version of the user-provided configuration
-// along with auditing data.
+// along with auditing data. The version is a copy that the callers are free to
+// modify.
 func (s *WatchedRepo[T]) GetLatestVersion() (*Versioned[T], error) {
-	if !s.started {
-		return nil, ErrNotStarted
+	s.mu.RLock()
+	startedErr, latest := s.startedErr(), s.cfgWithDefaults
+	s.mu.RUnlock()
+	if startedErr != nil {
+		return nil, startedErr
 	}
-	return s.cfgWithDefaults, nil
+	// version 0 means that no configuration was ever created.
+	if s.requireExplicitInit && latest.Version == 0 {
+		return nil, ErrNotInitialized
+	}
+	// a copy, for the callers not to alter the cached version.
+	return deepCopy(latest)
+}
+
+// CurrentVersion returns the version of the cached configuration, e.g. for
+// ETags or change detection, without copying it. Version 0 means that no
+// configuration was ever created.
+func (s *WatchedRepo[T]) CurrentVersion() (uint64, error) {
+	if err := s.checkStarted(); err != nil {
+		return 0, err
+	}
+	return s.cachedVersion(), nil
+}
+
+// GetVersion returns the requested version with defaults applied, as
+// GetLatestVersion does, or ErrConfigurationNotFound if it does not exist.
+func (s *WatchedRepo[T]) GetVersion(ctx context.Context, version uint64) (*Versioned[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	v, err := s.findVersion(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.withDefaults(v)
+}
+
+// findVersion returns the stored version, without defaults.
+func (s *WatchedRepo[T]) findVersion(ctx context.Context, version uint64) (*Versioned[T], error) {
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	var found *Versioned[T]
+	err := s.store.Range(ctxTimeout, ListVersionedConfigsQuery{
+		FromVersion: version,
+		ToVersion:   version + 1,
+	}, func(v *Versioned[T]) error {
+		found = v
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version %d: %w", version, err)
+	}
+	if found == nil {
+		return nil, ErrConfigurationNotFound
+	}
+	return found, nil
 }
 
 // ListVersionedConfigsQuery provide query parameters for listing configurations
 // by version.
 type ListVersionedConfigsQuery struct {
 	// FromVersion version from which retrieve the configs (inclusive)
-	FromVersion uint32
+	FromVersion uint64
 	// ToVersion version until which retrieve the configs (exclusive)
-	ToVersion uint32
+	ToVersion uint64
+	// Metadata restricts the configs to the ones holding all the metadata
+	// entries (optional).
+	Metadata map[string]string
+	// UpdatedBy restricts the configs to the ones created by the author
+	// (optional).
+	UpdatedBy string
+	// Skip is the number of matching versions to skip (optional).
+	Skip int64
+	// Limit is the maximum number of versions to retrieve, 0 for no limit
+	// (optional).
+	Limit int64
+	// Descending lists the newest versions first, e.g. for history views,
+	// rather than the oldest ones (optional).
+	Descending bool
 }
 
 // ListVersionedConfigs returns a list of the user-provided configuration
@@ -197,32 +737,181 @@ type ListVersionedConfigsQuery struct {
 func (s *WatchedRepo[T]) ListVersionedConfigs(
 	ctx context.Context,
 	query ListVersionedConfigsQuery,
-) ([]*Versioned[T], error) {
-	if !s.started {
-		return nil, ErrNotStarted
+) (configs []*Versioned[T], err error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
 	}
-	ctxTimeout, cnl := context.WithTimeout(ctx, operationTimeout)
+	ctx, span := s.startSpan(ctx, "ListVersionedConfigs")
+	defer func() {
+		span.SetAttributes(countAttribute.Int(len(configs)))
+		endSpan(span, err)
+	}()
+	ctxTimeout, cnl := s.operationContext(ctx)
 	defer cnl()
-	opts := options.Find()
-	opts.SetSort(bson.D{{Key: "_id", Value: 1}})
-	cursor, err := s.configs.Find(ctxTimeout, bson.M{
-		"_id": bson.M{"$gte": query.FromVersion, "$lt": query.ToVersion},
-	}, opts)
+	configs = make([]*Versioned[T], 0)
+	err = s.RangeVersions(ctxTimeout, query, func(v *Versioned[T]) error {
+		configs = append(configs, v)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	configs := make([]*Versioned[T], 0)
-	for cursor.Next(ctxTimeout) {
-		var cfg Versioned[T]
-		if err := cursor.Decode(&cfg); err != nil {
-			return nil, fmt.Errorf("failed to decode config: %w", err)
-		}
-		if err := defaults.Set(&cfg); err != nil {
-			return nil, fmt.Errorf("failed to set defaults: %w", err)
+	return configs, nil
+}
+
+// GetLastN returns the n most recent versions, newest first, with defaults
+// applied as ListVersionedConfigs does, e.g. to show the last changes without
+// knowing the current version. Non-positive n return no versions.
+func (s *WatchedRepo[T]) GetLastN(ctx context.Context, n int) ([]*Versioned[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return []*Versioned[T]{}, nil
+	}
+	return s.ListVersionedConfigs(ctx, ListVersionedConfigsQuery{
+		FromVersion: 0,
+		// versions are stored as signed 64-bit integers.
+		ToVersion:  math.MaxInt64,
+		Limit:      int64(n),
+		Descending: true,
+	})
+}
+
+// VersionsPage is a page of versions, see ListVersionedConfigsPage.
+type VersionsPage[T Config] struct {
+	Versions []*Versioned[T]
+	// HasMore reports whether more versions match the query past this page.
+	HasMore bool
+}
+
+// ListVersionedConfigsPage behaves like ListVersionedConfigs but also reports
+// whether more versions follow the page delimited by the Skip and Limit fields
+// of the query. The next page is retrieved by increasing Skip by Limit.
+func (s *WatchedRepo[T]) ListVersionedConfigsPage(
+	ctx context.Context,
+	query ListVersionedConfigsQuery,
+) (*VersionsPage[T], error) {
+	limit := query.Limit
+	if limit > 0 {
+		// the extra version, if any, tells that there is more.
+		query.Limit++
+	}
+	versions, err := s.ListVersionedConfigs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && int64(len(versions)) > limit {
+		return &VersionsPage[T]{Versions: versions[:limit], HasMore: true}, nil
+	}
+	return &VersionsPage[T]{Versions: versions}, nil
+}
+
+// IterVersions returns an iterator over the user-provided configuration
+// versions matching the query, in version order (see Descending). Versions are
+// decoded one at a time so that large ranges can be processed without
+// loading them all into memory.
+//
+// Contrary to ListVersionedConfigs, no operation timeout is applied: the
+// lifetime of the iteration is controlled by the input context. The returned
+// iterator must be closed once done.
+func (s *WatchedRepo[T]) IterVersions(
+	ctx context.Context,
+	query ListVersionedConfigsQuery,
+) (*VersionIterator[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return nil, err
+	}
+	cursor, err := s.findVersions(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionIterator[T]{cursor: cursor, decode: s.decodeVersion}, nil
+}
+
+// RangeVersions hands the versions matching the query, with defaults applied,
+// to fn one at a time, in version order (see Descending), until fn returns an
+// error, which RangeVersions returns, e.g. for exports and reports to process
+// histories of any length with constant memory. ListVersionedConfigs collects
+// them into a slice for the small ranges.
+//
+// Contrary to ListVersionedConfigs, no operation timeout is applied: the
+// lifetime of the iteration is controlled by the input context.
+func (s *WatchedRepo[T]) RangeVersions(
+	ctx context.Context,
+	query ListVersionedConfigsQuery,
+	fn func(v *Versioned[T]) error,
+) error {
+	if err := s.checkStarted(); err != nil {
+		return err
+	}
+	return s.store.Range(ctx, query, func(v *Versioned[T]) error {
+		if err := defaults.Set(v); err != nil {
+			return fmt.Errorf("failed to set defaults: %w", err)
 		}
-		configs = append(configs, &cfg)
+		return fn(v)
+	})
+}
+
+// findVersions returns a cursor over the versions matching the query, in
+// version order.
+func (s *WatchedRepo[T]) findVersions(ctx context.Context, query ListVersionedConfigsQuery, extraOpts ...*options.FindOptions) (*mongo.Cursor, error) {
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: s.versionField(), Value: sortOrder(query.Descending)}})
+	opts.SetSkip(query.Skip)
+	opts.SetLimit(query.Limit)
+	return s.configs.Find(ctx, s.filter(withAuthorFilter(withMetadataFilter(bson.M{
+		s.versionField(): bson.M{"$gte": query.FromVersion, "$lt": query.ToVersion},
+	}, query.Metadata), query.UpdatedBy)), append([]*options.FindOptions{opts}, extraOpts...)...)
+}
+
+// VersionIterator iterates over stored configuration versions. Defaults are
+// applied to every version it yields.
+type VersionIterator[T Config] struct {
+	cursor *mongo.Cursor
+	decode func(raw bson.Raw) (*Versioned[T], error)
+	curr   *Versioned[T]
+	err    error
+}
+
+// Next advances the iterator to the next version. It returns false when the
+// iteration is over or an error occurred, in which case Err reports it.
+func (it *VersionIterator[T]) Next(ctx context.Context) bool {
+	if it.err != nil || !it.cursor.Next(ctx) {
+		return false
 	}
-	return configs, nil
+	cfg, err := it.decode(it.cursor.Current)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if err := defaults.Set(cfg); err != nil {
+		it.err = fmt.Errorf("failed to set defaults: %w", err)
+		return false
+	}
+	it.curr = cfg
+	return true
+}
+
+// Version returns the version the iterator currently points to.
+func (it *VersionIterator[T]) Version() *Versioned[T] {
+	return it.curr
+}
+
+// Err returns the first error encountered during the iteration.
+func (it *VersionIterator[T]) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.cursor.Err()
+}
+
+// Close releases the resources held by the iterator.
+func (it *VersionIterator[T]) Close(ctx context.Context) error {
+	return it.cursor.Close(ctx)
 }
 
 // ListConfigDatesQuery provide query parameters for listing configurations
@@ -232,6 +921,25 @@ type ListConfigDatesQuery struct {
 	From time.Time
 	// To is the time until which retrieve the configs (exclusive)
 	To time.Time
+	// Metadata restricts the configs to the ones holding all the metadata
+	// entries (optional).
+	Metadata map[string]string
+	// Descending lists the newest versions first rather than the oldest ones
+	// (optional).
+	Descending bool
+	// Skip is the number of matching versions to skip (optional).
+	Skip int64
+	// Limit is the maximum number of versions to retrieve, 0 for no limit
+	// (optional).
+	Limit int64
+}
+
+// sortOrder returns the MongoDB sort order.
+func sortOrder(descending bool) int {
+	if descending {
+		return -1
+	}
+	return 1
 }
 
 // ListVersionedConfigsByDate returns a list of the user-provided configuration
@@ -240,29 +948,34 @@ func (s *WatchedRepo[T]) ListVersionedConfigsByDate(
 	ctx context.Context,
 	query ListConfigDatesQuery,
 ) ([]*Versioned[T], error) {
-	if !s.started {
-		return nil, ErrNotStarted
+	if err := s.checkStarted(); err != nil {
+		return nil, err
 	}
-	ctxTimeout, cnl := context.WithTimeout(ctx, operationTimeout)
+	if err := s.mongoOnly(); err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
 	defer cnl()
 	opts := options.Find()
-	opts.SetSort(bson.D{{Key: "created_at", Value: 1}})
-	cursor, err := s.configs.Find(ctxTimeout, bson.M{
+	opts.SetSort(bson.D{{Key: "created_at", Value: sortOrder(query.Descending)}})
+	opts.SetSkip(query.Skip)
+	opts.SetLimit(query.Limit)
+	cursor, err := s.configs.Find(ctxTimeout, s.filter(withMetadataFilter(bson.M{
 		"created_at": bson.M{"$gte": query.From, "$lt": query.To},
-	}, opts)
+	}, query.Metadata)), opts)
 	if err != nil {
 		return nil, err
 	}
 	configs := make([]*Versioned[T], 0)
 	for cursor.Next(ctxTimeout) {
-		var cfg Versioned[T]
-		if err := cursor.Decode(&cfg); err != nil {
-			return nil, fmt.Errorf("failed to decode config: %w", err)
+		cfg, err := s.decodeVersion(cursor.Current)
+		if err != nil {
+			return nil, err
 		}
-		if err := defaults.Set(&cfg); err != nil {
+		if err := defaults.Set(cfg); err != nil {
 			return nil, fmt.Errorf("failed to set defaults: %w", err)
 		}
-		configs = append(configs, &cfg)
+		configs = append(configs, cfg)
 	}
 	return configs, nil
 }
@@ -270,80 +983,336 @@ func (s *WatchedRepo[T]) ListVersionedConfigsByDate(
 type UpdateConfigCmd[T Config] struct {
 	By     string
 	Config T
+	// Reason optionally explains why the configuration is updated, for
+	// auditing. It is stored on the created version.
+	Reason string
+	// Metadata optionally holds extra fields stored on the created version,
+	// along with the ones set with WithMetadata, which take precedence.
+	Metadata map[string]string
+	// Tags optionally label the created version, e.g. to find it with
+	// ListByTag and roll back to it with RollbackToTag.
+	Tags []string
+	// ExpectedVersion, when set, makes the update fail with ErrVersionMismatch
+	// unless it is the latest version (0 when no configuration was ever
+	// created), e.g. for edit forms showing the version being edited. When nil,
+	// the update applies to whatever the latest version is.
+	ExpectedVersion *uint64
 }
 
 // UpdateConfig retrieves the latest configuration, modifies it by calling the
 // underlying `Update` method and creates a new updated version.
 func (s *WatchedRepo[T]) UpdateConfig(ctx context.Context, cmd UpdateConfigCmd[T]) (*Versioned[T], error) {
-	if !s.started {
-		return nil, ErrNotStarted
+	curr, _, err := s.UpdateConfigWithPrev(ctx, cmd)
+	return curr, err
+}
+
+// UpdateConfigWithPrev behaves like UpdateConfig but also returns the version
+// immediately preceding the created one, e.g. to render what changed. The
+// previous version is nil when the created version is the first one.
+func (s *WatchedRepo[T]) UpdateConfigWithPrev(ctx context.Context, cmd UpdateConfigCmd[T]) (curr, prev *Versioned[T], err error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, nil, err
+	}
+	if err := s.beginWrite(); err != nil {
+		return nil, nil, err
 	}
-	ctxTimeout, cnl := context.WithTimeout(ctx, operationTimeout)
+	defer s.writes.Done()
+	cmd.By = s.actorOf(ctx, cmd.By)
+	defer func(start time.Time) { s.observeUpdate(start, err) }(time.Now())
+	ctx, span := s.startSpan(ctx, "UpdateConfig", authorAttribute.String(cmd.By))
+	defer func() {
+		if curr != nil {
+			span.SetAttributes(versionAttribute.Int64(int64(curr.Version)))
+		}
+		span.SetAttributes(conflictAttribute.Bool(errors.Is(err, ErrConcurrentUpdate)))
+		endSpan(span, err)
+	}()
+	ctxTimeout, cnl := s.operationContext(ctx)
 	defer cnl()
-	curr, err := s.getLatest(ctxTimeout)
+	var latest, newVersion *Versioned[T]
+	err = s.retryConflicts(ctxTimeout, cmd, func() error {
+		var err error
+		if latest, err = s.latestOrNil(ctxTimeout); err != nil {
+			return err
+		}
+		if newVersion, err = s.nextVersion(latest, cmd); err != nil {
+			return err
+		}
+		if prev = nil; latest != nil {
+			if prev, err = s.withDefaults(latest); err != nil {
+				return err
+			}
+		}
+		if err := s.preUpdate(ctxTimeout, prev, newVersion.Config); err != nil {
+			return err
+		}
+		return s.store.Insert(ctxTimeout, newVersion)
+	})
 	if err != nil {
-		if errors.Is(err, ErrConfigurationNotFound) {
-			appCfg := cmd.Config
+		return nil, nil, err
+	}
+	if latest != nil && s.maxVersions > 0 && s.configs != nil {
+		if _, err := s.pruneVersions(ctx, s.maxVersions); err != nil {
+			s.lgr.With("error", err).ErrorContext(ctx, "could not prune old versions")
+		}
+	}
+	toRet, err := s.withDefaults(newVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.postUpdate(ctx, toRet)
+	s.notifyWebhooks(toRet)
+	s.notifyPublishers(toRet)
+	return toRet, prev, nil
+}
+
+// ValidateConfig runs the same merge, validations and pre-update hooks as
+// UpdateConfig, and returns the same errors, without creating any version, e.g.
+// to check a configuration before saving it. The hooks cannot tell a
+// validation from an update.
+func (s *WatchedRepo[T]) ValidateConfig(ctx context.Context, cmd UpdateConfigCmd[T]) error {
+	if err := s.checkStarted(); err != nil {
+		return err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	latest, err := s.latestOrNil(ctxTimeout)
+	if err != nil {
+		return err
+	}
+	newVersion, err := s.nextVersion(latest, cmd)
+	if err != nil {
+		return err
+	}
+	var prev *Versioned[T]
+	if latest != nil {
+		if prev, err = s.withDefaults(latest); err != nil {
+			return err
+		}
+	}
+	if err := s.preUpdate(ctxTimeout, prev, newVersion.Config); err != nil {
+		return err
+	}
+	_, err = s.withDefaults(newVersion)
+	return err
+}
+
+// latestOrNil returns the latest stored version, or nil if there is none.
+func (s *WatchedRepo[T]) latestOrNil(ctx context.Context) (*Versioned[T], error) {
+	latest, err := s.store.Latest(ctx)
+	if errors.Is(err, ErrConfigurationNotFound) {
+		return nil, nil
+	}
+	return latest, err
+}
+
+// now returns the creation time of a new record, truncated to the millisecond
+// precision of the timestamps MongoDB stores, so that the returned records equal
+// the ones read back.
+func (s *WatchedRepo[T]) now() time.Time {
+	return s.nowFunc().Truncate(time.Millisecond)
+}
+
+// nextVersion builds the version following the latest one, nil if none, by
+// calling the `Update` method and running the validations.
+func (s *WatchedRepo[T]) nextVersion(latest *Versioned[T], cmd UpdateConfigCmd[T]) (*Versioned[T], error) {
+	if err := checkExpectedVersion(cmd.ExpectedVersion, latest); err != nil {
+		return nil, err
+	}
+	if err := s.validateJSONSchema(cmd.Config); err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		appCfg := cmd.Config
+		if !isValidator(appCfg) {
 			// this is done to validate the first configuration before creating it. It
 			// validates against itself.
 			if err := appCfg.Update(appCfg); err != nil {
 				return nil, err
 			}
-			initCfg := &Versioned[T]{
-				Version:   1,
-				UpdatedBy: cmd.By,
-				CreatedAt: s.nowFunc(),
-				Config:    appCfg,
-			}
-			if err := s.createConfig(ctxTimeout, initCfg); err != nil {
-				return nil, err
-			}
-			toRet, err := copyAndSetDefaults(initCfg)
-			if err != nil {
-				return nil, err
-			}
-			return toRet, nil
 		}
+		if err := s.validate(appCfg); err != nil {
+			return nil, err
+		}
+		return &Versioned[T]{
+			Version:   1,
+			UpdatedBy: cmd.By,
+			CreatedAt: s.now(),
+			Reason:    cmd.Reason,
+			Tags:      cmd.Tags,
+			Metadata:  s.versionMetadata(cmd),
+			Config:    appCfg,
+		}, nil
+	}
+	// `Update` typically assigns slices and maps by reference: working on a copy
+	// keeps the new version isolated from the current one.
+	updatedConfig, err := deepCopy(latest.Config)
+	if err != nil {
 		return nil, err
 	}
-	updatedConfig := curr.Config
 	if err := updatedConfig.Update(cmd.Config); err != nil {
 		return nil, err
 	}
-	newVersion := &Versioned[T]{
-		Version:   curr.Version + 1,
+	if !isPointer[T]() {
+		// the update could not modify the copy it received: the new
+		// configuration replaces the current one.
+		if updatedConfig, err = deepCopy(cmd.Config); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.validate(updatedConfig); err != nil {
+		return nil, err
+	}
+	if s.rejectNoopUpdates {
+		if err := checkChanged(latest.Config, updatedConfig); err != nil {
+			return nil, err
+		}
+	}
+	return &Versioned[T]{
+		Version:   latest.Version + 1,
 		UpdatedBy: cmd.By,
-		CreatedAt: s.nowFunc(),
+		CreatedAt: s.now(),
+		Reason:    cmd.Reason,
+		Tags:      cmd.Tags,
+		Metadata:  s.versionMetadata(cmd),
 		Config:    updatedConfig,
+	}, nil
+}
+
+// versionMetadata returns the metadata of the version created by the command.
+func (s *WatchedRepo[T]) versionMetadata(cmd UpdateConfigCmd[T]) map[string]string {
+	if len(cmd.Metadata) == 0 {
+		return s.metadata
 	}
-	if err := s.createConfig(ctxTimeout, newVersion); err != nil {
-		return nil, err
+	metadata := make(map[string]string, len(cmd.Metadata)+len(s.metadata))
+	for k, v := range cmd.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range s.metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// checkExpectedVersion verifies that the latest version, nil if none, is the
+// expected one, if any.
+func checkExpectedVersion[T Config](expected *uint64, latest *Versioned[T]) error {
+	if expected == nil {
+		return nil
+	}
+	var current uint64
+	if latest != nil {
+		current = latest.Version
+	}
+	if current != *expected {
+		return fmt.Errorf("%w: expected version %d, latest is %d", ErrVersionMismatch, *expected, current)
+	}
+	return nil
+}
+
+// validate runs the ValidateAll or Validate method of the configuration, if
+// implemented, and the validations that do not depend on the configuration
+// type. The latter run with defaults applied, so that zero values left for
+// defaults are not rejected.
+func (s *WatchedRepo[T]) validate(cfg T) error {
+	switch v := any(cfg).(type) {
+	case MultiValidator:
+		if err := errors.Join(v.ValidateAll()...); err != nil {
+			return err
+		}
+	case Validator:
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	withDefaults, err := copyAndSetDefaults(cfg)
+	if err != nil {
+		return err
+	}
+	if err := validateEnums(withDefaults); err != nil {
+		return err
+	}
+	if s.interpolation {
+		if _, err := interpolate(withDefaults); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isValidator reports whether the configuration validates itself.
+func isValidator(cfg Config) bool {
+	switch cfg.(type) {
+	case MultiValidator, Validator:
+		return true
 	}
-	toRet, err := copyAndSetDefaults(newVersion)
+	return false
+}
+
+// withDefaults returns a copy of the version as exposed to the users: with
+// defaults applied and, if enabled, interpolated.
+func (s *WatchedRepo[T]) withDefaults(v *Versioned[T]) (*Versioned[T], error) {
+	return s.resolve(v, false)
+}
+
+// localVersion returns a copy of the version as served by the local getters:
+// as by withDefaults, and overridden from the environment if enabled (see
+// WithEnvOverride).
+func (s *WatchedRepo[T]) localVersion(v *Versioned[T]) (*Versioned[T], error) {
+	return s.resolve(v, s.envOverride)
+}
+
+func (s *WatchedRepo[T]) resolve(v *Versioned[T], override bool) (*Versioned[T], error) {
+	cp, err := copyAndSetDefaults(v)
 	if err != nil {
 		return nil, err
 	}
-	return toRet, err
+	if override {
+		if cp.Config, err = overrideFromEnv(cp.Config, s.envPrefix); err != nil {
+			return nil, err
+		}
+		if err := s.validate(cp.Config); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEnvOverride, err)
+		}
+	}
+	if !s.interpolation {
+		return cp, nil
+	}
+	if cp.Config, err = interpolate(cp.Config); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (s *WatchedRepo[T]) getLatest(ctx context.Context) (latest *Versioned[T], err error) {
+	ctx, span := s.startSpan(ctx, "getLatest")
+	defer func() {
+		if latest != nil {
+			span.SetAttributes(versionAttribute.Int64(int64(latest.Version)))
+		}
+		endSpan(span, err)
+	}()
+	return s.findLatest(ctx, bson.M{})
 }
 
-func (s *WatchedRepo[T]) getLatest(ctx context.Context) (*Versioned[T], error) {
-	ctxTimeout, cnl := context.WithTimeout(ctx, operationTimeout)
+// findLatest returns the latest version matching the filter.
+func (s *WatchedRepo[T]) findLatest(ctx context.Context, filter bson.M) (*Versioned[T], error) {
+	ctxTimeout, cnl := s.operationContext(ctx)
 	defer cnl()
 	opts := options.Find()
 	opts.SetLimit(1)
-	opts.SetSort(bson.D{{Key: "_id", Value: -1}})
-	cursor, err := s.configs.Find(ctxTimeout, bson.M{}, opts)
+	opts.SetSort(bson.D{{Key: s.versionField(), Value: -1}})
+	cursor, err := s.configs.Find(ctxTimeout, s.filter(filter), opts)
 	if err != nil {
 		return nil, err
 	}
 	configs := make([]*Versioned[T], 0)
 	for cursor.Next(ctxTimeout) {
-		var cfg Versioned[T]
-		err = cursor.Decode(&cfg)
+		cfg, err := s.decodeVersion(cursor.Current)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode config: %w", err)
+			return nil, err
 		}
-		configs = append(configs, &cfg)
+		configs = append(configs, cfg)
 	}
 	if len(configs) == 0 {
 		return nil, ErrConfigurationNotFound
@@ -351,146 +1320,396 @@ func (s *WatchedRepo[T]) getLatest(ctx context.Context) (*Versioned[T], error) {
 	return configs[0], nil
 }
 
+// versionedDocument is the persisted form of a version: the document filter
+// fields, if any, are stamped next to the version fields.
+type versionedDocument[T Config] struct {
+	Versioned[T]  `bson:",inline"`
+	Discriminator bson.M `bson:",inline"`
+}
+
+// filter restricts the input filter to the documents matching the document
+// filter of the repository.
+func (s *WatchedRepo[T]) filter(f bson.M) bson.M {
+	for k, v := range s.documentFilter {
+		f[k] = v
+	}
+	return f
+}
+
+// withMetadataFilter restricts the input filter to the documents holding all
+// the metadata entries.
+func withMetadataFilter(f bson.M, metadata map[string]string) bson.M {
+	for k, v := range metadata {
+		f["metadata."+k] = v
+	}
+	return f
+}
+
+// withAuthorFilter restricts the input filter to the documents created by the
+// author, if any.
+func withAuthorFilter(f bson.M, author string) bson.M {
+	if author != "" {
+		f["updated_by"] = author
+	}
+	return f
+}
+
+// watchPipeline returns the change-stream pipeline restricting the events to
+// the versions of the repository, followed by the stages set with
+// WithWatchPipeline. The inserts are matched on the document filter. The
+// updates, replacements and deletions carry the _id of the version only: they
+// are matched on the environment it holds, if any, and otherwise let through
+// to reconcile from the filtered versions. The other events, e.g.
+// invalidations, concern the whole collection.
+func (s *WatchedRepo[T]) watchPipeline() mongo.Pipeline {
+	pipeline := mongo.Pipeline{}
+	if len(s.documentFilter) > 0 {
+		inserts := bson.D{{Key: "operationType", Value: "insert"}}
+		for k, v := range s.documentFilter {
+			inserts = append(inserts, bson.E{Key: "fullDocument." + k, Value: v})
+		}
+		changes := bson.D{{Key: "operationType", Value: bson.M{"$in": documentChanges}}}
+		if s.environment != "" {
+			changes = append(changes, bson.E{Key: "documentKey._id." + environmentField, Value: s.environment})
+		}
+		others := bson.D{{Key: "operationType", Value: bson.M{"$nin": append(bson.A{"insert"}, documentChanges...)}}}
+		match := bson.D{{Key: "$or", Value: bson.A{inserts, changes, others}}}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: match}})
+	}
+	return append(pipeline, s.watchStages...)
+}
+
+// documentChanges are the change-stream events modifying an existing document.
+var documentChanges = bson.A{"update", "replace", "delete"}
+
+// createConfig inserts the version, bounded by the operation timeout unless
+// the input context has a deadline.
 func (s *WatchedRepo[T]) createConfig(ctx context.Context, cfg *Versioned[T]) error {
-	ctxTimeout, cnl := context.WithTimeout(ctx, operationTimeout)
+	ctxTimeout, cnl := s.operationContext(ctx)
 	defer cnl()
-	_, err := s.configs.InsertOne(ctxTimeout, cfg)
+	doc, err := s.document(cfg)
+	if err != nil {
+		return err
+	}
+	err = s.auditedWrite(ctxTimeout, cfg, cfg.CreatedAt, func(ctx context.Context) error {
+		_, err := s.configs.InsertOne(ctx, doc)
+		return err
+	})
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
 			return ErrConcurrentUpdate
 		}
 		return fmt.Errorf("create config failed: %w", err)
 	}
+	if s.versionTTL > 0 && cfg.Version > 1 {
+		if err := s.markSuperseded(ctxTimeout, cfg.Version-1); err != nil {
+			s.lgr.With("error", err, "version", cfg.Version-1).
+				ErrorContext(ctx, "could not make the superseded version expire")
+		}
+	}
 	return nil
 }
 
 const (
-	operationTimeout                   = 5 * time.Second
+	defaultOperationTimeout            = 5 * time.Second
 	writeConcernTimeout                = 5 * time.Second
 	indexCreateTimeout                 = 30 * time.Second
 	defaultConfigurationCollectionName = "config"
 )
 
-//type store interface {
-//	// GetLatestConfig gets the latest configuration
-//	GetLatestConfig(ctx context.Context) (*Config, error)
-//	// GetConfig gets the latest configuration
-//	GetConfig(ctx context.Context, version uint64) (*Config, error)
-//	// ListConfigs lists the configurations matching the query parameters
-//	ListConfigs(ctx context.Context, query ListConfigQuery) ([]*Config, error)
-//	// UpdateConfig Updates the latest config version and generates a new one with
-//	// the changed fields and bumps the version.
-//	UpdateConfig(ctx context.Context, updateFunc UpdateConfigFunc) error
-//	// WatchConfig receives change-events for config changes
-//	WatchConfig(ctx context.Context) (<-chan models.changeEvent[Config], error)
-//}
-
-func (s *WatchedRepo[T]) watchChanges(ctx context.Context) (<-chan struct{}, error) {
+// operationContext returns the context of a database operation: the input one
+// if it has a deadline, otherwise one timing out after the operation timeout.
+func (s *WatchedRepo[T]) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.operationTimeout)
+}
+
+func (s *WatchedRepo[T]) watchChanges(ctx context.Context, onVersion func(v *Versioned[T]) error) (<-chan struct{}, error) {
 	done := make(chan struct{})
-	cs, err := s.configs.Watch(
-		ctx,
-		mongo.Pipeline{},
-	)
+	cs, err := s.openChangeStream(ctx, nil)
 	if err != nil {
+		if changeStreamsUnsupported(s.topology, err) {
+			return nil, fmt.Errorf("%w: %w", ErrChangeStreamsUnsupported, err)
+		}
 		return nil, fmt.Errorf("error watching configs: %w", err)
 	}
 	go func() {
 		defer close(done)
-		s.iterateChangeStream(ctx, cs)
+		s.watch(ctx, cs, onVersion)
 	}()
 
 	return done, nil
 }
 
-type changeStreamDto[T Config] struct {
-	DocumentKey   documentKeyDto `bson:"documentKey"`
-	OperationType string         `bson:"operationType"`
-	FullDocument  *Versioned[T]  `bson:"fullDocument"`
-}
-
-type documentKeyDto struct {
-	ID uint64 `bson:"_id,omitempty"`
+type changeStreamDto struct {
+	OperationType string `bson:"operationType"`
+	// FullDocument is decoded by decodeVersion, which decrypts it if needed.
+	FullDocument bson.Raw `bson:"fullDocument"`
 }
 
-func (s *WatchedRepo[T]) iterateChangeStream(ctx context.Context, cs *mongo.ChangeStream) {
+// iterateChangeStream processes the events of the change stream until it
+// fails or the context is done. It reports whether the stream was confirmed
+// live.
+func (s *WatchedRepo[T]) iterateChangeStream(ctx context.Context, cs *mongo.ChangeStream, onVersion func(v *Versioned[T]) error) (bool, error) {
 	defer cs.Close(ctx)
-	for cs.Next(ctx) {
-		var dto changeStreamDto[T]
+	// a first non-blocking round trip confirms that the stream is live.
+	hasEvent := cs.TryNext(ctx)
+	if !hasEvent && cs.Err() != nil {
+		return false, fmt.Errorf("error confirming change stream: %w", cs.Err())
+	}
+	s.watchLiveOnce.Do(func() { close(s.watchLive) })
+	s.watchDownSince.Store(0)
+	invalidated := false
+	for hasEvent || cs.Next(ctx) {
+		hasEvent = false
+		var dto changeStreamDto
 		if err := cs.Decode(&dto); err != nil {
-			s.lgr.With("error", err).
-				ErrorContext(ctx, "error decoding change stream element")
+			s.observeDecodeError()
+			s.reportError(ctx, "error decoding change stream element", eventError(cs, err))
 		} else {
+			s.observeEvent(dto.OperationType)
 			switch dto.OperationType {
 			case "insert":
-				s.cfg = dto.FullDocument
-				if s.cfgWithDefaults, err = copyAndSetDefaults(s.cfg); err != nil {
-					s.lgr.With("error", err).ErrorContext(ctx, "could not set defaults")
-				}
-				if s.onUpdate != nil {
-					s.onUpdate(s.cfgWithDefaults.Config)
+				s.processInsert(ctx, cs, dto, onVersion)
+			case "update", "replace", "delete":
+				// old versions are deleted by pruning, which never deletes the
+				// current one, and updated by WithVersionTTL: only the changes of
+				// the current one matter.
+				if v := eventVersion(cs); v == 0 || v >= s.cachedVersion() {
+					s.processReconcile(ctx, cs, dto)
 				}
+			case "drop", "rename":
+				// followed by an invalidate event.
+			case "invalidate":
+				// the stream ends with the event.
+				invalidated = true
 			default:
-				s.lgr.With("operationType", dto.OperationType).ErrorContext(ctx, "invalid or unexpected operation")
-				continue
+				s.reportError(ctx, "invalid or unexpected operation", eventError(cs, ErrUnexpectedOperation))
 			}
 		}
+		s.saveResumeToken(ctx, cs)
 	}
+	if err := cs.Err(); err != nil {
+		return true, err
+	}
+	if invalidated {
+		return true, errChangeStreamInvalidated
+	}
+	return true, errChangeStreamClosed
 }
 
-func (s *WatchedRepo[T]) createIndexes(ctx context.Context) error {
-	ctx, cnl := context.WithTimeout(context.Background(), indexCreateTimeout)
-	defer cnl()
+// processInsert decodes and applies the version inserted by the event.
+func (s *WatchedRepo[T]) processInsert(ctx context.Context, cs *mongo.ChangeStream, dto changeStreamDto, onVersion func(v *Versioned[T]) error) {
+	_, span := s.startSpan(ctx, "changeStreamEvent", operationTypeAttribute.String(dto.OperationType))
+	v, err := s.decodeVersion(dto.FullDocument)
+	if err != nil {
+		s.observeDecodeError()
+		s.reportError(ctx, "error decoding change stream element", eventError(cs, err))
+		endSpan(span, err)
+		return
+	}
+	span.SetAttributes(versionAttribute.Int64(int64(v.Version)), authorAttribute.String(v.UpdatedBy))
+	if err = onVersion(v); err != nil {
+		s.reportError(ctx, "could not apply new version", eventError(cs, err))
+	}
+	endSpan(span, err)
+}
 
-	_, err := s.configs.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys: bson.D{
-			{Key: "created_at", Value: 1},
-		},
-		Options: options.Index().SetName("idx_created_at_inc"),
-	})
+// processReconcile reconciles the cached configuration with the stored versions
+// after the event modified or deleted a version out of the repository.
+func (s *WatchedRepo[T]) processReconcile(ctx context.Context, cs *mongo.ChangeStream, dto changeStreamDto) {
+	_, span := s.startSpan(ctx, "changeStreamEvent", operationTypeAttribute.String(dto.OperationType))
+	s.lgr.With("operationType", dto.OperationType, "version", eventVersion(cs)).
+		WarnContext(ctx, "version modified out of the repository, reconciling")
+	err := s.reconcile(ctx)
+	if err != nil {
+		s.reportError(ctx, "could not reconcile configuration", eventError(cs, err))
+	}
+	endSpan(span, err)
+}
+
+// reconcile makes the latest stored version the current one, even if it is not
+// more recent than the cached one, e.g. after versions were edited or deleted
+// out of the repository. The zero configuration with its defaults becomes the
+// current one when no version remains.
+func (s *WatchedRepo[T]) reconcile(ctx context.Context) error {
+	latest, err := s.store.Latest(ctx)
+	if errors.Is(err, ErrConfigurationNotFound) {
+		latest, err = emptyVersion[T](), nil
+	}
 	if err != nil {
 		return err
 	}
+	_, err = s.applyVersion(latest, true)
+	return err
+}
 
-	return nil
+// cachedVersion returns the number of the cached version.
+func (s *WatchedRepo[T]) cachedVersion() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.cfg == nil {
+		return 0
+	}
+	return s.cfg.Version
 }
 
-func deepCopy[T any](orig T) (T, error) {
-	b, err := json.Marshal(orig)
+// apply makes the version the current one, notifying the subscriptions and the
+// update callback. Versions older than the current one are ignored (they may be
+// inserted by imports); apply reports whether the version was applied.
+func (s *WatchedRepo[T]) apply(latest *Versioned[T]) (bool, error) {
+	return s.applyVersion(latest, false)
+}
+
+// applyVersion applies the version if it is more recent than the current one
+// or, when reconciling with the stored versions, whenever it differs from it.
+func (s *WatchedRepo[T]) applyVersion(latest *Versioned[T], reconciling bool) (bool, error) {
+	withDefaults, err := s.localVersion(latest)
 	if err != nil {
-		var zeroV T
-		return zeroV, err
+		return false, err
+	}
+	s.mu.Lock()
+	if s.cfg != nil && (reconciling && reflect.DeepEqual(s.cfg, latest) ||
+		!reconciling && latest.Version <= s.cfg.Version) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	prev := s.cfgWithDefaults
+	if prev == nil {
+		// the watcher applied a version before Start loaded the latest one.
+		cfg, err := defaultConfig[T]()
+		if err != nil {
+			s.mu.Unlock()
+			return false, err
+		}
+		prev = &Versioned[T]{Config: cfg}
+	}
+	s.cfg = latest
+	s.cfgWithDefaults = withDefaults
+	s.publish(withDefaults)
+	s.mu.Unlock()
+	for i, onUpdate := range s.onUpdate {
+		s.notifyUpdate(i, func() { onUpdate(withDefaults.Config) })
+	}
+	for i, onUpdate := range s.onUpdateDiff {
+		s.notifyUpdate(len(s.onUpdate)+i, func() { onUpdate(prev.Config, withDefaults.Config) })
+	}
+	return true, nil
+}
+
+// notifyUpdate invokes the i-th update callback, recovering from its panics.
+func (s *WatchedRepo[T]) notifyUpdate(i int, notify func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.lgr.With("panic", r, "callback", i).Error("update callback panicked")
+		}
+	}()
+	notify()
+}
+
+func (s *WatchedRepo[T]) createIndexes(ctx context.Context) error {
+	ctx, cnl := context.WithTimeout(ctx, indexCreateTimeout)
+	defer cnl()
+
+	for _, idx := range s.indexes() {
+		_, err := idx.coll.Indexes().CreateOne(ctx, idx.model)
+		switch {
+		case idx.ttl && isIndexOptionsConflict(err):
+			// the index exists with another expiry.
+			err = s.setVersionTTL(ctx)
+		case idx.createdAt && isIndexConflict(err):
+			// the options set with WithIndexOptions changed.
+			err = replaceIndex(ctx, idx.coll, idx.model)
+		}
+		if err != nil {
+			return fmt.Errorf("could not create index %s: %w", *idx.model.Options.Name, err)
+		}
+	}
+	if s.versionTTL == 0 {
+		// the versions stop expiring.
+		return dropIndex(ctx, s.configs, ttlIndexName)
 	}
-	var copyValue T
-	typeOfT := reflect.TypeOf(copyValue)
+	return nil
+}
+
+// allDone returns a channel closed once all the input channels are closed.
+func allDone(chs ...<-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, ch := range chs {
+			<-ch
+		}
+	}()
+	return done
+}
+
+// unmarshalNew unmarshals the JSON into a newly allocated value.
+func unmarshalNew[T any](b []byte) (T, error) {
+	return decodeNew[T](JSONCodec{}, b)
+}
+
+// emptyVersion returns the version 0 of the zero configuration, current when no
+// configuration was ever created.
+func emptyVersion[T Config]() *Versioned[T] {
+	var zeroValue T
+	typeOfT := reflect.TypeOf(zeroValue)
 	if typeOfT.Kind() == reflect.Ptr {
 		valOfT := reflect.New(typeOfT.Elem())
-		copyValue = valOfT.Interface().(T)
-		if err := json.Unmarshal(b, copyValue); err != nil {
-			var zeroV T
-			return zeroV, err
-		}
-		return copyValue, nil
+		zeroValue = valOfT.Interface().(T)
 	}
-	if err := json.Unmarshal(b, &copyValue); err != nil {
-		var zeroV T
-		return zeroV, err
+	return &Versioned[T]{
+		Config: zeroValue,
 	}
-	return copyValue, nil
 }
 
+// defaultConfig returns a new configuration only holding the default values.
+func defaultConfig[T any]() (T, error) {
+	empty, err := unmarshalNew[T]([]byte("{}"))
+	if err != nil {
+		return empty, err
+	}
+	return copyAndSetDefaults(empty)
+}
+
+// copyAndSetDefaults returns a copy of the configuration with the `default`
+// tags applied to its zero fields. Only nil slices and maps are zero: the empty
+// ones are kept as they are, overriding the defaults, but for the "omitempty"
+// ones, which are not stored and thus reset by the copy. The nil pointers to
+// structs carrying `default` tags are allocated for their defaults to apply,
+// and the default entries of the maps are merged into the stored ones (see
+// prepareDefaults).
 func copyAndSetDefaults[T any](orig T) (T, error) {
 	cp, err := deepCopy(orig)
 	if err != nil {
 		var zero T
 		return zero, err
 	}
-	if err := defaults.Set(cp); err != nil {
+	// defaults are set through a pointer, which value types are not.
+	var target any = &cp
+	if isPointer[T]() {
+		target = cp
+	}
+	if v := reflect.ValueOf(target); !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		if err := prepareDefaults(v.Elem(), map[reflect.Type]bool{}); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+	if err := defaults.Set(target); err != nil {
 		var zero T
 		return zero, err
 	}
 	return cp, nil
 }
 
+// isPointer reports whether T is a pointer type.
+func isPointer[T any]() bool {
+	return reflect.TypeOf((*T)(nil)).Elem().Kind() == reflect.Pointer
+}
+
 // endpoint to get config, endpoint to list config versions, endpoint to update config
 // GET /configs/latest - latest
 // GET /configs/<version> - specific version
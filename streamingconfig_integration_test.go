@@ -3,8 +3,12 @@ package streamingconfig_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -16,6 +20,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 type appConfigV0 struct {
@@ -76,6 +82,39 @@ func (a *appConfigV1) validate() error {
 	return nil
 }
 
+type enumAppConfig struct {
+	LogLevel slog.Level `json:"logLevel" enum:"DEBUG,INFO,WARN,ERROR" default:"\"WARN\""`
+}
+
+func (a *enumAppConfig) Update(new config.Config) error {
+	newCfg, ok := new.(*enumAppConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	a.LogLevel = newCfg.LogLevel
+	return nil
+}
+
+type secretAppConfig struct {
+	Name     string         `json:"name"`
+	Password string         `json:"password" encrypt:"true"`
+	Database secretDBConfig `json:"database"`
+}
+
+type secretDBConfig struct {
+	Host  string `json:"host"`
+	Token string `json:"token" encrypt:"true"`
+}
+
+func (a *secretAppConfig) Update(new config.Config) error {
+	newCfg, ok := new.(*secretAppConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	*a = *newCfg
+	return nil
+}
+
 func NewTestStore[T config.Config](
 	t *testing.T,
 	db *mongo.Database,
@@ -203,11 +242,11 @@ func Test_ConfigCreateFindAndUpdateConfiguration(t *testing.T) {
 			Config:    v1WithDefaults,
 		}, cV1)
 
-		require.EventuallyWithT(t, func(t *assert.CollectT) {
-			gotTwo, err := configStoreTwo.GetLatestVersion()
-			assert.NoError(t, err)
-			assert.Equal(t, cV1, gotTwo)
-		}, 5*time.Second, 100*time.Millisecond)
+		waitCtx, waitCnl := context.WithTimeout(ctx, 5*time.Second)
+		defer waitCnl()
+		gotTwo, err := configStoreTwo.WaitForVersion(waitCtx, cV1.Version)
+		require.NoError(t, err)
+		require.Equal(t, cV1, gotTwo)
 
 		t.Run("failed update due to validation failure", func(t *testing.T) {
 			badConfig := &appConfigV0{Duration: -1 * time.Second}
@@ -241,11 +280,11 @@ func Test_ConfigCreateFindAndUpdateConfiguration(t *testing.T) {
 				Config:    setV2,
 			}, cV2)
 
-			require.EventuallyWithT(t, func(t *assert.CollectT) {
-				gotOne, err := configStoreOne.GetLatestVersion()
-				assert.NoError(t, err)
-				assert.Equal(t, cV2, gotOne)
-			}, 5*time.Second, 100*time.Millisecond)
+			waitCtx, waitCnl := context.WithTimeout(ctx, 5*time.Second)
+			defer waitCnl()
+			gotOne, err := configStoreOne.WaitForVersion(waitCtx, cV2.Version)
+			require.NoError(t, err)
+			require.Equal(t, cV2, gotOne)
 
 			t.Run("find 2 versions", func(t *testing.T) {
 				configsByVersion, err := configStoreOne.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
@@ -408,6 +447,2501 @@ func Test_ConfigBackwardCompatibility(t *testing.T) {
 	})
 }
 
+func Test_ConfigDocumentFilter(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	coll := f.db.Collection("config")
+	_, err := coll.InsertMany(ctx, []any{
+		bson.M{"_id": 1000, "type": "other", "name": "foreign"},
+		bson.M{"_id": primitive.NewObjectID(), "type": "other", "name": "foreign"},
+	})
+	require.NoError(t, err)
+
+	filter := bson.M{"type": "appconfig"}
+	configStoreOne := NewTestStore[*appConfigV0](t, f.db, config.WithDocumentFilter[*appConfigV0](filter))
+	done1, err := configStoreOne.Start(ctx)
+	require.NoError(t, err)
+	configStoreTwo := NewTestStore[*appConfigV0](t, f.db, config.WithDocumentFilter[*appConfigV0](filter))
+	done2, err := configStoreTwo.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done1, 5*time.Second)
+		doneOrTimeout(t, done2, 5*time.Second)
+	})
+
+	t.Run("foreign documents are ignored on start", func(t *testing.T) {
+		got, err := configStoreOne.GetLatestVersion()
+		require.NoError(t, err)
+		require.Equal(t, &config.Versioned[*appConfigV0]{
+			Config: &appConfigV0{Name: "bobby"},
+		}, got)
+	})
+
+	t.Run("versions are stamped and isolated", func(t *testing.T) {
+		cV1, err := configStoreOne.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: "n1"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), cV1.Version)
+
+		var raw bson.M
+		require.NoError(t, coll.FindOne(ctx, bson.M{"_id": 1}).Decode(&raw))
+		require.Equal(t, "appconfig", raw["type"])
+
+		require.EventuallyWithT(t, func(t *assert.CollectT) {
+			gotTwo, err := configStoreTwo.GetLatestVersion()
+			assert.NoError(t, err)
+			assert.Equal(t, cV1, gotTwo)
+		}, 5*time.Second, 100*time.Millisecond)
+
+		_, err = coll.InsertOne(ctx, bson.M{"_id": 2000, "type": "other", "name": "foreign"})
+		require.NoError(t, err)
+
+		versions, err := configStoreTwo.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+			FromVersion: 0,
+			ToVersion:   3000,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []*config.Versioned[*appConfigV0]{cV1}, versions)
+
+		cV2, err := configStoreTwo.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u2",
+			Config: &appConfigV0{Name: "n2"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), cV2.Version)
+		require.EventuallyWithT(t, func(t *assert.CollectT) {
+			gotOne, err := configStoreOne.GetLatestVersion()
+			assert.NoError(t, err)
+			assert.Equal(t, cV2, gotOne)
+		}, 5*time.Second, 100*time.Millisecond)
+	})
+}
+
+func Test_ConfigOnStart(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+
+	var calls []*appConfigV0
+	configStore := NewTestStore[*appConfigV0](
+		t,
+		f.db,
+		config.WithOnStart[*appConfigV0](func(conf *appConfigV0) {
+			calls = append(calls, conf)
+		}),
+	)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	require.Equal(t, []*appConfigV0{{Name: "bobby"}}, calls)
+
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		cfg, err := configStore.GetConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, "n1", cfg.Name)
+	}, 5*time.Second, 100*time.Millisecond)
+	require.Len(t, calls, 1)
+}
+
+func Test_ConfigObserve(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	_, _, _, err := configStore.Observe(ctx)
+	require.ErrorIs(t, err, config.ErrNotStarted)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	t.Run("snapshot and updates", func(t *testing.T) {
+		snapshot, updates, cancel, err := configStore.Observe(ctx)
+		require.NoError(t, err)
+		defer cancel()
+		require.Equal(t, &config.Versioned[*appConfigV0]{
+			Config: &appConfigV0{Name: "bobby"},
+		}, snapshot)
+
+		cV1, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: "n1"},
+		})
+		require.NoError(t, err)
+		select {
+		case got := <-updates:
+			require.Equal(t, cV1, got)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for update")
+		}
+	})
+
+	t.Run("cancel closes the channel", func(t *testing.T) {
+		_, updates, cancel, err := configStore.Observe(ctx)
+		require.NoError(t, err)
+		cancel()
+		cancel()
+		channelClosedOrTimeout(t, updates, 5*time.Second)
+	})
+
+	t.Run("context cancellation closes the channel", func(t *testing.T) {
+		observeCtx, observeCnl := context.WithCancel(ctx)
+		_, updates, cancel, err := configStore.Observe(observeCtx)
+		require.NoError(t, err)
+		defer cancel()
+		observeCnl()
+		channelClosedOrTimeout(t, updates, 5*time.Second)
+	})
+
+	t.Run("no goroutine leak after cancel", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+		for i := 0; i < 100; i++ {
+			_, _, cancel, err := configStore.Observe(ctx)
+			require.NoError(t, err)
+			cancel()
+		}
+		require.Eventually(t, func() bool {
+			return runtime.NumGoroutine() <= before
+		}, 5*time.Second, 100*time.Millisecond)
+	})
+}
+
+func Test_ConfigSubscribe(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cnl)
+
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	// subscriptions can be made before starting.
+	first := configStore.Subscribe(ctx)
+	storeCtx, stop := context.WithCancel(ctx)
+	done, err := configStore.Start(storeCtx)
+	require.NoError(t, err)
+	second := configStore.Subscribe(ctx)
+	subCtx, unsubscribe := context.WithCancel(ctx)
+	third := configStore.Subscribe(subCtx)
+	unsubscribe()
+	channelClosedOrTimeout(t, third, 5*time.Second)
+
+	cV1, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+	for _, updates := range []<-chan *config.Versioned[*appConfigV0]{first, second} {
+		select {
+		case got := <-updates:
+			require.Equal(t, cV1, got)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for update")
+		}
+	}
+
+	stop()
+	doneOrTimeout(t, done, 5*time.Second)
+	channelClosedOrTimeout(t, first, 5*time.Second)
+	channelClosedOrTimeout(t, second, 5*time.Second)
+	channelClosedOrTimeout(t, configStore.Subscribe(ctx), 5*time.Second)
+}
+
+func Test_ConfigMultipleOnUpdate(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) func(conf *appConfigV0) {
+		return func(conf *appConfigV0) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, name+":"+conf.Name)
+		}
+	}
+	configStore := NewTestStore[*appConfigV0](
+		t,
+		f.db,
+		config.WithOnUpdate[*appConfigV0](record("first")),
+		config.WithOnUpdate[*appConfigV0](func(conf *appConfigV0) {
+			panic("boom")
+		}),
+		config.WithOnUpdate[*appConfigV0](record("third")),
+	)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	for _, name := range []string{"n1", "n2"} {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: name},
+		})
+		require.NoError(t, err)
+	}
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"first:n1", "third:n1", "first:n2", "third:n2"}, calls)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_ConfigOnUpdateDiff(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	var mu sync.Mutex
+	var diffs [][2]string
+	configStore := NewTestStore[*appConfigV0](
+		t,
+		f.db,
+		config.WithOnUpdateDiff[*appConfigV0](func(old, new *appConfigV0) {
+			mu.Lock()
+			defer mu.Unlock()
+			diffs = append(diffs, [2]string{old.Name, new.Name})
+		}),
+	)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	for _, name := range []string{"n1", "n2"} {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: name},
+		})
+		require.NoError(t, err)
+	}
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the first previous configuration is the default one.
+		assert.Equal(t, [][2]string{{"bobby", "n1"}, {"n1", "n2"}}, diffs)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_ConfigImport(t *testing.T) {
+	t.Parallel()
+	at := time.Unix(time.Now().UTC().Unix(), 0).UTC()
+	imported := func(version uint64) *config.Versioned[*appConfigV0] {
+		return &config.Versioned[*appConfigV0]{
+			Version:   version,
+			UpdatedBy: "importer",
+			CreatedAt: at,
+			Config:    &appConfigV0{Name: "imported"},
+		}
+	}
+	tests := []struct {
+		mode        config.OnConflict
+		wantErr     error
+		wantSummary config.ImportSummary
+		wantV2Name  string
+		wantLen     int
+	}{
+		{
+			mode:        config.OnConflictFail,
+			wantErr:     config.ErrVersionExists,
+			wantSummary: config.ImportSummary{},
+			wantV2Name:  "n2",
+			wantLen:     3,
+		},
+		{
+			mode:        config.OnConflictSkip,
+			wantSummary: config.ImportSummary{Inserted: 2, Skipped: 2},
+			wantV2Name:  "n2",
+			wantLen:     5,
+		},
+		{
+			mode:        config.OnConflictReplace,
+			wantSummary: config.ImportSummary{Inserted: 2, Replaced: 2},
+			wantV2Name:  "imported",
+			wantLen:     5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("mode %d", tt.mode), func(t *testing.T) {
+			t.Parallel()
+			f := newFixture(t)
+			ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+			configStore := NewTestStore[*appConfigV0](t, f.db)
+			done, err := configStore.Start(ctx)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				cnl()
+				doneOrTimeout(t, done, 5*time.Second)
+			})
+			for _, name := range []string{"n1", "n2", "n3"} {
+				_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+					By:     "u1",
+					Config: &appConfigV0{Name: name},
+				})
+				require.NoError(t, err)
+			}
+
+			summary, err := configStore.Import(ctx, config.ImportCmd[*appConfigV0]{
+				Versions: []*config.Versioned[*appConfigV0]{
+					imported(2), imported(3), imported(4), imported(5),
+				},
+				OnConflict: tt.mode,
+			})
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.wantSummary, summary)
+
+			versions, err := configStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+				FromVersion: 0,
+				ToVersion:   10,
+			})
+			require.NoError(t, err)
+			require.Len(t, versions, tt.wantLen)
+			require.Equal(t, "n1", versions[0].Config.Name)
+			require.Equal(t, tt.wantV2Name, versions[1].Config.Name)
+		})
+	}
+}
+
+func Test_ConfigVerifyCacheFresh(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cnl)
+
+	staleStore := NewTestStore[*appConfigV0](t, f.db)
+	_, _, _, err := staleStore.VerifyCacheFresh(ctx)
+	require.ErrorIs(t, err, config.ErrNotStarted)
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	staleDone, err := staleStore.Start(watchCtx)
+	require.NoError(t, err)
+
+	stale, stored, cached, err := staleStore.VerifyCacheFresh(ctx)
+	require.NoError(t, err)
+	require.False(t, stale)
+	require.Zero(t, stored)
+	require.Zero(t, cached)
+
+	// stopping the watcher makes the cache miss subsequent updates.
+	stopWatching()
+	doneOrTimeout(t, staleDone, 5*time.Second)
+
+	writer := NewTestStore[*appConfigV0](t, f.db)
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, writerDone, 5*time.Second)
+	})
+	_, err = writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+
+	stale, stored, cached, err = staleStore.VerifyCacheFresh(ctx)
+	require.NoError(t, err)
+	require.True(t, stale)
+	require.Equal(t, uint64(1), stored)
+	require.Zero(t, cached)
+
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		stale, _, _, err := writer.VerifyCacheFresh(ctx)
+		assert.NoError(t, err)
+		assert.False(t, stale)
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func Test_ConfigEnumValidation(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*enumAppConfig](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	valid, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*enumAppConfig]{
+		By:     "u1",
+		Config: &enumAppConfig{LogLevel: slog.LevelError},
+	})
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelError, valid.Config.LogLevel)
+
+	invalid, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*enumAppConfig]{
+		By:     "u1",
+		Config: &enumAppConfig{LogLevel: slog.LevelError + 2},
+	})
+	require.ErrorIs(t, err, config.ErrInvalidEnumValue)
+	require.ErrorContains(t, err, "logLevel")
+	require.Nil(t, invalid)
+}
+
+func Test_ConfigWatchStartAtTime(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cnl)
+
+	writer := NewTestStore[*appConfigV0](t, f.db)
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	update := func(name string) *config.Versioned[*appConfigV0] {
+		v, err := writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: name},
+		})
+		require.NoError(t, err)
+		return v
+	}
+	update("n1")
+	cV2 := update("n2")
+	// the start time has a second precision.
+	time.Sleep(1100 * time.Millisecond)
+	startAt := time.Now()
+	time.Sleep(1100 * time.Millisecond)
+	cV3 := update("n3")
+	cV4 := update("n4")
+
+	var mu sync.Mutex
+	var replayed []string
+	var started *appConfigV0
+	replayer := NewTestStore[*appConfigV0](
+		t,
+		f.db,
+		config.WithWatchStartAtTime[*appConfigV0](startAt),
+		config.WithOnStart[*appConfigV0](func(conf *appConfigV0) {
+			started = conf
+		}),
+		config.WithOnUpdate[*appConfigV0](func(conf *appConfigV0) {
+			mu.Lock()
+			defer mu.Unlock()
+			replayed = append(replayed, conf.Name)
+		}),
+	)
+	replayerDone, err := replayer.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, writerDone, 5*time.Second)
+		doneOrTimeout(t, replayerDone, 5*time.Second)
+	})
+
+	require.Contains(t, []string{cV2.Config.Name, cV3.Config.Name, cV4.Config.Name}, started.Name)
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"n3", "n4"}, replayed)
+		got, err := replayer.GetLatestVersion()
+		assert.NoError(t, err)
+		assert.Equal(t, cV4, got)
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func Test_ConfigCollectionStats(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	for _, name := range []string{"n1", "n2", "n3"} {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: name},
+		})
+		require.NoError(t, err)
+	}
+
+	stats, err := configStore.CollectionStats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), stats.Count)
+	require.Positive(t, stats.Size)
+	require.Positive(t, stats.AvgObjSize)
+	require.Positive(t, stats.TotalIndexSize)
+	require.Contains(t, stats.IndexSizes, "_id_")
+	require.Contains(t, stats.IndexSizes, "idx_created_at_inc")
+}
+
+func Test_ConfigRequireExplicitInit(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db, config.WithRequireExplicitInit[*appConfigV0]())
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	cfg, err := configStore.GetConfig()
+	require.ErrorIs(t, err, config.ErrNotInitialized)
+	require.Nil(t, cfg)
+	v, err := configStore.GetLatestVersion()
+	require.ErrorIs(t, err, config.ErrNotInitialized)
+	require.Nil(t, v)
+
+	cV1, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		cfg, err := configStore.GetConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, cV1.Config, cfg)
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func Test_ConfigPruneBefore(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	at := time.Unix(time.Now().UTC().Unix(), 0).UTC()
+	now := at
+	nowProvider := func() time.Time {
+		return now
+	}
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db, config.WithNowFn[*appConfigV0](nowProvider))
+	_, err := configStore.PruneBefore(ctx, at)
+	require.ErrorIs(t, err, config.ErrNotStarted)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	deleted, err := configStore.PruneBefore(ctx, at)
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	for i, name := range []string{"n1", "n2", "n3", "n4"} {
+		now = at.Add(time.Duration(i) * time.Hour)
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: name},
+		})
+		require.NoError(t, err)
+	}
+	listNames := func() []string {
+		versions, err := configStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+			FromVersion: 0,
+			ToVersion:   10,
+		})
+		require.NoError(t, err)
+		var names []string
+		for _, v := range versions {
+			names = append(names, v.Config.Name)
+		}
+		return names
+	}
+
+	deleted, err = configStore.PruneBefore(ctx, at.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), deleted)
+	require.Equal(t, []string{"n3", "n4"}, listNames())
+
+	t.Run("latest version is never deleted", func(t *testing.T) {
+		deleted, err := configStore.PruneBefore(ctx, at.Add(24*time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, int64(1), deleted)
+		require.Equal(t, []string{"n4"}, listNames())
+	})
+}
+
+func Test_ConfigUpdateConfigWithPrev(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	cV1, prev, err := configStore.UpdateConfigWithPrev(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1", List: []string{"a"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), cV1.Version)
+	require.Nil(t, prev)
+
+	cV2, prev, err := configStore.UpdateConfigWithPrev(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{Name: "n2", List: []string{"b"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), cV2.Version)
+	require.Equal(t, cV1, prev)
+}
+
+func Test_ConfigUpdateIsolation(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	for _, want := range [][]string{{"a", "b"}, {"c", "d"}} {
+		cmdCfg := &appConfigV0{Name: "n", List: append([]string(nil), want...)}
+		updated, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: cmdCfg,
+		})
+		require.NoError(t, err)
+		require.EventuallyWithT(t, func(t *assert.CollectT) {
+			got, err := configStore.GetLatestVersion()
+			assert.NoError(t, err)
+			assert.Equal(t, updated, got)
+		}, 5*time.Second, 100*time.Millisecond)
+
+		updated.Config.List[0] = "mutated"
+		cmdCfg.List[1] = "mutated"
+		cfg, err := configStore.GetConfig()
+		require.NoError(t, err)
+		require.Equal(t, want, cfg.List)
+	}
+}
+
+func Test_ConfigWaitReady(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cnl)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+
+	notStartedCtx, notStartedCnl := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer notStartedCnl()
+	require.ErrorIs(t, configStore.WaitReady(notStartedCtx), context.DeadlineExceeded)
+
+	ready := make(chan error, 1)
+	go func() {
+		ready <- configStore.WaitReady(ctx)
+	}()
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	select {
+	case err := <-ready:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for readiness")
+	}
+	_, err = configStore.GetConfig()
+	require.NoError(t, err)
+	require.NoError(t, configStore.WaitReady(ctx))
+}
+
+func Test_ConfigMetadata(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	at := time.Unix(time.Now().UTC().Unix(), 0).UTC()
+	nowProvider := func() time.Time {
+		return at
+	}
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	euStore := NewTestStore[*appConfigV0](
+		t,
+		f.db,
+		config.WithNowFn[*appConfigV0](nowProvider),
+		config.WithMetadata[*appConfigV0](map[string]string{"region": "eu"}),
+	)
+	euDone, err := euStore.Start(ctx)
+	require.NoError(t, err)
+	usStore := NewTestStore[*appConfigV0](
+		t,
+		f.db,
+		config.WithNowFn[*appConfigV0](nowProvider),
+		config.WithMetadata[*appConfigV0](map[string]string{"region": "us"}),
+	)
+	usDone, err := usStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, euDone, 5*time.Second)
+		doneOrTimeout(t, usDone, 5*time.Second)
+	})
+
+	cV1, err := euStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"region": "eu"}, cV1.Metadata)
+	_, err = usStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{Name: "n2"},
+	})
+	require.NoError(t, err)
+
+	byVersion, err := usStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+		FromVersion: 0,
+		ToVersion:   10,
+		Metadata:    map[string]string{"region": "eu"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []*config.Versioned[*appConfigV0]{cV1}, byVersion)
+
+	byDate, err := usStore.ListVersionedConfigsByDate(ctx, config.ListConfigDatesQuery{
+		From:     at,
+		To:       at.Add(time.Second),
+		Metadata: map[string]string{"region": "eu"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []*config.Versioned[*appConfigV0]{cV1}, byDate)
+
+	all, err := usStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+		FromVersion: 0,
+		ToVersion:   10,
+	})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+}
+
+func Test_ConfigStopSettlesInFlightWrites(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cnl)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	require.ErrorIs(t, configStore.Stop(ctx), config.ErrNotStarted)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+
+	updated := make(chan error, 1)
+	go func() {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: "n1"},
+		})
+		updated <- err
+	}()
+	require.NoError(t, configStore.Stop(ctx))
+	require.NoError(t, configStore.Stop(ctx))
+	doneOrTimeout(t, done, 5*time.Second)
+
+	// once stopped, the outcome of the update is settled: either the version
+	// was created or the update failed without creating it.
+	var updateErr error
+	select {
+	case updateErr = <-updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the update")
+	}
+	count, err := f.db.Collection("config").CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	if updateErr == nil {
+		require.Equal(t, int64(1), count)
+	} else {
+		require.Zero(t, count)
+	}
+
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n2"},
+	})
+	require.ErrorIs(t, err, config.ErrStopped)
+}
+
+func Test_ConfigGetVersion(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	_, err := configStore.GetVersion(ctx, 1)
+	require.ErrorIs(t, err, config.ErrNotStarted)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	cV1, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Duration: time.Second},
+	})
+	require.NoError(t, err)
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{Name: "n2"},
+	})
+	require.NoError(t, err)
+
+	got, err := configStore.GetVersion(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, cV1, got)
+	require.Equal(t, "bobby", got.Config.Name)
+
+	_, err = configStore.GetVersion(ctx, 3)
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+}
+
+func Test_ConfigRollback(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	for _, name := range []string{"n1", "n2"} {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: name, List: []string{name}},
+		})
+		require.NoError(t, err)
+	}
+
+	rolledBack, err := configStore.Rollback(ctx, config.RollbackCmd[*appConfigV0]{
+		By:        "u2",
+		ToVersion: 1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), rolledBack.Version)
+	require.Equal(t, "u2", rolledBack.UpdatedBy)
+	require.Equal(t, &appConfigV0{Name: "n1", List: []string{"n1"}}, rolledBack.Config)
+
+	// history is kept.
+	v2, err := configStore.GetVersion(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, "n2", v2.Config.Name)
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		latest, err := configStore.GetLatestVersion()
+		require.NoError(c, err)
+		assert.Equal(c, rolledBack, latest)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = configStore.Rollback(ctx, config.RollbackCmd[*appConfigV0]{
+		By:        "u2",
+		ToVersion: 10,
+	})
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+}
+
+func Test_ConfigResumeTokenStore(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cnl)
+	// the start time would replay every version if the token was not used.
+	startAt := time.Now().Add(-time.Minute)
+	tokens := config.NewMongoResumeTokenStore(f.db.Collection("resume_tokens"), "listener")
+
+	writer := NewTestStore[*appConfigV0](t, f.db)
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	update := func(name string) {
+		_, err := writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: name},
+		})
+		require.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	var updates, starts []string
+	newListener := func() *config.WatchedRepo[*appConfigV0] {
+		return NewTestStore[*appConfigV0](
+			t,
+			f.db,
+			config.WithWatchStartAtTime[*appConfigV0](startAt),
+			config.WithResumeTokenStore[*appConfigV0](tokens),
+			config.WithOnStart[*appConfigV0](func(conf *appConfigV0) {
+				mu.Lock()
+				defer mu.Unlock()
+				starts = append(starts, conf.Name)
+			}),
+			config.WithOnUpdate[*appConfigV0](func(conf *appConfigV0) {
+				mu.Lock()
+				defer mu.Unlock()
+				updates = append(updates, conf.Name)
+			}),
+		)
+	}
+
+	listenerCtx, stopListener := context.WithCancel(ctx)
+	listenerDone, err := newListener().Start(listenerCtx)
+	require.NoError(t, err)
+	update("n1")
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"n1"}, updates)
+	}, 5*time.Second, 100*time.Millisecond)
+	stopListener()
+	doneOrTimeout(t, listenerDone, 5*time.Second)
+	token, err := tokens.LoadResumeToken(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, token)
+
+	// the version inserted during the downtime is loaded at start, the
+	// versions before the token are not replayed.
+	update("n2")
+	listenerCtx, stopListener = context.WithCancel(ctx)
+	listener := newListener()
+	listenerDone, err = listener.Start(listenerCtx)
+	require.NoError(t, err)
+	got, err := listener.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, "n2", got.Name)
+	update("n3")
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"n1", "n3"}, updates)
+	}, 5*time.Second, 100*time.Millisecond)
+	stopListener()
+	doneOrTimeout(t, listenerDone, 5*time.Second)
+
+	// a restart without writes after the token serves the latest version,
+	// not the one before the start time.
+	listener = newListener()
+	listenerDone, err = listener.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, writerDone, 5*time.Second)
+		doneOrTimeout(t, listenerDone, 5*time.Second)
+	})
+	got, err = listener.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, "n3", got.Name)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"bobby", "n2", "n3"}, starts)
+	require.Equal(t, []string{"n1", "n3"}, updates)
+}
+
+func Test_ConfigReconnect(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	listener := NewTestStore[*appConfigV0](t, f.db)
+	listenerDone, err := listener.Start(ctx)
+	require.NoError(t, err)
+	writer := NewTestStore[*appConfigV0](t, f.db)
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, listenerDone, 5*time.Second)
+		doneOrTimeout(t, writerDone, 5*time.Second)
+	})
+
+	// dropping the collection invalidates the change streams.
+	require.NoError(t, f.db.Collection("config").Drop(ctx))
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		assert.NotZero(t, listener.Reconnects())
+		assert.NotZero(t, writer.Reconnects())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	updated, err := writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		got, err := listener.GetLatestVersion()
+		assert.NoError(t, err)
+		assert.Equal(t, updated, got)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_ConfigOnError(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	errs := make(chan error, 10)
+	configStore := NewTestStore[*appConfigV0](t, f.db, config.WithOnError[*appConfigV0](func(err error) {
+		errs <- err
+	}))
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	_, err = f.db.Collection("config").InsertOne(ctx, bson.M{"_id": 5, "app_config": "not a config"})
+	require.NoError(t, err)
+
+	select {
+	case err := <-errs:
+		var watchErr *config.WatchError
+		require.ErrorAs(t, err, &watchErr)
+		require.Equal(t, "insert", watchErr.OperationType)
+		require.Equal(t, uint64(5), watchErr.Version)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the error")
+	}
+}
+
+func Test_ConfigExpectedVersion(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	update := func(name string, expected uint64) (*config.Versioned[*appConfigV0], error) {
+		return configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:              "u1",
+			Config:          &appConfigV0{Name: name},
+			ExpectedVersion: &expected,
+		})
+	}
+
+	_, err = update("n1", 1)
+	require.ErrorIs(t, err, config.ErrVersionMismatch)
+	cV1, err := update("n1", 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), cV1.Version)
+
+	// both clients edit the version 1: the second one is rejected.
+	cV2, err := update("n2", 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), cV2.Version)
+	_, err = update("n2-bis", 1)
+	require.ErrorIs(t, err, config.ErrVersionMismatch)
+
+	// without expectation, the latest version is updated.
+	cV3, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n3"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), cV3.Version)
+}
+
+func Test_ConfigListVersionedConfigsPage(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	for i := 1; i <= 5; i++ {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: fmt.Sprintf("n%d", i)},
+		})
+		require.NoError(t, err)
+	}
+
+	var got []uint64
+	query := config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 10, Limit: 2}
+	for pages := 1; ; pages++ {
+		page, err := configStore.ListVersionedConfigsPage(ctx, query)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Versions), 2)
+		for _, v := range page.Versions {
+			got = append(got, v.Version)
+		}
+		if !page.HasMore {
+			require.Equal(t, 3, pages)
+			break
+		}
+		query.Skip += query.Limit
+	}
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, got)
+
+	// without limit, everything is retrieved.
+	page, err := configStore.ListVersionedConfigsPage(ctx, config.ListVersionedConfigsQuery{
+		FromVersion: 0,
+		ToVersion:   10,
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Versions, 5)
+	require.False(t, page.HasMore)
+}
+
+func Test_ConfigCountVersions(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	_, err := configStore.CountVersions(ctx)
+	require.ErrorIs(t, err, config.ErrNotStarted)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	count, err := configStore.CountVersions(ctx)
+	require.NoError(t, err)
+	require.Zero(t, count)
+	for _, by := range []string{"u1", "u2", "u1"} {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     by,
+			Config: &appConfigV0{Name: by},
+		})
+		require.NoError(t, err)
+	}
+
+	count, err = configStore.CountVersions(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+	count, err = configStore.CountVersionsByUser(ctx, "u1")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+	count, err = configStore.CountVersionsByUser(ctx, "u3")
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func Test_ConfigPruneVersions(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	bounded := NewTestStore[*appConfigV0](t, f.db, config.WithMaxVersions[*appConfigV0](3))
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	boundedDone, err := bounded.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+		doneOrTimeout(t, boundedDone, 5*time.Second)
+	})
+	update := func(store *config.WatchedRepo[*appConfigV0], name string) *config.Versioned[*appConfigV0] {
+		v, err := store.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: name},
+		})
+		require.NoError(t, err)
+		return v
+	}
+	versions := func() []uint64 {
+		all, err := configStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+			FromVersion: 0,
+			ToVersion:   100,
+		})
+		require.NoError(t, err)
+		var ids []uint64
+		for _, v := range all {
+			ids = append(ids, v.Version)
+		}
+		return ids
+	}
+	caughtUp := func(store *config.WatchedRepo[*appConfigV0], version uint64) {
+		require.EventuallyWithT(t, func(t *assert.CollectT) {
+			got, err := store.GetLatestVersion()
+			assert.NoError(t, err)
+			assert.Equal(t, version, got.Version)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	var latest *config.Versioned[*appConfigV0]
+	for i := 1; i <= 5; i++ {
+		latest = update(configStore, fmt.Sprintf("n%d", i))
+	}
+	caughtUp(configStore, latest.Version)
+	deleted, err := configStore.PruneVersions(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), deleted)
+	require.Equal(t, []uint64{4, 5}, versions())
+
+	// the latest version is kept whatever the input.
+	deleted, err = configStore.PruneVersions(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+	require.Equal(t, []uint64{5}, versions())
+
+	// updates prune automatically, keeping the version cached by the writer.
+	for i := 6; i <= 8; i++ {
+		latest = update(bounded, fmt.Sprintf("n%d", i))
+	}
+	caughtUp(bounded, latest.Version)
+	update(bounded, "n9")
+	require.Equal(t, []uint64{7, 8, 9}, versions())
+}
+
+func Test_ConfigVersionTTL(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cnl)
+
+	_, err := config.NewWatchedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default(), DB: f.db},
+		config.WithVersionTTL[*appConfigV0](time.Minute),
+	)
+	require.ErrorIs(t, err, config.ErrVersionTTLTooShort)
+
+	// expiry returns the expiry of the TTL index, -1 without it.
+	expiry := func() int32 {
+		cursor, err := f.db.Collection("config").Indexes().List(ctx)
+		require.NoError(t, err)
+		var indexes []bson.M
+		require.NoError(t, cursor.All(ctx, &indexes))
+		for _, idx := range indexes {
+			if idx["name"] == "idx_ttl_created_at" {
+				return idx["expireAfterSeconds"].(int32)
+			}
+			if idx["name"] == "idx_created_at_inc" {
+				require.NotContains(t, idx, "expireAfterSeconds")
+			}
+		}
+		return -1
+	}
+	for i, ttl := range []time.Duration{2 * time.Hour, 3 * time.Hour, 0} {
+		storeCtx, stop := context.WithCancel(ctx)
+		configStore := NewTestStore[*appConfigV0](t, f.db, config.WithVersionTTL[*appConfigV0](ttl))
+		done, err := configStore.Start(storeCtx)
+		require.NoError(t, err)
+		if ttl > 0 {
+			require.Equal(t, int32(ttl.Seconds()), expiry())
+		} else {
+			require.Equal(t, int32(-1), expiry())
+		}
+		_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: fmt.Sprint(i)},
+		})
+		require.NoError(t, err)
+		stop()
+		doneOrTimeout(t, done, 5*time.Second)
+	}
+
+	// only the versions superseded with the TTL set expire.
+	var docs []bson.M
+	cursor, err := f.db.Collection("config").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	require.NoError(t, err)
+	require.NoError(t, cursor.All(ctx, &docs))
+	require.Len(t, docs, 3)
+	require.Contains(t, docs[0], "ttl_created_at")
+	require.Equal(t, docs[0]["created_at"], docs[0]["ttl_created_at"])
+	// the second version was superseded without the TTL set.
+	require.NotContains(t, docs[1], "ttl_created_at")
+	require.NotContains(t, docs[2], "ttl_created_at")
+}
+
+func Test_ConfigValidateConfig(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	events := make(chan *appConfigV0, 1)
+	configStore := NewTestStore[*appConfigV0](t, f.db,
+		config.WithOnUpdate[*appConfigV0](func(conf *appConfigV0) {
+			events <- conf
+		}))
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	require.NoError(t, configStore.ValidateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	}))
+	err = configStore.ValidateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Duration: -time.Second},
+	})
+	require.EqualError(t, err, "duration must be greater than zero")
+	expected := uint64(1)
+	err = configStore.ValidateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:              "u1",
+		Config:          &appConfigV0{Name: "n1"},
+		ExpectedVersion: &expected,
+	})
+	require.ErrorIs(t, err, config.ErrVersionMismatch)
+
+	// nothing was persisted nor observed.
+	count, err := configStore.CountVersions(ctx)
+	require.NoError(t, err)
+	require.Zero(t, count)
+	select {
+	case conf := <-events:
+		t.Fatalf("unexpected update: %+v", conf)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func Test_ConfigPatchConfig(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	// the first patch applies onto an empty configuration.
+	cV1, err := configStore.PatchConfig(ctx, config.PatchCmd{
+		By:         "u1",
+		MergePatch: []byte(`{"name":"n1","list":["a"],"nested":{"counter":1}}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, &appConfigV0{Name: "n1", List: []string{"a"}, Nested: nestedConfig{Counter: 1}}, cV1.Config)
+	cV2, err := configStore.PatchConfig(ctx, config.PatchCmd{
+		By:         "u2",
+		MergePatch: []byte(`{"name":null,"duration":5}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), cV2.Version)
+	require.Equal(t, "u2", cV2.UpdatedBy)
+	require.Equal(t, &appConfigV0{Name: "bobby", Duration: 5, List: []string{"a"}, Nested: nestedConfig{Counter: 1}}, cV2.Config)
+
+	_, err = configStore.PatchConfig(ctx, config.PatchCmd{By: "u3", MergePatch: []byte(`{`)})
+	require.ErrorIs(t, err, config.ErrInvalidPatch)
+}
+
+func Test_ConfigJSONPatchConfig(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1", List: []string{"a", "b"}},
+	})
+	require.NoError(t, err)
+
+	cV2, err := configStore.JSONPatchConfig(ctx, "u2", []byte(`[
+		{"op": "test", "path": "/name", "value": "n1"},
+		{"op": "remove", "path": "/list/0"},
+		{"op": "move", "from": "/name", "path": "/list/-"}
+	]`))
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), cV2.Version)
+	require.Equal(t, &appConfigV0{Name: "bobby", List: []string{"b", "n1"}}, cV2.Config)
+
+	// the precondition does not hold anymore.
+	_, err = configStore.JSONPatchConfig(ctx, "u3", []byte(`[
+		{"op": "test", "path": "/name", "value": "n1"},
+		{"op": "replace", "path": "/name", "value": "n3"}
+	]`))
+	require.ErrorIs(t, err, config.ErrPatchOperationFailed)
+	latest, err := configStore.GetLatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), latest.Version)
+}
+
+func Test_ConfigDiff(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	for _, cfg := range []*appConfigV0{
+		{Name: "n1", List: []string{"a"}},
+		{Name: "n2", List: []string{"a", "b"}},
+	} {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: cfg})
+		require.NoError(t, err)
+	}
+
+	changes, err := configStore.Diff(ctx, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []config.FieldChange{
+		{Path: "/list/1", Kind: config.FieldAdded, New: "b"},
+		{Path: "/name", Kind: config.FieldModified, Old: "n1", New: "n2"},
+	}, changes)
+	_, err = configStore.Diff(ctx, 1, 3)
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+}
+
+func Test_ConfigEncryption(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	// a version stored before enabling the encryption.
+	plainStore := NewTestStore[*appConfigV0](t, f.db)
+	plainDone, err := plainStore.Start(ctx)
+	require.NoError(t, err)
+	_, err = plainStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "plain"},
+	})
+	require.NoError(t, err)
+
+	cipher, err := config.NewAESGCMCipher([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	writer := NewTestStore[*appConfigV0](t, f.db, config.WithEncryption[*appConfigV0](cipher))
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	listener := NewTestStore[*appConfigV0](t, f.db, config.WithEncryption[*appConfigV0](cipher))
+	listenerDone, err := listener.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, plainDone, 5*time.Second)
+		doneOrTimeout(t, writerDone, 5*time.Second)
+		doneOrTimeout(t, listenerDone, 5*time.Second)
+	})
+
+	_, err = writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{Name: "secret"},
+	})
+	require.NoError(t, err)
+
+	var raw bson.M
+	require.NoError(t, f.db.Collection("config").FindOne(ctx, bson.M{"_id": 2}).Decode(&raw))
+	require.Equal(t, "u2", raw["updated_by"])
+	require.IsType(t, primitive.Binary{}, raw["app_config"])
+	require.NotContains(t, string(raw["app_config"].(primitive.Binary).Data), "secret")
+
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		cfg, err := listener.GetConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", cfg.Name)
+	}, 5*time.Second, 10*time.Millisecond)
+	versions, err := listener.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 3})
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, "plain", versions[0].Config.Name)
+	require.Equal(t, "secret", versions[1].Config.Name)
+}
+
+func Test_ConfigFieldEncryption(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	cipher, err := config.NewAESGCMCipher([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	writer := NewTestStore[*secretAppConfig](t, f.db, config.WithFieldEncryption[*secretAppConfig](cipher))
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	listener := NewTestStore[*secretAppConfig](t, f.db, config.WithFieldEncryption[*secretAppConfig](cipher))
+	listenerDone, err := listener.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, writerDone, 5*time.Second)
+		doneOrTimeout(t, listenerDone, 5*time.Second)
+	})
+
+	want := &secretAppConfig{
+		Name:     "app",
+		Password: "p4ss",
+		Database: secretDBConfig{Host: "db", Token: "t0k3n"},
+	}
+	_, err = writer.UpdateConfig(ctx, config.UpdateConfigCmd[*secretAppConfig]{By: "u1", Config: want})
+	require.NoError(t, err)
+
+	var raw struct {
+		AppConfig bson.M `bson:"app_config"`
+	}
+	require.NoError(t, f.db.Collection("config").FindOne(ctx, bson.M{"_id": 1}).Decode(&raw))
+	require.Equal(t, "app", raw.AppConfig["name"])
+	require.NotEqual(t, "p4ss", raw.AppConfig["password"])
+	database := raw.AppConfig["database"].(bson.M)
+	require.Equal(t, "db", database["host"])
+	require.NotEqual(t, "t0k3n", database["token"])
+
+	// the listener gets the version through the change stream.
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		cfg, err := listener.GetConfig()
+		assert.NoError(t, err)
+		assert.Equal(t, want, cfg)
+	}, 5*time.Second, 10*time.Millisecond)
+	versions, err := listener.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 2})
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.Equal(t, want, versions[0].Config)
+
+	// a new repository gets the latest version on start.
+	late := NewTestStore[*secretAppConfig](t, f.db, config.WithFieldEncryption[*secretAppConfig](cipher))
+	lateCtx, lateCnl := context.WithCancel(ctx)
+	lateDone, err := late.Start(lateCtx)
+	require.NoError(t, err)
+	cfg, err := late.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, want, cfg)
+	lateCnl()
+	doneOrTimeout(t, lateDone, 5*time.Second)
+}
+
+func Test_ConfigWriteConcernAndReadPreference(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db,
+		config.WithWriteConcern[*appConfigV0](writeconcern.W1()),
+		config.WithReadPreference[*appConfigV0](readpref.PrimaryPreferred()),
+	)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	})
+	require.NoError(t, err)
+	versions, err := configStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 2})
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.Equal(t, "n1", versions[0].Config.Name)
+}
+
+func Test_ConfigStartHonorsContextCancellation(t *testing.T) {
+	t.Parallel()
+	// an unreachable deployment blocks the index creation on server selection.
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://localhost:1").
+		SetServerSelectionTimeout(time.Minute))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+	configStore := NewTestStore[*appConfigV0](t, client.Database("unreachable"))
+
+	ctx, cnl := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cnl()
+	started := time.Now()
+	_, err = configStore.Start(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(started), 5*time.Second)
+}
+
+func Test_NamespacedRepo(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	newRepo := func() *config.NamespacedRepo[*appConfigV0] {
+		repo, err := config.NewNamespacedRepo[*appConfigV0](config.Args{Logger: slog.Default(), DB: f.db})
+		require.NoError(t, err)
+		return repo
+	}
+	writer := newRepo()
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	listener := newRepo()
+	listenerDone, err := listener.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, writerDone, 5*time.Second)
+		doneOrTimeout(t, listenerDone, 5*time.Second)
+	})
+
+	cfg, err := listener.GetConfig("tenant-a")
+	require.NoError(t, err)
+	require.Equal(t, "bobby", cfg.Name)
+
+	for _, update := range []struct{ key, name string }{
+		{"tenant-a", "a1"},
+		{"tenant-b", "b1"},
+		{"tenant-a", "a2"},
+	} {
+		_, err := writer.UpdateConfig(ctx, update.key, config.UpdateConfigCmd[*appConfigV0]{
+			By:     "u1",
+			Config: &appConfigV0{Name: update.name},
+		})
+		require.NoError(t, err)
+	}
+
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		a, err := listener.GetLatestVersion("tenant-a")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), a.Version)
+		assert.Equal(t, "a2", a.Config.Name)
+		b, err := listener.GetLatestVersion("tenant-b")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), b.Version)
+		assert.Equal(t, "b1", b.Config.Name)
+	}, 5*time.Second, 10*time.Millisecond)
+	keys, err := listener.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"tenant-a", "tenant-b"}, keys)
+
+	versions, err := listener.ListVersionedConfigs(ctx, "tenant-a", config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 10})
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, "a1", versions[0].Config.Name)
+	require.Equal(t, "a2", versions[1].Config.Name)
+
+	// a new repository loads the latest version of every key on start.
+	late := newRepo()
+	lateCtx, lateCnl := context.WithCancel(ctx)
+	lateDone, err := late.Start(lateCtx)
+	require.NoError(t, err)
+	cfg, err = late.GetConfig("tenant-b")
+	require.NoError(t, err)
+	require.Equal(t, "b1", cfg.Name)
+	lateCnl()
+	doneOrTimeout(t, lateDone, 5*time.Second)
+
+	expected := uint64(5)
+	_, err = writer.UpdateConfig(ctx, "tenant-b", config.UpdateConfigCmd[*appConfigV0]{
+		By:              "u1",
+		Config:          &appConfigV0{Name: "b2"},
+		ExpectedVersion: &expected,
+	})
+	require.ErrorIs(t, err, config.ErrVersionMismatch)
+
+	// the update options apply to the keys.
+	var hooked []string
+	hooks, err := config.NewNamespacedRepo[*appConfigV0](
+		config.Args{Logger: slog.Default(), DB: f.db},
+		config.WithActorFromContext[*appConfigV0](func(context.Context) string { return "ctx-user" }),
+		config.WithPreUpdateHook[*appConfigV0](func(_ context.Context, _, candidate *appConfigV0) error {
+			if candidate.Name == "forbidden" {
+				return errors.New("forbidden")
+			}
+			return nil
+		}),
+		config.WithPostUpdateHook[*appConfigV0](func(_ context.Context, v *config.Versioned[*appConfigV0]) {
+			hooked = append(hooked, v.Config.Name)
+		}),
+	)
+	require.NoError(t, err)
+	hooksCtx, hooksCnl := context.WithCancel(ctx)
+	hooksDone, err := hooks.Start(hooksCtx)
+	require.NoError(t, err)
+	v, err := hooks.UpdateConfig(ctx, "tenant-c", config.UpdateConfigCmd[*appConfigV0]{Config: &appConfigV0{Name: "c1"}})
+	require.NoError(t, err)
+	require.Equal(t, "ctx-user", v.UpdatedBy)
+	_, err = hooks.UpdateConfig(ctx, "tenant-c", config.UpdateConfigCmd[*appConfigV0]{Config: &appConfigV0{Name: "forbidden"}})
+	require.EqualError(t, err, "forbidden")
+	require.Equal(t, []string{"c1"}, hooked)
+	hooksCnl()
+	doneOrTimeout(t, hooksDone, 5*time.Second)
+}
+
+func Test_ConfigEnvironment(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	prod := NewTestStore[*appConfigV0](t, f.db, config.WithEnvironment[*appConfigV0]("prod"))
+	prodDone, err := prod.Start(ctx)
+	require.NoError(t, err)
+	staging := NewTestStore[*appConfigV0](t, f.db, config.WithEnvironment[*appConfigV0]("staging"))
+	stagingDone, err := staging.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, prodDone, 5*time.Second)
+		doneOrTimeout(t, stagingDone, 5*time.Second)
+	})
+
+	_, err = staging.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "s1"}})
+	require.NoError(t, err)
+	_, err = staging.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "s2"}})
+	require.NoError(t, err)
+	// the versions are numbered independently per environment.
+	v, err := prod.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "p1"}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), v.Version)
+
+	require.EventuallyWithT(t, func(t *assert.CollectT) {
+		cfg, err := staging.GetLatestVersion()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), cfg.Version)
+		assert.Equal(t, "s2", cfg.Config.Name)
+	}, 5*time.Second, 10*time.Millisecond)
+	// the prod watcher ignores the staging versions.
+	cfg, err := prod.GetLatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), cfg.Version)
+	require.Equal(t, "p1", cfg.Config.Name)
+
+	versions, err := prod.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 10})
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	count, err := f.db.Collection("config").CountDocuments(ctx, bson.M{"environment": "staging"})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
+
+func Test_ConfigUpdateReason(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db,
+		config.WithMetadata[*appConfigV0](map[string]string{"app": "a1"}))
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	created, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:       "u1",
+		Config:   &appConfigV0{Name: "n1"},
+		Reason:   "initial setup",
+		Metadata: map[string]string{"ticket": "OPS-1", "app": "overridden"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "initial setup", created.Reason)
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n2"},
+	})
+	require.NoError(t, err)
+
+	versions, err := configStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 3})
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, "initial setup", versions[0].Reason)
+	require.Equal(t, map[string]string{"ticket": "OPS-1", "app": "a1"}, versions[0].Metadata)
+	require.Empty(t, versions[1].Reason)
+	require.Equal(t, map[string]string{"app": "a1"}, versions[1].Metadata)
+}
+
+func Test_ConfigTags(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	for _, cmd := range []config.UpdateConfigCmd[*appConfigV0]{
+		{By: "u1", Config: &appConfigV0{Name: "n1"}, Tags: []string{"release", "known-good"}},
+		{By: "u1", Config: &appConfigV0{Name: "n2"}},
+		{By: "u1", Config: &appConfigV0{Name: "n3"}, Tags: []string{"release"}},
+		{By: "u1", Config: &appConfigV0{Name: "n4"}},
+	} {
+		_, err := configStore.UpdateConfig(ctx, cmd)
+		require.NoError(t, err)
+	}
+
+	released, err := configStore.ListByTag(ctx, "release")
+	require.NoError(t, err)
+	require.Len(t, released, 2)
+	require.Equal(t, uint64(1), released[0].Version)
+	require.Equal(t, []string{"release", "known-good"}, released[0].Tags)
+	require.Equal(t, uint64(3), released[1].Version)
+	none, err := configStore.ListByTag(ctx, "hotfix")
+	require.NoError(t, err)
+	require.Empty(t, none)
+
+	rolledBack, err := configStore.RollbackToTag(ctx, "u2", "known-good")
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), rolledBack.Version)
+	require.Equal(t, "n1", rolledBack.Config.Name)
+	_, err = configStore.RollbackToTag(ctx, "u2", "hotfix")
+	require.ErrorIs(t, err, config.ErrConfigurationNotFound)
+}
+
+func Test_ConfigListByAuthor(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	for _, by := range []string{"alice", "bob", "alice", "bob"} {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: by, Config: &appConfigV0{Name: by}})
+		require.NoError(t, err)
+	}
+
+	versions, err := configStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+		FromVersion: 2,
+		ToVersion:   10,
+		UpdatedBy:   "alice",
+	})
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	require.Equal(t, uint64(3), versions[0].Version)
+	require.Equal(t, "alice", versions[0].UpdatedBy)
+}
+
+func Test_ConfigScheduledUpdate(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db, config.WithScheduledUpdates[*appConfigV0](100*time.Millisecond))
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}})
+	require.NoError(t, err)
+
+	applyAt := time.Now().Add(2 * time.Second)
+	scheduled, err := configStore.ScheduleUpdate(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{Name: "n2"},
+		Reason: "maintenance window",
+	}, applyAt)
+	require.NoError(t, err)
+	require.NotEmpty(t, scheduled.ID)
+	cancelled, err := configStore.ScheduleUpdate(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u2",
+		Config: &appConfigV0{Name: "n3"},
+	}, applyAt)
+	require.NoError(t, err)
+	require.NotEqual(t, scheduled.ID, cancelled.ID)
+	require.NoError(t, configStore.CancelScheduled(ctx, cancelled.ID))
+	require.ErrorIs(t, configStore.CancelScheduled(ctx, cancelled.ID), config.ErrScheduledUpdateNotFound)
+
+	pending, err := configStore.ListScheduled(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, "n2", pending[0].Cmd.Config.Name)
+	cfg, err := configStore.GetConfig()
+	require.NoError(t, err)
+	require.Equal(t, "n1", cfg.Name)
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		latest, err := configStore.GetLatestVersion()
+		require.NoError(c, err)
+		require.Equal(c, uint64(2), latest.Version)
+		require.Equal(c, "n2", latest.Config.Name)
+		require.Equal(c, "maintenance window", latest.Reason)
+		require.False(c, latest.CreatedAt.Before(applyAt.Truncate(time.Millisecond)))
+	}, 10*time.Second, 100*time.Millisecond)
+	pending, err = configStore.ListScheduled(ctx)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func Test_ConfigScheduledUpdateClaim(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	// the scheduler does not look for the due updates during the test.
+	scheduler := NewTestStore[*appConfigV0](t, f.db, config.WithScheduledUpdates[*appConfigV0](time.Hour))
+	schedulerDone, err := scheduler.Start(ctx)
+	require.NoError(t, err)
+	scheduled, err := scheduler.ScheduleUpdate(ctx, config.UpdateConfigCmd[*appConfigV0]{
+		By:     "u1",
+		Config: &appConfigV0{Name: "n1"},
+	}, time.Now())
+	require.NoError(t, err)
+	// another repository holds the update.
+	id, err := primitive.ObjectIDFromHex(scheduled.ID)
+	require.NoError(t, err)
+	scheduledColl := f.db.Collection("config_scheduled")
+	_, err = scheduledColl.UpdateByID(ctx, id, bson.M{"$set": bson.M{"claimed_until": time.Now().Add(time.Hour)}})
+	require.NoError(t, err)
+
+	configStore := NewTestStore[*appConfigV0](t, f.db, config.WithScheduledUpdates[*appConfigV0](100*time.Millisecond))
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, schedulerDone, 5*time.Second)
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	time.Sleep(500 * time.Millisecond)
+	latest, err := configStore.GetLatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), latest.Version)
+
+	// the lease expires, e.g. because the repository crashed.
+	_, err = scheduledColl.UpdateByID(ctx, id, bson.M{"$set": bson.M{"claimed_until": time.Now().Add(-time.Second)}})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		latest, err := configStore.GetLatestVersion()
+		require.NoError(c, err)
+		require.Equal(c, "n1", latest.Config.Name)
+	}, 10*time.Second, 100*time.Millisecond)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		pending, err := configStore.ListScheduled(ctx)
+		require.NoError(c, err)
+		require.Empty(c, pending)
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+type collectionsConfig struct {
+	List []string `json:"list" default:"[\"a\"]"`
+	Tags []string `json:"tags,omitempty" default:"[\"a\"]"`
+}
+
+func (c *collectionsConfig) Update(new config.Config) error {
+	newCfg, ok := new.(*collectionsConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	*c = *newCfg
+	return nil
+}
+
+func Test_ConfigEmptyCollections(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	writer := NewTestStore[*collectionsConfig](t, f.db)
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	watcher := NewTestStore[*collectionsConfig](t, f.db)
+	watcherDone, err := watcher.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, writerDone, 5*time.Second)
+		doneOrTimeout(t, watcherDone, 5*time.Second)
+	})
+
+	updated, err := writer.UpdateConfig(ctx, config.UpdateConfigCmd[*collectionsConfig]{
+		By:     "u1",
+		Config: &collectionsConfig{List: []string{}, Tags: []string{}},
+	})
+	require.NoError(t, err)
+	// the empty "omitempty" slice is not stored: it takes its default.
+	require.Equal(t, &collectionsConfig{List: []string{}, Tags: []string{"a"}}, updated.Config)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		latest, err := watcher.GetLatestVersion()
+		require.NoError(c, err)
+		require.Equal(c, updated, latest)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_ConfigHealthCheck(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	require.ErrorIs(t, configStore.HealthCheck(ctx), config.ErrNotStarted)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	require.NoError(t, configStore.WaitReady(ctx))
+	require.NoError(t, configStore.HealthCheck(ctx))
+}
+
+func Test_ConfigWatchPipeline(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db, config.WithWatchPipeline[*appConfigV0](mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}},
+	}))
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	require.NoError(t, configStore.WaitReady(ctx))
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		cfg, err := configStore.GetConfig()
+		require.NoError(c, err)
+		require.Equal(c, "n1", cfg.Name)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_ConfigPolling(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	writer := NewTestStore[*appConfigV0](t, f.db, config.WithPolling[*appConfigV0](50*time.Millisecond))
+	reader := NewTestStore[*appConfigV0](t, f.db, config.WithPolling[*appConfigV0](50*time.Millisecond))
+	writerDone, err := writer.Start(ctx)
+	require.NoError(t, err)
+	readerDone, err := reader.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, writerDone, 5*time.Second)
+		doneOrTimeout(t, readerDone, 5*time.Second)
+	})
+	require.NoError(t, reader.WaitReady(ctx))
+	require.NoError(t, reader.HealthCheck(ctx))
+
+	_, err = writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}})
+	require.NoError(t, err)
+	_, err = writer.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n2"}})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		latest, err := reader.GetLatestVersion()
+		require.NoError(c, err)
+		require.Equal(c, uint64(2), latest.Version)
+		require.Equal(c, "n2", latest.Config.Name)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_ConfigReconcile(t *testing.T) {
+	t.Parallel()
+	for name, tc := range map[string]struct {
+		opts []func(repo *config.WatchedRepo[*appConfigV0])
+		// id returns the _id of the version.
+		id func(version int) any
+	}{
+		"default": {
+			id: func(version int) any { return version },
+		},
+		"document filter": {
+			opts: []func(repo *config.WatchedRepo[*appConfigV0]){
+				config.WithDocumentFilter[*appConfigV0](bson.M{"type": "appconfig"}),
+			},
+			id: func(version int) any { return version },
+		},
+		"environment": {
+			opts: []func(repo *config.WatchedRepo[*appConfigV0]){
+				config.WithEnvironment[*appConfigV0]("prod"),
+			},
+			id: func(version int) any {
+				return bson.D{{Key: "environment", Value: "prod"}, {Key: "version", Value: version}}
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			f := newFixture(t)
+			ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+			configStore := NewTestStore[*appConfigV0](t, f.db, tc.opts...)
+			done, err := configStore.Start(ctx)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				cnl()
+				doneOrTimeout(t, done, 5*time.Second)
+			})
+			require.NoError(t, configStore.WaitReady(ctx))
+			for _, name := range []string{"n1", "n2"} {
+				_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: name}})
+				require.NoError(t, err)
+			}
+			eventuallyName := func(version uint64, name string) {
+				t.Helper()
+				require.EventuallyWithT(t, func(c *assert.CollectT) {
+					latest, err := configStore.GetLatestVersion()
+					require.NoError(c, err)
+					require.Equal(c, version, latest.Version)
+					require.Equal(c, name, latest.Config.Name)
+				}, 5*time.Second, 10*time.Millisecond)
+			}
+			eventuallyName(2, "n2")
+
+			coll := f.db.Collection("config")
+			_, err = coll.UpdateOne(ctx, bson.M{"_id": tc.id(2)}, bson.M{"$set": bson.M{"app_config.name": "edited"}})
+			require.NoError(t, err)
+			eventuallyName(2, "edited")
+
+			_, err = coll.DeleteOne(ctx, bson.M{"_id": tc.id(2)})
+			require.NoError(t, err)
+			eventuallyName(1, "n1")
+
+			_, err = coll.DeleteMany(ctx, bson.M{})
+			require.NoError(t, err)
+			eventuallyName(0, "bobby")
+		})
+	}
+}
+
+func Test_ConfigInvalidateRecovery(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	var watchErrs atomic.Int32
+	configStore := NewTestStore[*appConfigV0](t, f.db, config.WithOnError[*appConfigV0](func(error) {
+		watchErrs.Add(1)
+	}))
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	require.NoError(t, configStore.WaitReady(ctx))
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		latest, err := configStore.GetLatestVersion()
+		require.NoError(c, err)
+		require.Equal(c, uint64(1), latest.Version)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	coll := f.db.Collection("config")
+	require.NoError(t, coll.Drop(ctx))
+	// the versions are gone with the collection and its indexes re-created.
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		latest, err := configStore.GetLatestVersion()
+		require.NoError(c, err)
+		require.Equal(c, uint64(0), latest.Version)
+		require.Equal(c, "bobby", latest.Config.Name)
+		specs, err := coll.Indexes().ListSpecifications(ctx)
+		require.NoError(c, err)
+		names := make([]string, 0, len(specs))
+		for _, spec := range specs {
+			names = append(names, spec.Name)
+		}
+		require.Contains(c, names, "idx_created_at_inc")
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Zero(t, watchErrs.Load())
+
+	_, err = configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n2"}})
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		latest, err := configStore.GetLatestVersion()
+		require.NoError(c, err)
+		require.Equal(c, uint64(1), latest.Version)
+		require.Equal(c, "n2", latest.Config.Name)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_ConfigRangeVersions(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	for _, name := range []string{"n1", "", "n3"} {
+		_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: name}})
+		require.NoError(t, err)
+	}
+
+	query := config.ListVersionedConfigsQuery{FromVersion: 1, ToVersion: 10}
+	var names []string
+	require.NoError(t, configStore.RangeVersions(ctx, query, func(v *config.Versioned[*appConfigV0]) error {
+		names = append(names, v.Config.Name)
+		return nil
+	}))
+	require.Equal(t, []string{"n1", "bobby", "n3"}, names)
+
+	errStop := errors.New("stop")
+	var versions []uint64
+	err = configStore.RangeVersions(ctx, query, func(v *config.Versioned[*appConfigV0]) error {
+		versions = append(versions, v.Version)
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, []uint64{1}, versions)
+
+	newest, err := configStore.ListVersionedConfigs(ctx, config.ListVersionedConfigsQuery{
+		FromVersion: 0,
+		ToVersion:   10,
+		Limit:       2,
+		Descending:  true,
+	})
+	require.NoError(t, err)
+	require.Len(t, newest, 2)
+	require.Equal(t, uint64(3), newest[0].Version)
+	require.Equal(t, uint64(2), newest[1].Version)
+	lastN, err := configStore.GetLastN(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, newest, lastN)
+	byDate, err := configStore.ListVersionedConfigsByDate(ctx, config.ListConfigDatesQuery{
+		From:       time.Now().Add(-time.Hour),
+		To:         time.Now().Add(time.Hour),
+		Descending: true,
+	})
+	require.NoError(t, err)
+	require.Len(t, byDate, 3)
+	require.Equal(t, uint64(3), byDate[0].Version)
+	datePage, err := configStore.ListVersionedConfigsByDate(ctx, config.ListConfigDatesQuery{
+		From:  time.Now().Add(-time.Hour),
+		To:    time.Now().Add(time.Hour),
+		Skip:  1,
+		Limit: 1,
+	})
+	require.NoError(t, err)
+	require.Len(t, datePage, 1)
+	require.Equal(t, uint64(2), datePage[0].Version)
+}
+
+func Test_ConfigListVersionMetadata(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	v1, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}, Reason: "first"})
+	require.NoError(t, err)
+	v2, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u2", Config: &appConfigV0{Name: "n2"}, Tags: []string{"release"}})
+	require.NoError(t, err)
+
+	got, err := configStore.ListVersionMetadata(ctx, config.ListVersionedConfigsQuery{FromVersion: 0, ToVersion: 10})
+	require.NoError(t, err)
+	require.Equal(t, []*config.VersionMetadata{
+		{Version: 1, UpdatedBy: "u1", CreatedAt: v1.CreatedAt, Reason: "first"},
+		{Version: 2, UpdatedBy: "u2", CreatedAt: v2.CreatedAt, Tags: []string{"release"}},
+	}, got)
+}
+
+func Test_ConfigAuditCollection(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db,
+		config.WithAuditCollection[*appConfigV0]("config_audit"),
+		config.WithMaxVersions[*appConfigV0](1),
+	)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	v1, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u1", Config: &appConfigV0{Name: "n1"}, Reason: "first"})
+	require.NoError(t, err)
+	v2, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{By: "u2", Config: &appConfigV0{Name: "n2"}})
+	require.NoError(t, err)
+
+	records, err := configStore.ListAudit(ctx, config.ListConfigDatesQuery{
+		From: v1.CreatedAt,
+		To:   v2.CreatedAt.Add(time.Second),
+	})
+	require.NoError(t, err)
+	// the pruned version is still audited.
+	require.Len(t, records, 2)
+	require.Equal(t, uint64(1), records[0].Version)
+	require.Equal(t, "u1", records[0].UpdatedBy)
+	require.Equal(t, v1.CreatedAt, records[0].CreatedAt)
+	require.Equal(t, "first", records[0].Reason)
+	require.Empty(t, records[0].BeforeHash)
+	require.NotEmpty(t, records[0].AfterHash)
+	require.Equal(t, uint64(2), records[1].Version)
+	require.Equal(t, records[0].AfterHash, records[1].BeforeHash)
+	require.NotEqual(t, records[1].BeforeHash, records[1].AfterHash)
+
+	latest, err := configStore.ListAudit(ctx, config.ListConfigDatesQuery{
+		From:       v1.CreatedAt,
+		To:         v2.CreatedAt.Add(time.Second),
+		Descending: true,
+		Limit:      1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, records[1:], latest)
+
+	// the imported versions extend the chain, at the time of the import.
+	_, err = configStore.Import(ctx, config.ImportCmd[*appConfigV0]{
+		Versions: []*config.Versioned[*appConfigV0]{{Version: 1, UpdatedBy: "u3", CreatedAt: v1.CreatedAt, Config: &appConfigV0{Name: "n3"}}},
+	})
+	require.NoError(t, err)
+	imported, err := configStore.ListAudit(ctx, config.ListConfigDatesQuery{
+		From:       v1.CreatedAt,
+		To:         time.Now().Add(time.Second),
+		Descending: true,
+		Limit:      1,
+	})
+	require.NoError(t, err)
+	require.Len(t, imported, 1)
+	require.Equal(t, uint64(1), imported[0].Version)
+	require.Equal(t, "u3", imported[0].UpdatedBy)
+	require.True(t, imported[0].CreatedAt.After(v2.CreatedAt))
+	require.Equal(t, records[1].AfterHash, imported[0].BeforeHash)
+
+	_, err = NewTestStore[*appConfigV0](t, f.db).ListAudit(ctx, config.ListConfigDatesQuery{})
+	require.ErrorIs(t, err, config.ErrNotStarted)
+}
+
+func Test_ConfigVerifyIndexes(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	skipping := NewTestStore[*appConfigV0](t, f.db, config.WithSkipIndexOperations[*appConfigV0]())
+	done, err := skipping.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+	missing, err := skipping.VerifyIndexes(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		"idx_created_at_inc", "idx_updated_by_inc", "idx_tags_inc", "idx_apply_at_inc",
+	}, missing)
+
+	creating := NewTestStore[*appConfigV0](t, f.db)
+	creatingDone, err := creating.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, creatingDone, 5*time.Second)
+	})
+	for _, repo := range []*config.WatchedRepo[*appConfigV0]{skipping, creating} {
+		missing, err := repo.VerifyIndexes(ctx)
+		require.NoError(t, err)
+		require.Empty(t, missing)
+	}
+}
+
+func Test_ConfigIndexOptionsChange(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cnl)
+	coll := f.db.Collection("config")
+	indexNames := func() []string {
+		specs, err := coll.Indexes().ListSpecifications(ctx)
+		require.NoError(t, err)
+		names := make([]string, 0, len(specs))
+		for _, spec := range specs {
+			names = append(names, spec.Name)
+		}
+		return names
+	}
+	for _, opts := range []*options.IndexOptions{
+		nil,
+		options.Index().SetName("created_at_1"),
+		options.Index().SetName("created_at_1").
+			SetPartialFilterExpression(bson.M{"updated_by": bson.M{"$exists": true}}),
+		options.Index().SetCollation(&options.Collation{Locale: "en"}),
+	} {
+		repoCtx, repoCnl := context.WithCancel(ctx)
+		repo := NewTestStore[*appConfigV0](t, f.db, config.WithIndexOptions[*appConfigV0](opts))
+		done, err := repo.Start(repoCtx)
+		require.NoError(t, err)
+		missing, err := repo.VerifyIndexes(ctx)
+		require.NoError(t, err)
+		require.Empty(t, missing)
+		repoCnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	}
+	require.Contains(t, indexNames(), "idx_created_at_inc")
+}
+
+// Test_ConfigConcurrentReads is meant to be run with -race: the cached
+// configuration is read while the watcher replaces it.
+func Test_ConfigConcurrentReads(t *testing.T) {
+	t.Parallel()
+	f := newFixture(t)
+	ctx, cnl := context.WithTimeout(context.Background(), 30*time.Second)
+	configStore := NewTestStore[*appConfigV0](t, f.db)
+	done, err := configStore.Start(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cnl()
+		doneOrTimeout(t, done, 5*time.Second)
+	})
+
+	const updates = 20
+	var wg sync.WaitGroup
+	wg.Add(2)
+	updated := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		defer close(updated)
+		for i := 0; i < updates; i++ {
+			_, err := configStore.UpdateConfig(ctx, config.UpdateConfigCmd[*appConfigV0]{
+				By:     "u1",
+				Config: &appConfigV0{Name: fmt.Sprintf("n%d", i)},
+			})
+			assert.NoError(t, err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-updated:
+				return
+			default:
+			}
+			cfg, err := configStore.GetConfig()
+			assert.NoError(t, err)
+			assert.NotEmpty(t, cfg.Name)
+		}
+	}()
+	wg.Wait()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		v, err := configStore.GetLatestVersion()
+		require.NoError(c, err)
+		assert.Equal(c, uint64(updates), v.Version)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func channelClosedOrTimeout[V any](t *testing.T, ch <-chan V, duration time.Duration) {
+	t.Helper()
+	timeout := time.After(duration)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for channel to be closed")
+		}
+	}
+}
+
 func doneOrTimeout(t *testing.T, done <-chan struct{}, duration time.Duration) {
 	select {
 	case <-done:
@@ -0,0 +1,160 @@
+package streamingconfig
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriptionBufferSize is the number of versions buffered for a subscriber
+// before the oldest ones start being dropped.
+const subscriptionBufferSize = 16
+
+// subscription delivers the versions observed by the watcher to a single
+// subscriber.
+type subscription[T Config] struct {
+	ch chan *Versioned[T]
+}
+
+// send delivers the version without ever blocking the watcher: when the
+// subscriber is too slow and its buffer is full, the oldest buffered version is
+// dropped.
+func (sub *subscription[T]) send(v *Versioned[T]) {
+	for {
+		select {
+		case sub.ch <- v:
+			return
+		default:
+		}
+		select {
+		case <-sub.ch:
+		default:
+		}
+	}
+}
+
+// Observe returns the current configuration version along with a channel
+// receiving every subsequent version, with defaults applied. No version
+// observed after the snapshot is missed by the channel. The snapshot and every
+// received version are copies that the caller is free to modify.
+//
+// The channel is closed when the returned cancel function is called, when the
+// input context is done or when the repository stops watching for changes.
+// Cancel must be called to release the subscription once the caller is not
+// interested in updates anymore; calling it multiple times is safe.
+func (s *WatchedRepo[T]) Observe(ctx context.Context) (*Versioned[T], <-chan *Versioned[T], func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.startedErr(); err != nil {
+		return nil, nil, nil, err
+	}
+	// a copy, for the caller not to alter the cached version.
+	current, err := deepCopy(s.cfgWithDefaults)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sub := s.subscribe()
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			s.unsubscribe(sub)
+		})
+	}
+	stop := context.AfterFunc(ctx, unsubscribe)
+	cancel := func() {
+		stop()
+		unsubscribe()
+	}
+	return current, sub.ch, cancel, nil
+}
+
+// WaitForVersion blocks until the cached configuration reaches at least the
+// version, e.g. once another process updated it, and returns a copy of the
+// cached version with defaults applied. It returns the context error when the
+// context is done first, and ErrStopped when the repository stops watching
+// for changes before.
+func (s *WatchedRepo[T]) WaitForVersion(ctx context.Context, version uint64) (*Versioned[T], error) {
+	current, versions, cancel, err := s.Observe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	for current.Version < version {
+		var ok bool
+		if current, ok = <-versions; !ok {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrStopped
+		}
+	}
+	return current, nil
+}
+
+// Subscribe returns a channel receiving every version applied from now on,
+// with defaults applied; use Observe to also get the current version. It can
+// be called before Start. The received versions are copies that the
+// subscriber is free to modify. Every call returns a distinct channel, which never
+// blocks the watcher: when the subscriber is too slow, the oldest buffered
+// versions are dropped.
+//
+// The channel is closed when the input context is done or when the repository
+// stops watching for changes.
+func (s *WatchedRepo[T]) Subscribe(ctx context.Context) <-chan *Versioned[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		ch := make(chan *Versioned[T])
+		close(ch)
+		return ch
+	}
+	sub := s.subscribe()
+	context.AfterFunc(ctx, func() {
+		s.unsubscribe(sub)
+	})
+	return sub.ch
+}
+
+// subscribe registers a new subscription. It must be called with s.mu held.
+func (s *WatchedRepo[T]) subscribe() *subscription[T] {
+	sub := &subscription[T]{ch: make(chan *Versioned[T], subscriptionBufferSize)}
+	if s.subscriptions == nil {
+		s.subscriptions = make(map[*subscription[T]]struct{})
+	}
+	s.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe removes the subscription and closes its channel.
+func (s *WatchedRepo[T]) unsubscribe(sub *subscription[T]) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscriptions[sub]; ok {
+		delete(s.subscriptions, sub)
+		close(sub.ch)
+	}
+}
+
+// closeSubscriptions removes all the subscriptions and closes their channels.
+func (s *WatchedRepo[T]) closeSubscriptions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscriptions {
+		delete(s.subscriptions, sub)
+		close(sub.ch)
+	}
+}
+
+// publish delivers the version to all the subscriptions. It must be called
+// with s.mu held.
+func (s *WatchedRepo[T]) publish(v *Versioned[T]) {
+	for sub := range s.subscriptions {
+		// a copy each, for the subscribers not to alter the cached version
+		// nor the one of the others.
+		cp, err := deepCopy(v)
+		if err != nil {
+			s.lgr.With("error", err, "version", v.Version).Error("could not copy version for subscriber")
+			continue
+		}
+		sub.send(cp)
+	}
+}
@@ -0,0 +1,63 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/creasty/defaults"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListByTag returns the versions labeled with the tag, in version order, with
+// defaults applied.
+func (s *WatchedRepo[T]) ListByTag(ctx context.Context, tag string) ([]*Versioned[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: s.versionField(), Value: 1}})
+	cursor, err := s.configs.Find(ctxTimeout, s.filter(bson.M{"tags": tag}), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctxTimeout)
+	configs := make([]*Versioned[T], 0)
+	for cursor.Next(ctxTimeout) {
+		cfg, err := s.decodeVersion(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		if err := defaults.Set(cfg); err != nil {
+			return nil, fmt.Errorf("failed to set defaults: %w", err)
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, cursor.Err()
+}
+
+// RollbackToTag rolls back, as Rollback does, to the most recent version
+// labeled with the tag. ErrConfigurationNotFound is returned if no version has
+// the tag.
+func (s *WatchedRepo[T]) RollbackToTag(ctx context.Context, by, tag string) (*Versioned[T], error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	if err := s.mongoOnly(); err != nil {
+		return nil, err
+	}
+	target, err := s.findLatest(ctx, bson.M{"tags": tag})
+	if errors.Is(err, ErrConfigurationNotFound) {
+		return nil, fmt.Errorf("no version tagged %q: %w", tag, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Rollback(ctx, RollbackCmd[T]{By: by, ToVersion: target.Version})
+}
@@ -0,0 +1,91 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// topology is the kind of MongoDB deployment the repository is connected to.
+type topology string
+
+const (
+	topologyStandalone topology = "standalone"
+	topologyReplicaSet topology = "replica_set"
+	topologySharded    topology = "sharded"
+)
+
+// ErrChangeStreamsUnsupported is returned by Start when the deployment does not
+// support change streams, e.g. a standalone MongoDB server.
+var ErrChangeStreamsUnsupported = errors.New("change streams unsupported: MongoDB must run as a replica set " +
+	"(a single-node one is enough for development) or a sharded cluster, or the repository must poll with WithPolling")
+
+// changeStreamsUnsupportedCode is the code of the error of the servers that do
+// not support the $changeStream stage.
+const changeStreamsUnsupportedCode = 40573
+
+// shardedMaxAwaitTime bounds how long mongos waits for events from all the
+// shards before answering a change-stream getMore. On sharded clusters, events
+// are only delivered once every shard has advanced past them, so without a
+// bound an idle shard delays both the delivery and the resume token progress.
+const shardedMaxAwaitTime = 1 * time.Second
+
+// helloResponse holds the subset of the `hello`/`isMaster` command response
+// used to detect the deployment topology.
+type helloResponse struct {
+	Msg     string `bson:"msg"`
+	SetName string `bson:"setName"`
+}
+
+func (h helloResponse) topology() topology {
+	switch {
+	case h.Msg == "isdbgrid":
+		return topologySharded
+	case h.SetName != "":
+		return topologyReplicaSet
+	default:
+		return topologyStandalone
+	}
+}
+
+// detectTopology queries the server with the `hello` command, falling back to
+// the legacy `isMaster` command for servers that do not support it.
+func (s *WatchedRepo[T]) detectTopology(ctx context.Context) (topology, error) {
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	admin := s.source.Client().Database("admin")
+	var resp helloResponse
+	err := admin.RunCommand(ctxTimeout, bson.D{{Key: "hello", Value: 1}}).Decode(&resp)
+	if err != nil {
+		err = admin.RunCommand(ctxTimeout, bson.D{{Key: "isMaster", Value: 1}}).Decode(&resp)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error detecting mongo topology: %w", err)
+	}
+	return resp.topology(), nil
+}
+
+// changeStreamsUnsupported reports whether the change stream failed to open
+// because the deployment does not support change streams.
+func changeStreamsUnsupported(t topology, err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == changeStreamsUnsupportedCode {
+		return true
+	}
+	return t == topologyStandalone
+}
+
+// changeStreamOptions returns the change-stream options suited to the
+// detected topology.
+func changeStreamOptions(t topology) *options.ChangeStreamOptions {
+	opts := options.ChangeStream()
+	if t == topologySharded {
+		opts.SetMaxAwaitTime(shardedMaxAwaitTime)
+	}
+	return opts
+}
@@ -0,0 +1,46 @@
+package streamingconfig
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func Test_HelloResponseTopology(t *testing.T) {
+	tests := []struct {
+		name string
+		resp helloResponse
+		want topology
+	}{
+		{name: "mongos", resp: helloResponse{Msg: "isdbgrid"}, want: topologySharded},
+		{name: "replica set member", resp: helloResponse{SetName: "rs0"}, want: topologyReplicaSet},
+		{name: "standalone", resp: helloResponse{}, want: topologyStandalone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.resp.topology())
+		})
+	}
+}
+
+func Test_ChangeStreamOptions(t *testing.T) {
+	t.Run("sharded bounds the await time", func(t *testing.T) {
+		opts := changeStreamOptions(topologySharded)
+		require.NotNil(t, opts.MaxAwaitTime)
+		require.Equal(t, shardedMaxAwaitTime, *opts.MaxAwaitTime)
+	})
+	t.Run("replica set keeps server defaults", func(t *testing.T) {
+		opts := changeStreamOptions(topologyReplicaSet)
+		require.Nil(t, opts.MaxAwaitTime)
+	})
+}
+
+func Test_ChangeStreamsUnsupported(t *testing.T) {
+	unsupported := mongo.CommandError{Code: changeStreamsUnsupportedCode, Message: "The $changeStream stage is only supported on replica sets"}
+	require.True(t, changeStreamsUnsupported(topologyReplicaSet, unsupported))
+	require.True(t, changeStreamsUnsupported(topologyStandalone, errors.New("boom")))
+	require.False(t, changeStreamsUnsupported(topologyReplicaSet, errors.New("boom")))
+	require.False(t, changeStreamsUnsupported(topologySharded, mongo.CommandError{Code: 13}))
+}
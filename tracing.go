@@ -0,0 +1,49 @@
+package streamingconfig
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/rbroggi/streamingconfig"
+
+// span attributes.
+const (
+	versionAttribute       = attribute.Key("streamingconfig.version")
+	authorAttribute        = attribute.Key("streamingconfig.author")
+	conflictAttribute      = attribute.Key("streamingconfig.conflict")
+	operationTypeAttribute = attribute.Key("streamingconfig.operation_type")
+	countAttribute         = attribute.Key("streamingconfig.count")
+)
+
+// WithTracerProvider traces the updates, the reads of the latest version, the
+// listings and the processing of the change stream events with OpenTelemetry
+// spans, children of the spans of the input contexts. The spans are
+// attributed with the resulting version, the author, and whether the update
+// conflicted with a concurrent one.
+func WithTracerProvider[T Config](tp trace.TracerProvider) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// startSpan starts a span, a no-op one when tracing is disabled.
+func (s *WatchedRepo[T]) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if s.tracer == nil {
+		return ctx, noop.Span{}
+	}
+	return s.tracer.Start(ctx, "streamingconfig."+name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span, recording the error if any.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,96 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// minVersionTTL guards against expiring the versions faster than they are
+// typically updated.
+const minVersionTTL = time.Hour
+
+// indexOptionsConflictCode is returned when creating an index that exists with
+// different options.
+const indexOptionsConflictCode = 85
+
+// indexKeySpecsConflictCode is returned when creating an index with the name of
+// an existing index on other keys.
+const indexKeySpecsConflictCode = 86
+
+// indexNotFoundCode is returned when dropping an index that does not exist.
+const indexNotFoundCode = 27
+
+const (
+	// ttlCreatedAtField holds the creation time of the superseded versions,
+	// which the TTL index applies to.
+	ttlCreatedAtField = "ttl_created_at"
+	ttlIndexName      = "idx_ttl_created_at"
+)
+
+// ErrVersionTTLTooShort is returned by the constructor of the repo when the
+// version TTL is shorter than an hour.
+var ErrVersionTTLTooShort = errors.New("version TTL must be at least one hour")
+
+// WithVersionTTL makes MongoDB delete the versions created more than d ago,
+// but the latest one, through a TTL index. The TTL must be at least an hour.
+//
+// The TTL index applies to a copy of the creation time that the repository
+// sets on the previous version whenever it creates one: the latest version
+// never expires, and the version numbers never restart. The versions
+// superseded by repositories without the option never expire. Changing d
+// updates the expiry of the existing index, and removing the option drops it.
+// It has no effect with WithSkipIndexOperations.
+func WithVersionTTL[T Config](d time.Duration) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.versionTTL = d
+	}
+}
+
+// setVersionTTL updates the expiry of the TTL index.
+func (s *WatchedRepo[T]) setVersionTTL(ctx context.Context) error {
+	return s.source.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: s.collectionName},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: ttlIndexName},
+			{Key: "expireAfterSeconds", Value: int32(s.versionTTL.Seconds())},
+		}},
+	}).Err()
+}
+
+// markSuperseded makes the superseded version expire, copying its creation
+// time in the field of the TTL index.
+func (s *WatchedRepo[T]) markSuperseded(ctx context.Context, version uint64) error {
+	_, err := s.configs.UpdateOne(ctx,
+		s.filter(bson.M{s.versionField(): version, ttlCreatedAtField: bson.M{"$exists": false}}),
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{ttlCreatedAtField: "$created_at"}}}},
+	)
+	return err
+}
+
+// dropIndex drops the index of the collection, if any.
+func dropIndex(ctx context.Context, coll *mongo.Collection, name string) error {
+	_, err := coll.Indexes().DropOne(ctx, name)
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) &&
+		(serverErr.HasErrorCode(indexNotFoundCode) || serverErr.HasErrorCode(namespaceNotFoundCode)) {
+		return nil
+	}
+	return err
+}
+
+func isIndexOptionsConflict(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(indexOptionsConflictCode)
+}
+
+// isIndexConflict reports whether the index could not be created because of an
+// existing one, on the same keys or with the same name.
+func isIndexConflict(err error) bool {
+	var serverErr mongo.ServerError
+	return isIndexOptionsConflict(err) ||
+		errors.As(err, &serverErr) && serverErr.HasErrorCode(indexKeySpecsConflictCode)
+}
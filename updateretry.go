@@ -0,0 +1,61 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// BackoffFunc returns the delay to wait for before the retry following the
+// failed attempt, numbered from 1.
+type BackoffFunc func(attempt int) time.Duration
+
+// ExponentialBackoff returns a BackoffFunc waiting for the initial delay
+// before the first retry, doubled on each retry up to the maximum one, with
+// jitter for the colliding writers not to collide again.
+func ExponentialBackoff(initial, maximum time.Duration) BackoffFunc {
+	return func(attempt int) time.Duration {
+		d := initial
+		for i := 1; i < attempt && d < maximum; i++ {
+			d *= 2
+		}
+		return jitter(min(d, maximum))
+	}
+}
+
+// WithUpdateRetry makes the updates colliding with a concurrent one retry up
+// to maxAttempts attempts in total, waiting for the backoff between them, nil
+// for no wait, instead of failing with ErrConcurrentUpdate at once. Each
+// attempt re-reads the latest version and applies the update and the
+// validations to it again; ErrConcurrentUpdate is returned once the attempts
+// are exhausted. The operation timeout bounds all the attempts together.
+//
+// The updates setting an ExpectedVersion are not retried: the version they
+// expect is gone once they collide.
+func WithUpdateRetry[T Config](maxAttempts int, backoff BackoffFunc) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.updateMaxAttempts = maxAttempts
+		repo.updateBackoff = backoff
+	}
+}
+
+// retryConflicts calls fn until it does not fail with ErrConcurrentUpdate, as
+// set with WithUpdateRetry.
+func (s *WatchedRepo[T]) retryConflicts(ctx context.Context, cmd UpdateConfigCmd[T], fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !errors.Is(err, ErrConcurrentUpdate) || cmd.ExpectedVersion != nil || attempt >= s.updateMaxAttempts {
+			return err
+		}
+		var wait time.Duration
+		if s.updateBackoff != nil {
+			wait = s.updateBackoff(attempt)
+		}
+		s.lgr.With("attempt", attempt, "backoff", wait).DebugContext(ctx, "retrying concurrent update")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
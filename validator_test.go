@@ -0,0 +1,110 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type validatedConfig struct {
+	Age     int `json:"age"`
+	updates int
+}
+
+func (c *validatedConfig) Update(new Config) error {
+	newCfg, ok := new.(*validatedConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	c.Age = newCfg.Age
+	c.updates++
+	return nil
+}
+
+func (c *validatedConfig) Validate() error {
+	if c.Age < 0 {
+		return errors.New("age must not be negative")
+	}
+	return nil
+}
+
+func Test_Validator(t *testing.T) {
+	repo, err := NewInMemoryRepo[*validatedConfig]()
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = repo.Start(ctx)
+	require.NoError(t, err)
+
+	t.Run("first insert", func(t *testing.T) {
+		_, err := repo.UpdateConfig(ctx, UpdateConfigCmd[*validatedConfig]{
+			Config: &validatedConfig{Age: -1},
+		})
+		require.EqualError(t, err, "age must not be negative")
+		cfg := &validatedConfig{Age: 1}
+		_, err = repo.UpdateConfig(ctx, UpdateConfigCmd[*validatedConfig]{Config: cfg})
+		require.NoError(t, err)
+		// no self-update is needed to validate.
+		require.Zero(t, cfg.updates)
+	})
+	t.Run("update", func(t *testing.T) {
+		_, err := repo.UpdateConfig(ctx, UpdateConfigCmd[*validatedConfig]{
+			Config: &validatedConfig{Age: -2},
+		})
+		require.EqualError(t, err, "age must not be negative")
+		latest, err := repo.GetLatestVersion()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), latest.Version)
+	})
+}
+
+type multiValidatedConfig struct {
+	Age  int    `json:"age"`
+	Name string `json:"name"`
+}
+
+func (c *multiValidatedConfig) Update(new Config) error {
+	return ReplaceUpdate(c, new)
+}
+
+func (c *multiValidatedConfig) ValidateAll() []error {
+	var errs []error
+	if c.Age < 0 {
+		errs = append(errs, errors.New("age must not be negative"))
+	}
+	if c.Name == "" {
+		errs = append(errs, errors.New("name must be set"))
+	}
+	return errs
+}
+
+// Validate is shadowed by ValidateAll.
+func (c *multiValidatedConfig) Validate() error {
+	return errors.New("unexpected call")
+}
+
+func Test_MultiValidator(t *testing.T) {
+	repo, err := NewInMemoryRepo[*multiValidatedConfig]()
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = repo.Start(ctx)
+	require.NoError(t, err)
+
+	_, err = repo.UpdateConfig(ctx, UpdateConfigCmd[*multiValidatedConfig]{
+		Config: &multiValidatedConfig{Age: -1},
+	})
+	require.EqualError(t, err, "age must not be negative\nname must be set")
+	var joined interface{ Unwrap() []error }
+	require.ErrorAs(t, err, &joined)
+	require.Len(t, joined.Unwrap(), 2)
+
+	_, err = repo.UpdateConfig(ctx, UpdateConfigCmd[*multiValidatedConfig]{
+		Config: &multiValidatedConfig{Age: 1, Name: "bob"},
+	})
+	require.NoError(t, err)
+	_, err = repo.UpdateConfig(ctx, UpdateConfigCmd[*multiValidatedConfig]{
+		Config: &multiValidatedConfig{Age: -1, Name: "bob"},
+	})
+	require.EqualError(t, err, "age must not be negative")
+}
@@ -0,0 +1,81 @@
+package streamingconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// valueConfig is a configuration of a value type: its Update method checks
+// the transition without modifying the receiver.
+type valueConfig struct {
+	Name     string   `json:"name" default:"bobby"`
+	Password string   `json:"password" encrypt:"true"`
+	Hosts    []string `json:"hosts"`
+}
+
+func (c valueConfig) Update(new Config) error {
+	newCfg, ok := new.(valueConfig)
+	if !ok {
+		return errors.New("wrong type")
+	}
+	if c.Name != "" && newCfg.Name == "" {
+		return errors.New("name cannot be removed")
+	}
+	return nil
+}
+
+func Test_valueConfig(t *testing.T) {
+	repo := &WatchedRepo[valueConfig]{nowFunc: time.Now}
+
+	t.Run("update replaces the configuration", func(t *testing.T) {
+		latest := &Versioned[valueConfig]{Version: 1, Config: valueConfig{Name: "n1", Hosts: []string{"h1"}}}
+		cmd := UpdateConfigCmd[valueConfig]{By: "u1", Config: valueConfig{Name: "n2", Hosts: []string{"h2"}}}
+		next, err := repo.nextVersion(latest, cmd)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), next.Version)
+		require.Equal(t, valueConfig{Name: "n2", Hosts: []string{"h2"}}, next.Config)
+		// the new version is isolated from the command.
+		cmd.Config.Hosts[0] = "changed"
+		require.Equal(t, []string{"h2"}, next.Config.Hosts)
+	})
+	t.Run("update rejects the transition", func(t *testing.T) {
+		latest := &Versioned[valueConfig]{Version: 1, Config: valueConfig{Name: "n1"}}
+		_, err := repo.nextVersion(latest, UpdateConfigCmd[valueConfig]{By: "u1", Config: valueConfig{}})
+		require.EqualError(t, err, "name cannot be removed")
+	})
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := defaultConfig[valueConfig]()
+		require.NoError(t, err)
+		require.Equal(t, valueConfig{Name: "bobby"}, cfg)
+		withDefaults, err := repo.withDefaults(&Versioned[valueConfig]{Config: valueConfig{Hosts: []string{"h1"}}})
+		require.NoError(t, err)
+		require.Equal(t, valueConfig{Name: "bobby", Hosts: []string{"h1"}}, withDefaults.Config)
+	})
+	t.Run("field encryption", func(t *testing.T) {
+		c, err := NewAESGCMCipher([]byte("0123456789abcdef"))
+		require.NoError(t, err)
+		repo := &WatchedRepo[valueConfig]{fieldCipher: c}
+		v := &Versioned[valueConfig]{Version: 1, Config: valueConfig{Name: "n1", Password: "p4ss"}}
+		doc, err := repo.document(v)
+		require.NoError(t, err)
+		b, err := bson.Marshal(doc)
+		require.NoError(t, err)
+		raw := bson.Raw(b)
+		require.True(t, strings.HasPrefix(raw.Lookup("app_config", "password").StringValue(), encryptedFieldPrefix))
+		decoded, err := repo.decodeVersion(raw)
+		require.NoError(t, err)
+		require.Equal(t, v.Config, decoded.Config)
+	})
+}
+
+func Test_NewWatchedRepo_interfaceType(t *testing.T) {
+	_, err := NewWatchedRepo[Config](Args{})
+	require.ErrorIs(t, err, ErrTypeMustBePointer)
+	_, err = NewInMemoryRepo[Config]()
+	require.ErrorIs(t, err, ErrTypeMustBePointer)
+}
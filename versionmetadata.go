@@ -0,0 +1,60 @@
+package streamingconfig
+
+import (
+	"context"
+	"time"
+)
+
+// VersionMetadata holds the auditing data of a version, without its
+// configuration (see ListVersionMetadata).
+type VersionMetadata struct {
+	Version   uint64    `json:"version" bson:"-"`
+	UpdatedBy string    `json:"updated_by" bson:"updated_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	Tags      []string  `json:"tags,omitempty" bson:"tags,omitempty"`
+}
+
+// ListVersionMetadata returns the auditing data of the versions matching the
+// query, as ListVersionedConfigs does but without reading nor decoding their
+// configurations, e.g. for history views to list the versions and fetch the
+// configuration of one with GetVersion on demand.
+func (s *WatchedRepo[T]) ListVersionMetadata(
+	ctx context.Context,
+	query ListVersionedConfigsQuery,
+) ([]*VersionMetadata, error) {
+	if err := s.checkStarted(); err != nil {
+		return nil, err
+	}
+	ctxTimeout, cnl := s.operationContext(ctx)
+	defer cnl()
+	res := make([]*VersionMetadata, 0)
+	collect := func(m *VersionMetadata) error {
+		res = append(res, m)
+		return nil
+	}
+	var err error
+	if r, ok := s.store.(metadataRanger); ok {
+		err = r.rangeMetadata(ctxTimeout, query, collect)
+	} else {
+		err = s.store.Range(ctxTimeout, query, func(v *Versioned[T]) error {
+			return collect(&VersionMetadata{
+				Version:   v.Version,
+				UpdatedBy: v.UpdatedBy,
+				CreatedAt: v.CreatedAt,
+				Reason:    v.Reason,
+				Tags:      v.Tags,
+			})
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// metadataRanger is implemented by the stores able to read the auditing data
+// of the versions without their configurations.
+type metadataRanger interface {
+	rangeMetadata(ctx context.Context, query ListVersionedConfigsQuery, fn func(m *VersionMetadata) error) error
+}
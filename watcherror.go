@@ -0,0 +1,81 @@
+package streamingconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrUnexpectedOperation is reported for the change stream events of unexpected
+// operations, e.g. on the whole database.
+var ErrUnexpectedOperation = errors.New("unexpected change stream operation")
+
+// WatchError is reported to the WithOnError callback when the watcher cannot
+// process an event or when the change stream fails.
+type WatchError struct {
+	// OperationType is the type of the event, empty for change stream failures
+	// and "poll" for the failures of the polling (see WithPolling).
+	OperationType string
+	// Version is the document key of the event, 0 if unknown.
+	Version uint64
+	Err     error
+}
+
+func (e *WatchError) Error() string {
+	switch e.OperationType {
+	case "":
+		return fmt.Sprintf("change stream failed: %v", e.Err)
+	case pollOperation:
+		return fmt.Sprintf("polling failed: %v", e.Err)
+	}
+	return fmt.Sprintf("%s event of version %d: %v", e.OperationType, e.Version, e.Err)
+}
+
+func (e *WatchError) Unwrap() error {
+	return e.Err
+}
+
+// WithOnError registers a callback notified of the errors of the watcher, as
+// a *WatchError: events that cannot be decoded or applied, unexpected events
+// and change stream failures, after which the watcher reconnects. It lets
+// applications alert rather than silently run with a stale configuration. The
+// failures of the publishers set with WithEventPublisher are reported as a
+// *PublishError.
+func WithOnError[T Config](onError func(err error)) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		repo.onError = onError
+	}
+}
+
+// eventError wraps the error of the current event of the change stream.
+func eventError(cs *mongo.ChangeStream, err error) *WatchError {
+	we := &WatchError{Err: err, Version: eventVersion(cs)}
+	if opType, ok := cs.Current.Lookup("operationType").StringValueOK(); ok {
+		we.OperationType = opType
+	}
+	return we
+}
+
+// eventVersion returns the version of the document of the current event, 0 if
+// unknown.
+func eventVersion(cs *mongo.ChangeStream) uint64 {
+	if id, ok := cs.Current.Lookup("documentKey", "_id").AsInt64OK(); ok && id > 0 {
+		return uint64(id)
+	}
+	if id, ok := cs.Current.Lookup("documentKey", "_id", "version").AsInt64OK(); ok && id > 0 {
+		// the versions of the repositories scoped to an environment.
+		return uint64(id)
+	}
+	return 0
+}
+
+// reportError logs the error and notifies the error callback, if any.
+func (s *WatchedRepo[T]) reportError(ctx context.Context, msg string, err *WatchError) {
+	s.lgr.With("error", err.Err, "operationType", err.OperationType, "version", err.Version).
+		ErrorContext(ctx, msg)
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
@@ -0,0 +1,39 @@
+package streamingconfig
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WatchError(t *testing.T) {
+	cause := errors.New("boom")
+	tests := []struct {
+		name string
+		err  *WatchError
+		want string
+	}{
+		{
+			name: "event",
+			err:  &WatchError{OperationType: "insert", Version: 3, Err: cause},
+			want: "insert event of version 3: boom",
+		},
+		{
+			name: "change stream",
+			err:  &WatchError{Err: cause},
+			want: "change stream failed: boom",
+		},
+		{
+			name: "polling",
+			err:  &WatchError{OperationType: "poll", Err: cause},
+			want: "polling failed: boom",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.EqualError(t, tt.err, tt.want)
+			require.ErrorIs(t, tt.err, cause)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package streamingconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func Test_watchPipeline(t *testing.T) {
+	insertsOnly := bson.D{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}}
+	others := bson.D{{Key: "operationType", Value: bson.M{"$nin": bson.A{"insert", "update", "replace", "delete"}}}}
+	filtered := bson.D{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "operationType", Value: "insert"}, {Key: "fullDocument.type", Value: "app"}},
+		bson.D{{Key: "operationType", Value: bson.M{"$in": bson.A{"update", "replace", "delete"}}}},
+		others,
+	}}}}}
+	for name, tc := range map[string]struct {
+		repo *WatchedRepo[*schemaConfig]
+		want mongo.Pipeline
+	}{
+		"default": {
+			repo: &WatchedRepo[*schemaConfig]{},
+			want: mongo.Pipeline{},
+		},
+		"document filter": {
+			repo: &WatchedRepo[*schemaConfig]{documentFilter: bson.M{"type": "app"}},
+			want: mongo.Pipeline{filtered},
+		},
+		"environment": {
+			repo: &WatchedRepo[*schemaConfig]{documentFilter: bson.M{environmentField: "prod"}, environment: "prod"},
+			want: mongo.Pipeline{
+				{{Key: "$match", Value: bson.D{{Key: "$or", Value: bson.A{
+					bson.D{{Key: "operationType", Value: "insert"}, {Key: "fullDocument.environment", Value: "prod"}},
+					bson.D{
+						{Key: "operationType", Value: bson.M{"$in": bson.A{"update", "replace", "delete"}}},
+						{Key: "documentKey._id.environment", Value: "prod"},
+					},
+					others,
+				}}}}},
+			},
+		},
+		"custom stages after the document filter": {
+			repo: &WatchedRepo[*schemaConfig]{
+				documentFilter: bson.M{"type": "app"},
+				watchStages:    mongo.Pipeline{insertsOnly},
+			},
+			want: mongo.Pipeline{filtered, insertsOnly},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, tc.repo.watchPipeline())
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package streamingconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader holds the hex-encoded HMAC-SHA256 of the
+	// timestamp and the body of the webhook (see SignWebhook), prefixed with
+	// "sha256=", when a secret is set.
+	WebhookSignatureHeader = "X-Streamingconfig-Signature"
+	// WebhookTimestampHeader holds the time the webhook was sent at, in Unix
+	// seconds.
+	WebhookTimestampHeader = "X-Streamingconfig-Timestamp"
+	// WebhookVersionHeader holds the version notified by the webhook.
+	WebhookVersionHeader = "X-Streamingconfig-Version"
+
+	defaultNotifyAttempts = 5
+	defaultNotifyBackoff  = time.Second
+	defaultOutboxSize     = 100
+	defaultWebhookTimeout = 10 * time.Second
+)
+
+// ErrOutboxFull is reported to the WithOnError callback when a version is
+// dropped because too many wait for delivery, to a webhook or a publisher.
+var ErrOutboxFull = errors.New("outbox full")
+
+// WebhookError is reported to the WithOnError callback when a version could
+// not be notified to a webhook, after retries, or was dropped.
+type WebhookError struct {
+	URL     string
+	Version uint64
+	Err     error
+}
+
+func (e *WebhookError) Error() string {
+	return fmt.Sprintf("could not notify version %d to webhook %s: %v", e.Version, e.URL, e.Err)
+}
+
+func (e *WebhookError) Unwrap() error {
+	return e.Err
+}
+
+// WebhookOption configures a webhook registered with WithWebhook.
+type WebhookOption func(wh *webhook)
+
+// WithWebhookSecret signs the notifications: the WebhookSignatureHeader header
+// holds the HMAC-SHA256 of the WebhookTimestampHeader header and the body
+// keyed with the secret, so that receivers can verify their authenticity (see
+// SignWebhook).
+func WithWebhookSecret(secret string) WebhookOption {
+	return func(wh *webhook) {
+		wh.secret = []byte(secret)
+	}
+}
+
+// WithWebhookRetry sets how many times a notification is attempted, 5 by
+// default, and the delay before the first retry, 1 second by default, doubled
+// on each retry. Connection failures, 429 and 5xx responses are retried.
+func WithWebhookRetry(maxAttempts int, backoff time.Duration) WebhookOption {
+	return func(wh *webhook) {
+		wh.maxAttempts = maxAttempts
+		wh.backoff = backoff
+	}
+}
+
+// WithWebhookOutboxSize sets how many notifications can wait for delivery,
+// 100 by default. The notifications are dropped when the outbox is full, and
+// reported as a *WebhookError wrapping ErrOutboxFull.
+func WithWebhookOutboxSize(size int) WebhookOption {
+	return func(wh *webhook) {
+		wh.outbox = make(chan webhookNotification, size)
+	}
+}
+
+// WithWebhookClient sets the HTTP client sending the notifications, by default
+// one with a 10 seconds timeout.
+func WithWebhookClient(client *http.Client) WebhookOption {
+	return func(wh *webhook) {
+		wh.client = client
+	}
+}
+
+// WithWebhook POSTs the JSON representation of each version created by the
+// updates of the repository, with defaults applied, to the URL, e.g. to notify
+// Slack or trigger a CI pipeline. Only the repository creating a version
+// notifies it: the replicas watching the versions do not, for each version to
+// be notified once. The notifications are delivered in the background, in the
+// order of the updates: failures are retried (see WithWebhookRetry), then
+// logged and reported to the WithOnError callback as a *WebhookError. Note
+// that the fields encrypted with WithFieldEncryption are sent decrypted.
+func WithWebhook[T Config](url string, opts ...WebhookOption) func(repo *WatchedRepo[T]) {
+	return func(repo *WatchedRepo[T]) {
+		wh := &webhook{
+			url:         url,
+			client:      &http.Client{Timeout: defaultWebhookTimeout},
+			maxAttempts: defaultNotifyAttempts,
+			backoff:     defaultNotifyBackoff,
+		}
+		for _, opt := range opts {
+			opt(wh)
+		}
+		if wh.outbox == nil {
+			wh.outbox = make(chan webhookNotification, defaultOutboxSize)
+		}
+		repo.webhooks = append(repo.webhooks, wh)
+	}
+}
+
+type webhook struct {
+	url         string
+	secret      []byte
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	outbox      chan webhookNotification
+}
+
+type webhookNotification struct {
+	version uint64
+	body    []byte
+}
+
+// checkWebhooks returns an error if the URL of a webhook is invalid.
+func (s *WatchedRepo[T]) checkWebhooks() error {
+	for _, wh := range s.webhooks {
+		u, err := url.ParseRequestURI(wh.url)
+		if err != nil {
+			return fmt.Errorf("invalid webhook url %q: %w", wh.url, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid webhook url %q: unsupported scheme", wh.url)
+		}
+	}
+	return nil
+}
+
+// notifyWebhooks queues the notification of the version for delivery.
+func (s *WatchedRepo[T]) notifyWebhooks(v *Versioned[T]) {
+	if len(s.webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		s.lgr.With("error", err, "version", v.Version).Error("could not encode webhook notification")
+		return
+	}
+	for _, wh := range s.webhooks {
+		select {
+		case wh.outbox <- webhookNotification{version: v.Version, body: body}:
+		default:
+			s.webhookFailed(context.Background(), wh, v.Version, ErrOutboxFull)
+		}
+	}
+}
+
+// deliverWebhook sends the notifications queued for the webhook until the
+// context is done.
+func (s *WatchedRepo[T]) deliverWebhook(ctx context.Context, wh *webhook) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-wh.outbox:
+				if err := wh.deliver(ctx, n); err != nil {
+					s.webhookFailed(ctx, wh, n.version, err)
+				}
+			}
+		}
+	}()
+	return done
+}
+
+// webhookFailed logs the failure to notify the version and reports it to the
+// error callback, if any.
+func (s *WatchedRepo[T]) webhookFailed(ctx context.Context, wh *webhook, version uint64, err error) {
+	s.lgr.With("error", err, "url", wh.url, "version", version).
+		ErrorContext(ctx, "could not deliver webhook notification")
+	if s.onError != nil {
+		s.onError(&WebhookError{URL: wh.url, Version: version, Err: err})
+	}
+}
+
+// deliver sends the notification, retrying with an exponential backoff.
+func (wh *webhook) deliver(ctx context.Context, n webhookNotification) error {
+	return retryWithBackoff(ctx, wh.maxAttempts, wh.backoff, func() (bool, error) {
+		return wh.send(ctx, n)
+	})
+}
+
+// send sends the notification once and reports whether a failure is worth
+// retrying.
+func (wh *webhook) send(ctx context.Context, n webhookNotification) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(n.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookVersionHeader, strconv.FormatUint(n.version, 10))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if len(wh.secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(wh.secret, timestamp, n.body))
+	}
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected webhook response status %d", resp.StatusCode)
+}
+
+// SignWebhook returns the hex-encoded HMAC-SHA256 of the timestamp, a dot and
+// the body keyed with the secret, as sent in the WebhookSignatureHeader
+// header, for receivers to verify the notifications (with hmac.Equal). The
+// timestamp is the value of the WebhookTimestampHeader header: receivers
+// should also reject the notifications sent too long ago, e.g. 5 minutes, for
+// a captured notification not to be replayed.
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
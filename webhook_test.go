@@ -0,0 +1,132 @@
+package streamingconfig
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_webhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []*Versioned[*schemaConfig]
+		attempts atomic.Int32
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		signature := r.Header.Get(WebhookSignatureHeader)
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		if !hmac.Equal([]byte(signature), []byte("sha256="+SignWebhook([]byte("s3cr3t"), timestamp, body))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// the first attempt fails, to be retried.
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var v Versioned[*schemaConfig]
+		require.NoError(t, json.Unmarshal(body, &v))
+		require.Equal(t, r.Header.Get(WebhookVersionHeader), "1")
+		mu.Lock()
+		received = append(received, &v)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	repo := &WatchedRepo[*schemaConfig]{lgr: slog.Default()}
+	WithWebhook[*schemaConfig](srv.URL, WithWebhookSecret("s3cr3t"), WithWebhookRetry(3, time.Millisecond))(repo)
+	require.NoError(t, repo.checkWebhooks())
+	ctx, cnl := context.WithCancel(context.Background())
+	done := repo.deliverWebhook(ctx, repo.webhooks[0])
+	defer func() {
+		cnl()
+		<-done
+	}()
+
+	v := &Versioned[*schemaConfig]{Version: 1, UpdatedBy: "u1", Config: &schemaConfig{Name: "n1"}}
+	repo.notifyWebhooks(v)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(c, received, 1)
+		require.Equal(c, "n1", received[0].Config.Name)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), attempts.Load())
+}
+
+func Test_webhook_deliver(t *testing.T) {
+	var attempts atomic.Int32
+	status := http.StatusBadRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	repo := &WatchedRepo[*schemaConfig]{lgr: slog.Default()}
+	WithWebhook[*schemaConfig](srv.URL, WithWebhookRetry(3, time.Millisecond))(repo)
+	wh := repo.webhooks[0]
+
+	// client errors are not retried.
+	require.Error(t, wh.deliver(context.Background(), webhookNotification{version: 1}))
+	require.Equal(t, int32(1), attempts.Load())
+
+	status = http.StatusInternalServerError
+	attempts.Store(0)
+	require.Error(t, wh.deliver(context.Background(), webhookNotification{version: 1}))
+	require.Equal(t, int32(3), attempts.Load())
+}
+
+func Test_webhook_outboxFull(t *testing.T) {
+	var errs []error
+	repo := &WatchedRepo[*schemaConfig]{lgr: slog.Default(), onError: func(err error) { errs = append(errs, err) }}
+	WithWebhook[*schemaConfig]("http://localhost:1", WithWebhookOutboxSize(1))(repo)
+	repo.notifyWebhooks(&Versioned[*schemaConfig]{Version: 1, Config: &schemaConfig{}})
+	repo.notifyWebhooks(&Versioned[*schemaConfig]{Version: 2, Config: &schemaConfig{}})
+	require.Len(t, repo.webhooks[0].outbox, 1)
+	require.Equal(t, uint64(1), (<-repo.webhooks[0].outbox).version)
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], ErrOutboxFull)
+	var whErr *WebhookError
+	require.ErrorAs(t, errs[0], &whErr)
+	require.Equal(t, uint64(2), whErr.Version)
+	require.Equal(t, "http://localhost:1", whErr.URL)
+}
+
+func Test_SignWebhook(t *testing.T) {
+	body := []byte(`{"version":1}`)
+	signature := SignWebhook([]byte("s3cr3t"), "1700000000", body)
+	require.Len(t, signature, 64)
+	// the timestamp is signed, for the notifications not to be replayed.
+	require.NotEqual(t, signature, SignWebhook([]byte("s3cr3t"), "1700000001", body))
+	require.NotEqual(t, signature, SignWebhook([]byte("other"), "1700000000", body))
+}
+
+func Test_checkWebhooks(t *testing.T) {
+	for url, valid := range map[string]bool{
+		"https://hooks.example.com/config": true,
+		"http://localhost:8080":            true,
+		"ftp://example.com":                false,
+		"not a url":                        false,
+	} {
+		repo := &WatchedRepo[*schemaConfig]{}
+		WithWebhook[*schemaConfig](url)(repo)
+		err := repo.checkWebhooks()
+		if valid {
+			require.NoError(t, err, url)
+		} else {
+			require.Error(t, err, url)
+		}
+	}
+}